@@ -0,0 +1,308 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/lib/pq"
+	"strings"
+	"time"
+)
+
+// auditActorSetting is the session variable which holds the actor of the current transaction.
+const auditActorSetting = "app.audit_actor"
+
+// AuditedTable represents a table of which the changes are recorded.
+type AuditedTable struct {
+	Name       string
+	KeyColumns []string
+}
+
+// NewAuditedTable creates a new instance of AuditedTable, of which the rows are identified by the key columns.
+// The name may be qualified by its schema.
+func NewAuditedTable(name string, keyColumns ...string) *AuditedTable {
+	return &AuditedTable{Name: name, KeyColumns: keyColumns}
+}
+
+// AuditEntry represents a single recorded change of a row.
+type AuditEntry struct {
+	ID        int64
+	Schema    string
+	Table     string
+	Operation string
+	Key       json.RawMessage
+	Old       json.RawMessage
+	New       json.RawMessage
+	Actor     string
+	ChangedAt time.Time
+}
+
+// AuditSvcOption is used to instantiate an AuditSvc with the provided settings/configurations/actions.
+type AuditSvcOption func(*AuditSvc)
+
+// AuditOps represents operations related to the audit trail.
+type AuditOps interface {
+	Setup(tables ...*AuditedTable) error
+	Remove(tables ...string) error
+	SetActor(ctx context.Context, tx *sql.Tx, actor string) error
+	History(ctx context.Context, table string, key map[string]interface{}) ([]*AuditEntry, error)
+	Range(ctx context.Context, table string, from, to time.Time) ([]*AuditEntry, error)
+}
+
+// AuditSvc manages triggers which record every change of the audited tables.
+type AuditSvc struct {
+	Database *DbSvc
+	Table    string
+}
+
+// NewAuditSvc creates a new instance of AuditSvc.
+func NewAuditSvc(database *DbSvc, options ...AuditSvcOption) *AuditSvc {
+	audit := &AuditSvc{
+		Database: database,
+		Table:    "audit_log",
+	}
+	for _, option := range options {
+		option(audit)
+	}
+	return audit
+}
+
+// WithAuditTable sets the name of the table in which the changes are recorded.
+// The name may be qualified by its schema; otherwise the table lives in the current schema at the time of Setup.
+func WithAuditTable(table string) AuditSvcOption {
+	return func(a *AuditSvc) {
+		a.Table = table
+	}
+}
+
+// triggerName returns the name of the trigger installed on the audited tables.
+func (a *AuditSvc) triggerName() string {
+	_, name := splitTableName(a.Table)
+	return pq.QuoteIdentifier(name + "_trigger")
+}
+
+// functionName returns the name of the trigger function, qualified by the schema of the audit table.
+func (a *AuditSvc) functionName(schema string) string {
+	_, name := splitTableName(a.Table)
+	return pq.QuoteIdentifier(schema) + "." + pq.QuoteIdentifier(name+"_record")
+}
+
+// resolveSchema returns the schema of the audit table, which is the current schema when its name is unqualified.
+func (a *AuditSvc) resolveSchema(tx *sql.Tx) (string, error) {
+	schema, _ := splitTableName(a.Table)
+	var resolved sql.NullString
+	if err := tx.QueryRow("SELECT coalesce($1::text, current_schema())", schema).Scan(&resolved); err != nil {
+		return "", fmt.Errorf("failed resolving schema of audit table: %w", err)
+	}
+	if !resolved.Valid {
+		return "", fmt.Errorf("failed resolving schema of audit table %s: no current schema", a.Table)
+	}
+	return resolved.String, nil
+}
+
+// Setup creates the audit table and trigger function and (re)installs the trigger on the provided tables.
+// The trigger function refers to the audit table by its schema, so changes are recorded regardless of the search_path of
+// the writer, such as that of a tenant. It is idempotent and safe to run at startup by several instances at once.
+func (a *AuditSvc) Setup(tables ...*AuditedTable) error {
+	return a.Database.RunInTransaction(context.Background(), func(tx *sql.Tx) error {
+		if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext($1))", a.Table); err != nil {
+			return fmt.Errorf("failed acquiring audit setup lock: %w", err)
+		}
+
+		schema, err := a.resolveSchema(tx)
+		if err != nil {
+			return err
+		}
+
+		if err = a.createTable(tx, schema); err != nil {
+			return err
+		}
+
+		if err = a.createFunction(tx, schema); err != nil {
+			return err
+		}
+
+		for _, table := range tables {
+			if err = a.installTrigger(tx, schema, table); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// createTable creates the audit table in the schema, if it does not exist yet.
+func (a *AuditSvc) createTable(tx *sql.Tx, schema string) error {
+	_, name := splitTableName(a.Table)
+	table := pq.QuoteIdentifier(schema) + "." + pq.QuoteIdentifier(name)
+	_, err := tx.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id bigserial PRIMARY KEY,
+		schema_name text NOT NULL,
+		table_name text NOT NULL,
+		operation text NOT NULL,
+		row_key jsonb NOT NULL,
+		old_row jsonb,
+		new_row jsonb,
+		actor text,
+		changed_at timestamptz NOT NULL DEFAULT clock_timestamp()
+	)`, table))
+	if err != nil {
+		return fmt.Errorf("failed creating audit table: %w", err)
+	}
+
+	index := pq.QuoteIdentifier(name + "_table_changed_at_idx")
+	_, err = tx.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (table_name, changed_at)", index, table))
+	if err != nil {
+		return fmt.Errorf("failed creating audit index: %w", err)
+	}
+
+	return nil
+}
+
+// createFunction creates or replaces the trigger function in the schema, which receives the key columns as trigger
+// arguments. Its search_path is pinned, so it resolves nothing through that of the writer.
+func (a *AuditSvc) createFunction(tx *sql.Tx, schema string) error {
+	_, name := splitTableName(a.Table)
+	_, err := tx.Exec(fmt.Sprintf(`CREATE OR REPLACE FUNCTION %s() RETURNS trigger AS $$
+		DECLARE
+			old_row jsonb;
+			new_row jsonb;
+			row_key jsonb := '{}'::jsonb;
+			key_column text;
+		BEGIN
+			IF TG_OP <> 'INSERT' THEN old_row := to_jsonb(OLD); END IF;
+			IF TG_OP <> 'DELETE' THEN new_row := to_jsonb(NEW); END IF;
+			IF TG_NARGS > 0 THEN
+				FOREACH key_column IN ARRAY TG_ARGV LOOP
+					row_key := row_key || jsonb_build_object(key_column, coalesce(new_row, old_row) -> key_column);
+				END LOOP;
+			END IF;
+			INSERT INTO %s (schema_name, table_name, operation, row_key, old_row, new_row, actor)
+			VALUES (TG_TABLE_SCHEMA, TG_TABLE_NAME, TG_OP, row_key, old_row, new_row,
+				nullif(current_setting(%s, true), ''));
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql SET search_path = pg_catalog, pg_temp`, a.functionName(schema),
+		pq.QuoteIdentifier(schema)+"."+pq.QuoteIdentifier(name), pq.QuoteLiteral(auditActorSetting)))
+	if err != nil {
+		return fmt.Errorf("failed creating audit function: %w", err)
+	}
+	return nil
+}
+
+// installTrigger replaces the audit trigger on the table, calling the trigger function in the schema.
+func (a *AuditSvc) installTrigger(tx *sql.Tx, schema string, table *AuditedTable) error {
+	name := quoteTableName(table.Name)
+	if _, err := tx.Exec(fmt.Sprintf("DROP TRIGGER IF EXISTS %s ON %s", a.triggerName(), name)); err != nil {
+		return fmt.Errorf("failed dropping audit trigger on %s: %w", table.Name, err)
+	}
+
+	arguments := make([]string, len(table.KeyColumns))
+	for i, column := range table.KeyColumns {
+		arguments[i] = pq.QuoteLiteral(column)
+	}
+
+	_, err := tx.Exec(fmt.Sprintf("CREATE TRIGGER %s AFTER INSERT OR UPDATE OR DELETE ON %s FOR EACH ROW EXECUTE FUNCTION %s(%s)",
+		a.triggerName(), name, a.functionName(schema), strings.Join(arguments, ", ")))
+	if err != nil {
+		return fmt.Errorf("failed creating audit trigger on %s: %w", table.Name, err)
+	}
+
+	return nil
+}
+
+// Remove uninstalls the audit trigger from the provided tables, while keeping the recorded history.
+func (a *AuditSvc) Remove(tables ...string) error {
+	for _, table := range tables {
+		err := a.Database.RunGuarded(false, func(db *sql.DB) error {
+			_, err := db.Exec(fmt.Sprintf("DROP TRIGGER IF EXISTS %s ON %s", a.triggerName(), quoteTableName(table)))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed dropping audit trigger on %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// SetActor sets the actor to whom the changes within the transaction are attributed.
+func (a *AuditSvc) SetActor(ctx context.Context, tx *sql.Tx, actor string) error {
+	if _, err := tx.ExecContext(ctx, "SELECT set_config($1, $2, true)", auditActorSetting, actor); err != nil {
+		return fmt.Errorf("failed setting audit actor: %w", err)
+	}
+	return nil
+}
+
+// History returns the recorded changes of the row identified by the key, from oldest to newest.
+// The table may be qualified by its schema; an unqualified table refers to the one in the current schema.
+func (a *AuditSvc) History(ctx context.Context, table string, key map[string]interface{}) ([]*AuditEntry, error) {
+	rowKey, err := json.Marshal(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed encoding row key: %w", err)
+	}
+	schema, name := splitTableName(table)
+	return a.query(ctx, "schema_name = coalesce($1::text, current_schema()) AND table_name = $2 AND row_key @> $3::jsonb",
+		schema, name, string(rowKey))
+}
+
+// Range returns the recorded changes of the table within [from, to), from oldest to newest.
+// The table may be qualified by its schema; an unqualified table refers to the one in the current schema.
+func (a *AuditSvc) Range(ctx context.Context, table string, from, to time.Time) ([]*AuditEntry, error) {
+	schema, name := splitTableName(table)
+	return a.query(ctx, "schema_name = coalesce($1::text, current_schema()) AND table_name = $2 AND changed_at >= $3 AND changed_at < $4",
+		schema, name, from, to)
+}
+
+// quoteTableName quotes the table name, which may be qualified by its schema.
+func quoteTableName(table string) string {
+	if schema, name, ok := strings.Cut(table, "."); ok {
+		return pq.QuoteIdentifier(schema) + "." + pq.QuoteIdentifier(name)
+	}
+	return pq.QuoteIdentifier(table)
+}
+
+// splitTableName splits a table name qualified by its schema; the schema is nil when the name is unqualified.
+func splitTableName(table string) (interface{}, string) {
+	if schema, name, ok := strings.Cut(table, "."); ok {
+		return schema, name
+	}
+	return nil, table
+}
+
+// query retrieves the audit entries which satisfy the condition.
+func (a *AuditSvc) query(ctx context.Context, condition string, args ...interface{}) ([]*AuditEntry, error) {
+	var entries []*AuditEntry
+	err := a.Database.runWithClaims(ctx, true, func(q queryer) error {
+		rows, err := q.QueryContext(ctx, fmt.Sprintf(
+			`SELECT id, schema_name, table_name, operation, row_key, old_row, new_row, actor, changed_at
+			FROM %s WHERE %s ORDER BY changed_at, id`, quoteTableName(a.Table), condition), args...)
+		if err != nil {
+			return fmt.Errorf("failed querying audit entries: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			entry := &AuditEntry{}
+			var rowKey, oldRow, newRow []byte
+			var actor sql.NullString
+			err = rows.Scan(&entry.ID, &entry.Schema, &entry.Table, &entry.Operation, &rowKey, &oldRow, &newRow, &actor, &entry.ChangedAt)
+			if err != nil {
+				return fmt.Errorf("failed scanning audit entry: %w", err)
+			}
+			entry.Key, entry.Old, entry.New, entry.Actor = rowKey, oldRow, newRow, actor.String
+			entries = append(entries, entry)
+		}
+
+		if err = rows.Err(); err != nil {
+			return fmt.Errorf("failed querying audit entries: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
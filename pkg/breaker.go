@@ -0,0 +1,120 @@
+package pkg
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting the database while the circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit open: database unavailable")
+
+// CircuitState represents the state of a circuit breaker.
+type CircuitState int
+
+// The states of a circuit breaker.
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+// String returns the name of the state.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreaker fails fast after consecutive connection failures, and lets a single probe through once cooled down.
+type CircuitBreaker struct {
+	Threshold int
+	Cooldown  time.Duration
+	mu        sync.Mutex
+	state     CircuitState
+	failures  int
+	openedAt  time.Time
+	probing   bool
+}
+
+// NewCircuitBreaker creates a new instance of CircuitBreaker, which opens after threshold consecutive connection failures.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{Threshold: threshold, Cooldown: cooldown}
+}
+
+// State returns the current state of the circuit breaker.
+func (b *CircuitBreaker) State() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == CircuitOpen && time.Since(b.openedAt) >= b.Cooldown {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
+
+// Allow returns ErrCircuitOpen when the call may not go through; once cooled down, a single probe is allowed.
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == CircuitOpen && time.Since(b.openedAt) >= b.Cooldown {
+		b.state = CircuitHalfOpen
+	}
+
+	switch b.state {
+	case CircuitOpen:
+		return ErrCircuitOpen
+	case CircuitHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// Record registers the outcome of a call allowed by Allow, which ends the probe when it was one.
+// Only connection-class failures count; any other outcome proves the database is reachable.
+func (b *CircuitBreaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	b.observe(err)
+}
+
+// Observe registers the outcome of a call which was not allowed by Allow, such as a health check.
+// Unlike Record, it leaves a probe in flight, so no second probe is let through in the meantime.
+func (b *CircuitBreaker) Observe(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.observe(err)
+}
+
+// observe updates the state with the outcome of a call.
+func (b *CircuitBreaker) observe(err error) {
+	if !errors.Is(ClassifyError(err), ErrConnectionLost) {
+		b.state, b.failures = CircuitClosed, 0
+		return
+	}
+
+	b.failures++
+	if b.state == CircuitHalfOpen || b.failures >= b.Threshold {
+		b.state, b.openedAt = CircuitOpen, time.Now()
+	}
+}
+
+// Execute runs fn when the circuit breaker allows it and records its outcome.
+func (b *CircuitBreaker) Execute(fn func() error) error {
+	if err := b.Allow(); err != nil {
+		return err
+	}
+	err := fn()
+	b.Record(err)
+	return err
+}
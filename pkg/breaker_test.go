@@ -0,0 +1,83 @@
+package pkg
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// TestCircuitBreaker tests whether the circuit breaker trips, fails fast, probes and recovers.
+func TestCircuitBreaker(t *testing.T) {
+	breaker := NewCircuitBreaker(2, 10*time.Millisecond)
+	connectionFailure := func() error { return driver.ErrBadConn }
+
+	// Failures other than connection failures do not count
+	_ = breaker.Execute(func() error { return &pq.Error{Code: "23505"} })
+	_ = breaker.Execute(connectionFailure)
+	assert.Equal(t, CircuitClosed, breaker.State())
+
+	// Trip after consecutive connection failures
+	_ = breaker.Execute(connectionFailure)
+	assert.Equal(t, CircuitOpen, breaker.State())
+
+	// Fail fast while open
+	called := false
+	err := breaker.Execute(func() error { called = true; return nil })
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+	assert.False(t, called)
+	assert.True(t, IsTransient(err))
+
+	// A failing probe opens the circuit again
+	time.Sleep(15 * time.Millisecond)
+	assert.Equal(t, CircuitHalfOpen, breaker.State())
+	_ = breaker.Execute(connectionFailure)
+	assert.Equal(t, CircuitOpen, breaker.State())
+
+	// A single probe is allowed through, which closes the circuit when it succeeds
+	time.Sleep(15 * time.Millisecond)
+	assert.Nil(t, breaker.Allow())
+	assert.True(t, errors.Is(breaker.Allow(), ErrCircuitOpen))
+	breaker.Record(nil)
+	assert.Equal(t, CircuitClosed, breaker.State())
+}
+
+// TestCircuitBreakerObserve tests whether observed outcomes, such as health checks, leave a probe in flight.
+func TestCircuitBreakerObserve(t *testing.T) {
+	breaker := NewCircuitBreaker(1, 10*time.Millisecond)
+	breaker.Observe(driver.ErrBadConn)
+	assert.Equal(t, CircuitOpen, breaker.State())
+
+	// A failing health check during the probe does not let a second probe through
+	time.Sleep(15 * time.Millisecond)
+	assert.Nil(t, breaker.Allow())
+	breaker.Observe(driver.ErrBadConn)
+	time.Sleep(15 * time.Millisecond)
+	assert.True(t, errors.Is(breaker.Allow(), ErrCircuitOpen))
+
+	// The probe closes the circuit when it succeeds
+	breaker.Record(nil)
+	assert.Equal(t, CircuitClosed, breaker.State())
+}
+
+// TestIsReadOnly tests whether the replica serves read-only work until the primary is proven again.
+func TestIsReadOnly(t *testing.T) {
+	replica, err := sql.Open("postgres", "postgres://localhost/replica")
+	assert.NoError(t, err)
+	defer replica.Close()
+	dbs := &DbSvc{Breaker: NewCircuitBreaker(1, 10*time.Millisecond), replica: replica}
+	assert.False(t, dbs.IsReadOnly())
+
+	dbs.Breaker.Observe(driver.ErrBadConn)
+	assert.True(t, dbs.IsReadOnly())
+
+	time.Sleep(15 * time.Millisecond)
+	assert.Equal(t, CircuitHalfOpen, dbs.Breaker.State())
+	assert.True(t, dbs.IsReadOnly())
+
+	dbs.Breaker.Observe(nil)
+	assert.False(t, dbs.IsReadOnly())
+}
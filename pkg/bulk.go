@@ -0,0 +1,118 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"strings"
+)
+
+// BulkUpdate sets the set columns of the rows matching the key columns, within a transaction of its own.
+// Each row of the data holds the values of the key columns followed by those of the set columns.
+// It returns the number of updated rows.
+func (d *DbSvc) BulkUpdate(ctx context.Context, table string, keyColumns, setColumns []string, data [][]interface{}) (int, error) {
+	var affected int
+	err := d.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		var err error
+		affected, err = BulkUpdateTx(ctx, tx, table, keyColumns, setColumns, data)
+		return err
+	})
+	return affected, err
+}
+
+// BulkDelete deletes the rows matching the keys, within a transaction of its own.
+// Each key holds the values of the key columns. It returns the number of deleted rows.
+func (d *DbSvc) BulkDelete(ctx context.Context, table string, keyColumns []string, keys [][]interface{}) (int, error) {
+	var affected int
+	err := d.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		var err error
+		affected, err = BulkDeleteTx(ctx, tx, table, keyColumns, keys)
+		return err
+	})
+	return affected, err
+}
+
+// BulkUpdateTx is BulkUpdate within the transaction, which is left for the caller to commit or roll back.
+// The data is copied into a staging table, from which the rows are updated through a single statement.
+func BulkUpdateTx(ctx context.Context, tx *sql.Tx, table string, keyColumns, setColumns []string, data [][]interface{}) (int, error) {
+	if len(setColumns) == 0 {
+		return 0, errors.New("no set columns provided")
+	}
+	for _, column := range setColumns {
+		if contains(keyColumns, column) {
+			return 0, fmt.Errorf("set column %s is one of the key columns", column)
+		}
+	}
+
+	fields := append(append([]string{}, keyColumns...), setColumns...)
+	return bulkApply(ctx, tx, table, fields, keyColumns, data, "update", func(staging string) string {
+		return bulkUpdateQuery(table, staging, keyColumns, setColumns)
+	})
+}
+
+// BulkDeleteTx is BulkDelete within the transaction, which is left for the caller to commit or roll back.
+// The keys are copied into a staging table, from which the rows are deleted through a single statement.
+func BulkDeleteTx(ctx context.Context, tx *sql.Tx, table string, keyColumns []string, keys [][]interface{}) (int, error) {
+	return bulkApply(ctx, tx, table, keyColumns, keyColumns, keys, "delete", func(staging string) string {
+		return bulkDeleteQuery(table, staging, keyColumns)
+	})
+}
+
+// bulkApply copies the data into a staging table, checks it holds every key once, and executes the query built for it.
+// The staging table is dropped afterwards, so a transaction can hold several bulk operations.
+func bulkApply(ctx context.Context, tx *sql.Tx, table string, fields, keyColumns []string, data [][]interface{}, action string,
+	query func(staging string) string) (int, error) {
+	if err := validateKeyColumns(fields, keyColumns); err != nil {
+		return 0, err
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	staging := stagingTableName(table, "bulk")
+	if err := createStagingTable(ctx, tx, staging, table, fields); err != nil {
+		return 0, err
+	}
+
+	config := newImportConfig(nil)
+	result := &ImportResult{Table: table}
+	if err := newImporter(tx, staging, fields, config, result).run(ctx, newSliceSource(data)); err != nil {
+		return 0, err
+	}
+	if err := checkKeys(ctx, tx, staging, keyColumns); err != nil {
+		return 0, err
+	}
+
+	changed, err := tx.ExecContext(ctx, query(staging))
+	if err != nil {
+		return 0, fmt.Errorf("failed to %s rows: %w", action, ClassifyError(err))
+	}
+	affected, err := changed.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to %s rows: %w", action, ClassifyError(err))
+	}
+
+	if _, err = tx.ExecContext(ctx, fmt.Sprintf("DROP TABLE %s", pq.QuoteIdentifier(staging))); err != nil {
+		return 0, fmt.Errorf("failed dropping staging table: %w", ClassifyError(err))
+	}
+	return int(affected), nil
+}
+
+// bulkUpdateQuery sets the set columns of the rows of the table matching the keys in the staging table.
+func bulkUpdateQuery(table, staging string, keyColumns, setColumns []string) string {
+	assignments := make([]string, len(setColumns))
+	for i, column := range setColumns {
+		quoted := pq.QuoteIdentifier(column)
+		assignments[i] = fmt.Sprintf("%s = s.%s", quoted, quoted)
+	}
+	return fmt.Sprintf("UPDATE %s t SET %s FROM %s s WHERE %s", quoteTableName(table), strings.Join(assignments, ", "),
+		pq.QuoteIdentifier(staging), keyCondition("t", "s", keyColumns))
+}
+
+// bulkDeleteQuery deletes the rows of the table matching the keys in the staging table.
+func bulkDeleteQuery(table, staging string, keyColumns []string) string {
+	return fmt.Sprintf("DELETE FROM %s t USING %s s WHERE %s", quoteTableName(table), pq.QuoteIdentifier(staging),
+		keyCondition("t", "s", keyColumns))
+}
@@ -0,0 +1,16 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// TestBulkQueries tests whether bulk updates and deletes match the rows on the key columns.
+func TestBulkQueries(t *testing.T) {
+	assert.Equal(t, `UPDATE "contacts" t SET "name" = s."name", "phone" = s."phone" FROM "contacts_bulk" s `+
+		`WHERE t."id" = s."id"`, bulkUpdateQuery("contacts", "contacts_bulk", []string{"id"}, []string{"name", "phone"}))
+	assert.Equal(t, `DELETE FROM "contacts" t USING "contacts_bulk" s WHERE t."id" = s."id" AND t."name" = s."name"`,
+		bulkDeleteQuery("contacts", "contacts_bulk", []string{"id", "name"}))
+	assert.Equal(t, `DELETE FROM "crm"."contacts" t USING "contacts_bulk" s WHERE t."id" = s."id"`,
+		bulkDeleteQuery("crm.contacts", "contacts_bulk", []string{"id"}))
+}
@@ -0,0 +1,300 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"strings"
+)
+
+// secondaryIndexesQuery retrieves the indexes of the table which back neither the primary key nor any constraint.
+const secondaryIndexesQuery = `SELECT n.nspname, i.relname, pg_get_indexdef(x.indexrelid), x.indisunique
+	FROM pg_index x
+	JOIN pg_class i ON i.oid = x.indexrelid
+	JOIN pg_namespace n ON n.oid = i.relnamespace
+	WHERE x.indrelid = $1::regclass AND NOT x.indisprimary
+	AND NOT EXISTS (SELECT 1 FROM pg_constraint c WHERE c.conindid = x.indexrelid)
+	ORDER BY i.relname`
+
+// userTriggersQuery retrieves the triggers of the table which do not enforce constraints.
+const userTriggersQuery = `SELECT tgname, pg_get_triggerdef(oid)
+	FROM pg_trigger
+	WHERE tgrelid = $1::regclass AND NOT tgisinternal
+	ORDER BY tgname`
+
+// createDroppedIndexesTableQuery creates the table holding the definitions of indexes dropped for a load until they are
+// rebuilt, so they survive a failing rebuild. It is created ahead of the load rather than within its transaction.
+const createDroppedIndexesTableQuery = `CREATE TABLE IF NOT EXISTS dropped_indexes (
+		index_name text PRIMARY KEY,
+		table_name text NOT NULL,
+		definition text NOT NULL,
+		dropped_at timestamptz NOT NULL DEFAULT now()
+	)`
+
+// saveDroppedIndexQuery records the definition of a dropped index.
+const saveDroppedIndexQuery = `INSERT INTO dropped_indexes (index_name, table_name, definition) VALUES ($1, $2, $3)
+	ON CONFLICT (index_name) DO UPDATE SET table_name = EXCLUDED.table_name, definition = EXCLUDED.definition, dropped_at = now()`
+
+// WithIndexesDropped drops the secondary indexes of the table before loading and recreates them afterwards.
+// Unique indexes are recreated within the transaction, so violations roll back the import; the others are recreated
+// concurrently once committed. Indexes backing constraints, such as the primary key, are kept.
+// The definitions of the concurrently recreated ones are kept in the dropped_indexes table until rebuilt; should rebuilding fail, they can be
+// rebuilt through RestoreDroppedIndexes.
+// Dropping an index locks the table in ACCESS EXCLUSIVE mode until the load commits, so others can neither read nor write
+// the table for the whole duration of the load.
+func WithIndexesDropped() ImportOption {
+	return func(c *ImportConfig) {
+		c.DropIndexes = true
+	}
+}
+
+// WithTriggersDropped drops the triggers of the table, except those to keep, before loading and recreates them afterwards.
+// Triggers enforcing constraints, such as foreign keys, are kept.
+func WithTriggersDropped(keep ...string) ImportOption {
+	return func(c *ImportConfig) {
+		c.DropTriggers = true
+		c.KeptTriggers = keep
+	}
+}
+
+// droppedIndex represents an index dropped for the duration of a load.
+type droppedIndex struct {
+	name       string
+	definition string
+	isUnique   bool
+}
+
+// droppedTrigger represents a trigger dropped for the duration of a load.
+type droppedTrigger struct {
+	name       string
+	definition string
+}
+
+// bulkLoad holds the indexes and triggers of a table dropped for the duration of a load.
+type bulkLoad struct {
+	table    string
+	indexes  []*droppedIndex
+	triggers []*droppedTrigger
+}
+
+// prepareBulkLoad captures and drops the indexes and triggers of the table as configured.
+// As it happens within the transaction, a failing load restores them through the rollback.
+func prepareBulkLoad(ctx context.Context, tx *sql.Tx, table string, config *ImportConfig) (*bulkLoad, error) {
+	if !config.DropIndexes && !config.DropTriggers {
+		return nil, nil
+	}
+
+	load := &bulkLoad{table: quoteTableName(table)}
+	if config.DropIndexes {
+		if err := load.dropIndexes(ctx, tx); err != nil {
+			return nil, err
+		}
+	}
+	if config.DropTriggers {
+		if err := load.dropTriggers(ctx, tx, config.KeptTriggers); err != nil {
+			return nil, err
+		}
+	}
+	return load, nil
+}
+
+// dropIndexes captures the definitions of the secondary indexes and drops them.
+func (b *bulkLoad) dropIndexes(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, secondaryIndexesQuery, b.table)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve indexes: %w", ClassifyError(err))
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var schema, name string
+		index := &droppedIndex{}
+		if err = rows.Scan(&schema, &name, &index.definition, &index.isUnique); err != nil {
+			return fmt.Errorf("failed to retrieve indexes: %w", ClassifyError(err))
+		}
+		index.name = fmt.Sprintf("%s.%s", pq.QuoteIdentifier(schema), pq.QuoteIdentifier(name))
+		b.indexes = append(b.indexes, index)
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("failed to retrieve indexes: %w", ClassifyError(err))
+	}
+	rows.Close()
+
+	for _, index := range b.indexes {
+		if !index.isUnique {
+			if err = saveDroppedIndex(ctx, tx, b.table, index); err != nil {
+				return err
+			}
+		}
+		if _, err = tx.ExecContext(ctx, fmt.Sprintf("DROP INDEX %s", index.name)); err != nil {
+			return fmt.Errorf("failed to drop index %s: %w", index.name, ClassifyError(err))
+		}
+	}
+	return nil
+}
+
+// saveDroppedIndex records the definition of the index within the transaction dropping it.
+func saveDroppedIndex(ctx context.Context, tx *sql.Tx, table string, index *droppedIndex) error {
+	if _, err := tx.ExecContext(ctx, saveDroppedIndexQuery, index.name, table, index.definition); err != nil {
+		return fmt.Errorf("failed to record index %s: %w", index.name, ClassifyError(err))
+	}
+	return nil
+}
+
+// dropTriggers captures the definitions of the triggers, other than those to keep, and drops them.
+func (b *bulkLoad) dropTriggers(ctx context.Context, tx *sql.Tx, keep []string) error {
+	rows, err := tx.QueryContext(ctx, userTriggersQuery, b.table)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve triggers: %w", ClassifyError(err))
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		trigger := &droppedTrigger{}
+		if err = rows.Scan(&trigger.name, &trigger.definition); err != nil {
+			return fmt.Errorf("failed to retrieve triggers: %w", ClassifyError(err))
+		}
+		if !contains(keep, trigger.name) {
+			b.triggers = append(b.triggers, trigger)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("failed to retrieve triggers: %w", ClassifyError(err))
+	}
+	rows.Close()
+
+	for _, trigger := range b.triggers {
+		if _, err = tx.ExecContext(ctx, fmt.Sprintf("DROP TRIGGER %s ON %s", pq.QuoteIdentifier(trigger.name), b.table)); err != nil {
+			return fmt.Errorf("failed to drop trigger %s: %w", trigger.name, ClassifyError(err))
+		}
+	}
+	return nil
+}
+
+// restore recreates the triggers and unique indexes within the transaction, so the load is rolled back when they fail.
+func (b *bulkLoad) restore(ctx context.Context, tx *sql.Tx) error {
+	if b == nil {
+		return nil
+	}
+
+	for _, trigger := range b.triggers {
+		if _, err := tx.ExecContext(ctx, trigger.definition); err != nil {
+			return fmt.Errorf("failed to recreate trigger %s: %w", trigger.name, ClassifyError(err))
+		}
+	}
+
+	for _, index := range b.indexes {
+		if !index.isUnique {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, index.definition); err != nil {
+			return fmt.Errorf("failed to recreate index %s: %w", index.name, ClassifyError(err))
+		}
+	}
+	return nil
+}
+
+// finish recreates the remaining indexes concurrently once the load has been committed, and analyzes the table.
+// Indexes which fail to be recreated remain recorded in the dropped_indexes table.
+func (b *bulkLoad) finish(ctx context.Context, db *sql.DB) error {
+	if b == nil {
+		return nil
+	}
+
+	var errs []error
+	for _, index := range b.indexes {
+		if index.isUnique {
+			continue
+		}
+		if err := rebuildIndex(ctx, db, index); err != nil {
+			errs = append(errs, fmt.Errorf("%w; it can be restored through RestoreDroppedIndexes", err))
+		}
+	}
+
+	if _, err := db.ExecContext(ctx, fmt.Sprintf("ANALYZE %s", b.table)); err != nil {
+		errs = append(errs, fmt.Errorf("failed to analyze %s: %w", b.table, ClassifyError(err)))
+	}
+	return errors.Join(errs...)
+}
+
+// rebuildIndex recreates the index concurrently, or regularly when it cannot be built concurrently, and removes its
+// definition from the dropped_indexes table. An index which exists again is left as is.
+func rebuildIndex(ctx context.Context, db *sql.DB, index *droppedIndex) error {
+	var exists bool
+	if err := db.QueryRowContext(ctx, "SELECT to_regclass($1) IS NOT NULL", index.name).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to recreate index %s: %w", index.name, ClassifyError(err))
+	}
+
+	if !exists {
+		concurrently := strings.Replace(index.definition, "CREATE INDEX ", "CREATE INDEX CONCURRENTLY ", 1)
+		if _, err := db.ExecContext(ctx, concurrently); err != nil {
+			// A failed concurrent build leaves an invalid index behind
+			_, err = db.ExecContext(ctx, fmt.Sprintf("DROP INDEX IF EXISTS %s", index.name))
+			if err == nil {
+				_, err = db.ExecContext(ctx, index.definition)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to recreate index %s, defined as %q: %w", index.name, index.definition, ClassifyError(err))
+			}
+		}
+	}
+
+	if _, err := db.ExecContext(ctx, "DELETE FROM dropped_indexes WHERE index_name = $1", index.name); err != nil {
+		return fmt.Errorf("failed to clear record of index %s: %w", index.name, ClassifyError(err))
+	}
+	return nil
+}
+
+// createDroppedIndexesTable creates the dropped_indexes table ahead of a load, as creating it within the transactions of
+// concurrent first loads would have them collide on the catalog.
+func (d *DbSvc) createDroppedIndexesTable(ctx context.Context) error {
+	return d.RunGuarded(false, func(db *sql.DB) error {
+		if err := createTableLocked(ctx, db, createDroppedIndexesTableQuery); err != nil {
+			return fmt.Errorf("failed to create dropped indexes table: %w", ClassifyError(err))
+		}
+		return nil
+	})
+}
+
+// RestoreDroppedIndexes recreates the indexes which were dropped for a load but failed to be recreated afterwards,
+// and returns the names of those recreated.
+func (d *DbSvc) RestoreDroppedIndexes(ctx context.Context) ([]string, error) {
+	var restored []string
+	err := d.RunGuarded(false, func(db *sql.DB) error {
+		if err := createTableLocked(ctx, db, createDroppedIndexesTableQuery); err != nil {
+			return fmt.Errorf("failed to create dropped indexes table: %w", ClassifyError(err))
+		}
+
+		rows, err := db.QueryContext(ctx, "SELECT index_name, definition FROM dropped_indexes ORDER BY dropped_at")
+		if err != nil {
+			return fmt.Errorf("failed to retrieve dropped indexes: %w", ClassifyError(err))
+		}
+		defer rows.Close()
+
+		var indexes []*droppedIndex
+		for rows.Next() {
+			index := &droppedIndex{}
+			if err = rows.Scan(&index.name, &index.definition); err != nil {
+				return fmt.Errorf("failed to retrieve dropped indexes: %w", ClassifyError(err))
+			}
+			indexes = append(indexes, index)
+		}
+		if err = rows.Err(); err != nil {
+			return fmt.Errorf("failed to retrieve dropped indexes: %w", ClassifyError(err))
+		}
+		rows.Close()
+
+		var errs []error
+		for _, index := range indexes {
+			if err = rebuildIndex(ctx, db, index); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			restored = append(restored, index.name)
+		}
+		return errors.Join(errs...)
+	})
+	return restored, err
+}
@@ -0,0 +1,518 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The kinds of row changes delivered by a change stream.
+const (
+	ChangeInsert = "insert"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+)
+
+// errTruncatedMessage is returned when a pgoutput message ends before all of its fields have been read.
+var errTruncatedMessage = errors.New("truncated pgoutput message")
+
+// postgresEpoch is the moment from which pgoutput counts timestamps, in microseconds.
+var postgresEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// peekChangesQuery retrieves the changes of the slot, as pgoutput messages, without consuming them.
+const peekChangesQuery = `SELECT lsn::text, data FROM pg_logical_slot_peek_binary_changes($1, NULL, $2,
+	'proto_version', '1', 'publication_names', $3)`
+
+// ChangeEvent represents a row inserted, updated or deleted. Before holds the replica identity of the row, usually its
+// primary key, for deletes and for updates changing it; it only holds the columns of the replica identity, unless
+// REPLICA IDENTITY FULL makes it hold every column.
+// Values of unchanged TOASTed columns are not sent by Postgres, and are missing from After.
+type ChangeEvent struct {
+	Kind   string
+	Schema string
+	Table  string
+	Before map[string]interface{}
+	After  map[string]interface{}
+	LSN    string
+}
+
+// ChangeTransaction represents the changes of a committed transaction, in the order they were made.
+type ChangeTransaction struct {
+	XID        uint32
+	CommitLSN  string
+	CommitTime time.Time
+	Events     []*ChangeEvent
+}
+
+// ChangeHandler handles the changes of a transaction; the transaction is delivered again until it succeeds.
+type ChangeHandler func(ctx context.Context, transaction *ChangeTransaction) error
+
+// ChangeStreamSvcOption is used to instantiate a ChangeStreamSvc with the provided settings/configurations/actions.
+type ChangeStreamSvcOption func(*ChangeStreamSvc)
+
+// ChangeStreamOps represents operations related to consuming row changes through logical replication.
+type ChangeStreamOps interface {
+	CreateChangeStream(ctx context.Context) error
+	DropChangeStream(ctx context.Context) error
+	Consume(ctx context.Context) (int, error)
+	StartStream()
+	StopStream()
+}
+
+// ChangeStreamSvc delivers the row changes of the published tables to a ChangeHandler, transaction by transaction.
+// It decodes the pgoutput messages of a logical replication slot, which requires the server to run with wal_level=logical.
+// The slot is only advanced past a transaction once the handler succeeds, so every transaction is delivered at least once.
+// As lib/pq does not speak the replication protocol, changes are not pushed by the server, but peeked from the slot every
+// Interval while there are none.
+type ChangeStreamSvc struct {
+	Database        *DbSvc
+	Handler         ChangeHandler
+	Slot            string
+	Publication     string
+	Tables          []string
+	BatchSize       int
+	Interval        time.Duration
+	IsStreamEnabled bool
+	relations       map[uint32]*changeRelation
+}
+
+// NewChangeStreamSvc creates a new instance of ChangeStreamSvc, which streams the changes of the tables through the slot.
+// The tables may be qualified by their schema. Without tables, the changes of all tables are streamed.
+func NewChangeStreamSvc(database *DbSvc, handler ChangeHandler, slot string, tables []string, options ...ChangeStreamSvcOption) *ChangeStreamSvc {
+	stream := &ChangeStreamSvc{
+		Database:    database,
+		Handler:     handler,
+		Slot:        slot,
+		Publication: slot,
+		Tables:      tables,
+		BatchSize:   1000,
+		Interval:    time.Second,
+		relations:   map[uint32]*changeRelation{},
+	}
+	for _, option := range options {
+		option(stream)
+	}
+	return stream
+}
+
+// WithChangePublication sets the name of the publication, which defaults to the name of the slot.
+func WithChangePublication(publication string) ChangeStreamSvcOption {
+	return func(c *ChangeStreamSvc) {
+		c.Publication = publication
+	}
+}
+
+// WithChangeBatchSize sets the number of changes after which a round stops reading, once its transaction is complete.
+func WithChangeBatchSize(size int) ChangeStreamSvcOption {
+	return func(c *ChangeStreamSvc) {
+		c.BatchSize = size
+	}
+}
+
+// WithChangeInterval sets the time the stream waits when there are no changes to deliver.
+func WithChangeInterval(interval time.Duration) ChangeStreamSvcOption {
+	return func(c *ChangeStreamSvc) {
+		c.Interval = interval
+	}
+}
+
+// CreateChangeStream creates the publication and the replication slot, if they do not exist yet.
+// Changes are retained by the slot from then on, until they have been consumed.
+func (c *ChangeStreamSvc) CreateChangeStream(ctx context.Context) error {
+	return c.Database.RunGuarded(false, func(db *sql.DB) error {
+		var exists bool
+		err := db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_publication WHERE pubname = $1)", c.Publication).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed retrieving publication: %w", ClassifyError(err))
+		}
+		if !exists {
+			tables := "ALL TABLES"
+			if len(c.Tables) > 0 {
+				quoted := make([]string, len(c.Tables))
+				for i, table := range c.Tables {
+					quoted[i] = quoteTableName(table)
+				}
+				tables = "TABLE " + strings.Join(quoted, ", ")
+			}
+			_, err = db.ExecContext(ctx, fmt.Sprintf("CREATE PUBLICATION %s FOR %s", pq.QuoteIdentifier(c.Publication), tables))
+			if err != nil {
+				return fmt.Errorf("failed creating publication: %w", ClassifyError(err))
+			}
+		}
+
+		err = db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_replication_slots WHERE slot_name = $1)", c.Slot).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed retrieving replication slot: %w", ClassifyError(err))
+		}
+		if !exists {
+			_, err = db.ExecContext(ctx, "SELECT pg_create_logical_replication_slot($1, 'pgoutput')", c.Slot)
+			if err != nil {
+				return fmt.Errorf("failed creating replication slot: %w", ClassifyError(err))
+			}
+		}
+		return nil
+	})
+}
+
+// DropChangeStream drops the replication slot and the publication, so the server no longer retains changes for them.
+func (c *ChangeStreamSvc) DropChangeStream(ctx context.Context) error {
+	return c.Database.RunGuarded(false, func(db *sql.DB) error {
+		_, err := db.ExecContext(ctx,
+			"SELECT pg_drop_replication_slot(slot_name) FROM pg_replication_slots WHERE slot_name = $1", c.Slot)
+		if err != nil {
+			return fmt.Errorf("failed dropping replication slot: %w", ClassifyError(err))
+		}
+
+		_, err = db.ExecContext(ctx, fmt.Sprintf("DROP PUBLICATION IF EXISTS %s", pq.QuoteIdentifier(c.Publication)))
+		if err != nil {
+			return fmt.Errorf("failed dropping publication: %w", ClassifyError(err))
+		}
+		return nil
+	})
+}
+
+// Consume delivers the pending transactions to the handler and returns the number of delivered transactions.
+// It stops at the first transaction the handler fails, after which the slot is advanced past the last one handled
+// successfully; advancing once per round spares the server decoding the changes again for every transaction.
+func (c *ChangeStreamSvc) Consume(ctx context.Context) (int, error) {
+	messages, err := c.peekChanges(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	var confirmed string
+	var transaction *ChangeTransaction
+	for _, message := range messages {
+		var isCommitted bool
+		transaction, isCommitted, err = c.decode(message, transaction)
+		if err != nil {
+			err = fmt.Errorf("failed decoding change at %s: %w", message.lsn, err)
+			break
+		}
+		if !isCommitted {
+			continue
+		}
+
+		if len(transaction.Events) > 0 {
+			if err = c.Handler(ctx, transaction); err != nil {
+				err = fmt.Errorf("failed handling transaction %d: %w", transaction.XID, err)
+				break
+			}
+			delivered++
+		}
+		confirmed = message.lsn
+		transaction = nil
+	}
+
+	if confirmed != "" {
+		if advanceErr := c.advance(ctx, confirmed); advanceErr != nil {
+			return delivered, errors.Join(err, advanceErr)
+		}
+	}
+	return delivered, err
+}
+
+// advance advances the slot past the changes up to the LSN, so they are no longer retained nor delivered.
+func (c *ChangeStreamSvc) advance(ctx context.Context, lsn string) error {
+	err := c.Database.RunGuarded(false, func(db *sql.DB) error {
+		_, err := db.ExecContext(ctx, "SELECT pg_replication_slot_advance($1, $2::pg_lsn)", c.Slot, lsn)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed confirming %s: %w", lsn, ClassifyError(err))
+	}
+	return nil
+}
+
+// changeMessage represents a pgoutput message peeked from the slot.
+type changeMessage struct {
+	lsn  string
+	data []byte
+}
+
+// peekChanges retrieves the pending messages of the slot. They are read entirely before being handled, as the slot
+// cannot be advanced while being read.
+func (c *ChangeStreamSvc) peekChanges(ctx context.Context) ([]*changeMessage, error) {
+	var messages []*changeMessage
+	err := c.Database.RunGuarded(false, func(db *sql.DB) error {
+		rows, err := db.QueryContext(ctx, peekChangesQuery, c.Slot, c.BatchSize, c.Publication)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			message := &changeMessage{}
+			if err = rows.Scan(&message.lsn, &message.data); err != nil {
+				return err
+			}
+			messages = append(messages, message)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed retrieving changes: %w", ClassifyError(err))
+	}
+	return messages, nil
+}
+
+// changeRelation describes a published table, as announced by a relation message.
+type changeRelation struct {
+	schema  string
+	table   string
+	columns []*changeColumn
+}
+
+// changeColumn describes a column of a published table.
+type changeColumn struct {
+	name    string
+	typeOID uint32
+	isKey   bool
+}
+
+// decode applies the message to the transaction being received, and reports whether the message committed it.
+func (c *ChangeStreamSvc) decode(message *changeMessage, transaction *ChangeTransaction) (*ChangeTransaction, bool, error) {
+	reader := &pgoutputReader{data: message.data}
+	kind := reader.byte()
+	switch kind {
+	case 'B':
+		reader.uint64() // final LSN
+		commitTime := reader.timestamp()
+		transaction = &ChangeTransaction{CommitTime: commitTime, XID: reader.uint32()}
+	case 'C':
+		reader.byte()   // flags
+		reader.uint64() // commit LSN
+		reader.uint64() // end LSN
+		if transaction == nil {
+			return nil, false, errors.New("commit without a transaction")
+		}
+		transaction.CommitTime = reader.timestamp()
+		transaction.CommitLSN = message.lsn
+		return transaction, reader.err == nil, reader.err
+	case 'R':
+		c.decodeRelation(reader)
+	case 'I', 'U', 'D':
+		if transaction == nil {
+			return nil, false, fmt.Errorf("change %q without a transaction", kind)
+		}
+		event, err := c.decodeChange(kind, reader)
+		if err != nil {
+			return nil, false, err
+		}
+		event.LSN = message.lsn
+		transaction.Events = append(transaction.Events, event)
+	case 'O', 'Y', 'T':
+		// Origins, types and truncations carry no row changes
+	default:
+		return nil, false, fmt.Errorf("unknown message type %q", kind)
+	}
+	return transaction, false, reader.err
+}
+
+// decodeRelation registers the relation described by the message.
+func (c *ChangeStreamSvc) decodeRelation(reader *pgoutputReader) {
+	id := reader.uint32()
+	relation := &changeRelation{schema: reader.string(), table: reader.string()}
+	reader.byte() // replica identity
+	columns := int(reader.uint16())
+	for i := 0; i < columns && reader.err == nil; i++ {
+		flags := reader.byte()
+		column := &changeColumn{isKey: flags&1 != 0, name: reader.string(), typeOID: reader.uint32()}
+		reader.uint32() // type modifier
+		relation.columns = append(relation.columns, column)
+	}
+	if reader.err == nil {
+		c.relations[id] = relation
+	}
+}
+
+// decodeChange decodes an insert, update or delete message into an event.
+func (c *ChangeStreamSvc) decodeChange(kind byte, reader *pgoutputReader) (*ChangeEvent, error) {
+	id := reader.uint32()
+	relation, ok := c.relations[id]
+	if !ok && reader.err == nil {
+		return nil, fmt.Errorf("change of unknown relation %d", id)
+	}
+
+	event := &ChangeEvent{}
+	switch kind {
+	case 'I':
+		event.Kind = ChangeInsert
+	case 'U':
+		event.Kind = ChangeUpdate
+	case 'D':
+		event.Kind = ChangeDelete
+	}
+	if relation != nil {
+		event.Schema, event.Table = relation.schema, relation.table
+	}
+
+	for reader.err == nil && reader.pos < len(reader.data) {
+		switch tuple := reader.byte(); tuple {
+		case 'K':
+			event.Before = reader.tuple(relation, true)
+		case 'O':
+			event.Before = reader.tuple(relation, false)
+		case 'N':
+			event.After = reader.tuple(relation, false)
+		default:
+			return nil, fmt.Errorf("unknown tuple type %q", tuple)
+		}
+	}
+	return event, reader.err
+}
+
+// pgoutputReader reads the fields of a pgoutput message, remembering the first error.
+type pgoutputReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+// next returns the following n bytes, or nil when the message holds fewer.
+func (r *pgoutputReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.pos+n > len(r.data) {
+		r.err = errTruncatedMessage
+		return nil
+	}
+	bytes := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return bytes
+}
+
+// byte reads a byte.
+func (r *pgoutputReader) byte() byte {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+// uint16 reads a 16-bit integer.
+func (r *pgoutputReader) uint16() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+// uint32 reads a 32-bit integer.
+func (r *pgoutputReader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+// uint64 reads a 64-bit integer.
+func (r *pgoutputReader) uint64() uint64 {
+	if b := r.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+// timestamp reads a timestamp, in microseconds since the Postgres epoch.
+func (r *pgoutputReader) timestamp() time.Time {
+	return postgresEpoch.Add(time.Duration(int64(r.uint64())) * time.Microsecond)
+}
+
+// string reads a null-terminated string.
+func (r *pgoutputReader) string() string {
+	if r.err != nil {
+		return ""
+	}
+	for i := r.pos; i < len(r.data); i++ {
+		if r.data[i] == 0 {
+			s := string(r.data[r.pos:i])
+			r.pos = i + 1
+			return s
+		}
+	}
+	r.err = errTruncatedMessage
+	return ""
+}
+
+// tuple reads the column values of a row, keyed by the names of the columns of the relation.
+// Unchanged TOASTed values are left out, as are the columns outside the replica identity when keyOnly is set, as those
+// are sent as null.
+func (r *pgoutputReader) tuple(relation *changeRelation, keyOnly bool) map[string]interface{} {
+	columns := int(r.uint16())
+	values := make(map[string]interface{}, columns)
+	for i := 0; i < columns && r.err == nil; i++ {
+		column := &changeColumn{name: strconv.Itoa(i), isKey: true}
+		if relation != nil && i < len(relation.columns) {
+			column = relation.columns[i]
+		}
+
+		var value interface{}
+		switch kind := r.byte(); kind {
+		case 'n':
+		case 'u':
+			continue
+		case 't':
+			text := string(r.next(int(r.uint32())))
+			value = decodeChangeValue(column.typeOID, text)
+		default:
+			if r.err == nil {
+				r.err = fmt.Errorf("unknown column value type %q", kind)
+			}
+			continue
+		}
+		if !keyOnly || column.isKey {
+			values[column.name] = value
+		}
+	}
+	return values
+}
+
+// decodeChangeValue converts the text of a value into a boolean, integer or float according to its type,
+// and leaves the values of other types as text.
+func decodeChangeValue(typeOID uint32, text string) interface{} {
+	switch typeOID {
+	case 16: // bool
+		return text == "t"
+	case 20, 21, 23: // int8, int2, int4
+		if value, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return value
+		}
+	case 700, 701: // float4, float8
+		if value, err := strconv.ParseFloat(text, 64); err == nil {
+			return value
+		}
+	}
+	return text
+}
+
+// StartStream continuously delivers changes to the handler until the stream is stopped.
+func (c *ChangeStreamSvc) StartStream() {
+	c.IsStreamEnabled = true
+	for {
+		if !c.IsStreamEnabled {
+			break
+		}
+		delivered, err := c.Consume(context.Background())
+		if err != nil {
+			log.Printf("Failed to consume changes: %s", err.Error())
+		}
+		if delivered == 0 {
+			time.Sleep(c.Interval)
+		}
+	}
+}
+
+// StopStream disables the stream.
+func (c *ChangeStreamSvc) StopStream() {
+	c.IsStreamEnabled = false
+}
@@ -0,0 +1,110 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// pgoutputMessage builds a pgoutput message from bytes, integers, strings (null-terminated) and raw byte slices.
+func pgoutputMessage(fields ...interface{}) *changeMessage {
+	var buffer bytes.Buffer
+	for _, field := range fields {
+		switch f := field.(type) {
+		case string:
+			buffer.WriteString(f)
+			buffer.WriteByte(0)
+		case []byte:
+			buffer.Write(f)
+		default:
+			_ = binary.Write(&buffer, binary.BigEndian, f)
+		}
+	}
+	return &changeMessage{lsn: "0/1", data: buffer.Bytes()}
+}
+
+// TestDecodingChanges tests whether pgoutput messages are decoded into the events of a transaction.
+func TestDecodingChanges(t *testing.T) {
+	stream := NewChangeStreamSvc(nil, nil, "slot", nil)
+	commitTime := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	micros := commitTime.Sub(postgresEpoch).Microseconds()
+
+	messages := []*changeMessage{
+		pgoutputMessage(byte('B'), uint64(100), micros, uint32(7)),
+		pgoutputMessage(byte('R'), uint32(1), "public", "contacts", byte('d'), uint16(3),
+			byte(1), "id", uint32(23), int32(-1),
+			byte(0), "name", uint32(25), int32(-1),
+			byte(0), "active", uint32(16), int32(-1)),
+		pgoutputMessage(byte('I'), uint32(1), byte('N'), uint16(3),
+			byte('t'), uint32(1), []byte("1"), byte('t'), uint32(4), []byte("John"), byte('n')),
+		pgoutputMessage(byte('U'), uint32(1), byte('K'), uint16(3), byte('t'), uint32(1), []byte("1"), byte('n'), byte('n'),
+			byte('N'), uint16(3), byte('t'), uint32(1), []byte("2"), byte('u'), byte('t'), uint32(1), []byte("t")),
+		pgoutputMessage(byte('D'), uint32(1), byte('K'), uint16(3), byte('t'), uint32(1), []byte("2"), byte('n'), byte('n')),
+		pgoutputMessage(byte('D'), uint32(1), byte('O'), uint16(3), byte('t'), uint32(1), []byte("3"), byte('n'), byte('n')),
+	}
+
+	var transaction *ChangeTransaction
+	for _, message := range messages {
+		var isCommitted bool
+		var err error
+		transaction, isCommitted, err = stream.decode(message, transaction)
+		assert.NoError(t, err)
+		assert.False(t, isCommitted)
+	}
+
+	commit := pgoutputMessage(byte('C'), byte(0), uint64(100), uint64(120), micros)
+	commit.lsn = "0/78"
+	transaction, isCommitted, err := stream.decode(commit, transaction)
+	assert.NoError(t, err)
+	assert.True(t, isCommitted)
+
+	assert.Equal(t, uint32(7), transaction.XID)
+	assert.Equal(t, "0/78", transaction.CommitLSN)
+	assert.True(t, commitTime.Equal(transaction.CommitTime))
+	assert.Len(t, transaction.Events, 4)
+
+	insert, update, deletion, fullDeletion := transaction.Events[0], transaction.Events[1], transaction.Events[2], transaction.Events[3]
+	assert.Equal(t, ChangeInsert, insert.Kind)
+	assert.Equal(t, "contacts", insert.Table)
+	assert.Nil(t, insert.Before)
+	assert.Equal(t, map[string]interface{}{"id": int64(1), "name": "John", "active": nil}, insert.After)
+
+	assert.Equal(t, ChangeUpdate, update.Kind)
+	assert.Equal(t, map[string]interface{}{"id": int64(1)}, update.Before)
+	assert.Equal(t, map[string]interface{}{"id": int64(2), "active": true}, update.After)
+
+	assert.Equal(t, ChangeDelete, deletion.Kind)
+	assert.Equal(t, map[string]interface{}{"id": int64(2)}, deletion.Before)
+	assert.Nil(t, deletion.After)
+
+	// With REPLICA IDENTITY FULL, every column is sent
+	assert.Equal(t, map[string]interface{}{"id": int64(3), "name": nil, "active": nil}, fullDeletion.Before)
+}
+
+// TestDecodingInvalidChanges tests whether truncated and unexpected messages are refused.
+func TestDecodingInvalidChanges(t *testing.T) {
+	stream := NewChangeStreamSvc(nil, nil, "slot", nil)
+
+	_, _, err := stream.decode(pgoutputMessage(byte('B'), uint32(1)), nil)
+	assert.ErrorIs(t, err, errTruncatedMessage)
+
+	_, _, err = stream.decode(pgoutputMessage(byte('I'), uint32(1)), &ChangeTransaction{})
+	assert.Error(t, err)
+
+	_, _, err = stream.decode(pgoutputMessage(byte('I'), uint32(1)), nil)
+	assert.Error(t, err)
+
+	_, _, err = stream.decode(pgoutputMessage(byte('Z')), nil)
+	assert.Error(t, err)
+}
+
+// TestDecodeChangeValue tests whether values are converted according to their type.
+func TestDecodeChangeValue(t *testing.T) {
+	assert.Equal(t, true, decodeChangeValue(16, "t"))
+	assert.Equal(t, int64(-42), decodeChangeValue(20, "-42"))
+	assert.Equal(t, 1.5, decodeChangeValue(701, "1.5"))
+	assert.Equal(t, "12.50", decodeChangeValue(1700, "12.50"))
+	assert.Equal(t, "x", decodeChangeValue(23, "x"))
+}
@@ -0,0 +1,382 @@
+package pkg
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// fingerprintSample is the number of bytes read from both the start and the end of a file to fingerprint it.
+const fingerprintSample = 1024 * 1024
+
+// ErrCheckpointMismatch is returned when resuming an import of which the file or table differs from the checkpoint.
+var ErrCheckpointMismatch = errors.New("checkpoint mismatch")
+
+// createCheckpointsTableQuery creates the table holding the checkpoints of resumable imports.
+const createCheckpointsTableQuery = `CREATE TABLE IF NOT EXISTS import_checkpoints (
+		import_id text PRIMARY KEY,
+		table_name text NOT NULL,
+		file_path text NOT NULL,
+		fingerprint text NOT NULL,
+		byte_offset bigint NOT NULL,
+		next_line bigint NOT NULL,
+		rows_committed bigint NOT NULL,
+		rows_rejected bigint NOT NULL,
+		is_completed boolean NOT NULL DEFAULT false,
+		updated_at timestamptz NOT NULL DEFAULT now()
+	)`
+
+// checkpointColumns lists the columns of a checkpoint, in the order they are scanned.
+const checkpointColumns = `import_id, table_name, file_path, fingerprint, byte_offset, next_line, rows_committed, rows_rejected,
+	is_completed, updated_at`
+
+// saveCheckpointQuery inserts or updates a checkpoint.
+const saveCheckpointQuery = `INSERT INTO import_checkpoints (import_id, table_name, file_path, fingerprint, byte_offset, next_line,
+		rows_committed, rows_rejected, is_completed, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, now())
+	ON CONFLICT (import_id) DO UPDATE SET byte_offset = EXCLUDED.byte_offset, next_line = EXCLUDED.next_line,
+		rows_committed = EXCLUDED.rows_committed, rows_rejected = EXCLUDED.rows_rejected,
+		is_completed = EXCLUDED.is_completed, updated_at = EXCLUDED.updated_at`
+
+// ImportCheckpoint represents how far a resumable import got, as of its last committed batch.
+type ImportCheckpoint struct {
+	ImportID      string
+	Table         string
+	FilePath      string
+	Fingerprint   string
+	ByteOffset    int64
+	NextLine      int
+	RowsCommitted int
+	RowsRejected  int
+	IsCompleted   bool
+	UpdatedAt     time.Time
+}
+
+// WithResume commits the import batch by batch, recording a checkpoint under the importID in the import_checkpoints table
+// along with each batch.
+// Running the import again with the same importID resumes after the last committed batch, provided the file did not change.
+// The error budget spans every run, while the reject file only holds the rows rejected by the current run.
+// Runs with the same importID load their batches one at a time; a run of which the checkpoint was advanced by another run
+// in the meantime stops with ErrCheckpointMismatch.
+// It cannot be combined with dropping indexes or triggers, and a dry run ignores it.
+func WithResume(importID string) ImportOption {
+	return func(c *ImportConfig) {
+		c.ResumeID = importID
+	}
+}
+
+// limitedSource limits the rows of a source, so it can be read batch by batch.
+type limitedSource struct {
+	rowSource
+	limit       int
+	count       int
+	isExhausted bool
+}
+
+// next returns the next row until the limit is reached.
+func (s *limitedSource) next() (*sourceRow, error) {
+	if s.count >= s.limit {
+		return nil, io.EOF
+	}
+
+	row, err := s.rowSource.next()
+	if errors.Is(err, io.EOF) {
+		s.isExhausted = true
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.count++
+	return row, nil
+}
+
+// importCSVResumable imports the .csv file batch by batch, each committed along with its checkpoint,
+// starting after the last checkpoint of a previous run.
+func (d *DbSvc) importCSVResumable(ctx context.Context, filePath, table string, fields []string, config *ImportConfig) (*ImportResult, error) {
+	start := time.Now()
+	result := &ImportResult{Table: table, FilePath: filePath}
+	defer func() { result.Duration = time.Since(start) }()
+
+	if config.DropIndexes || config.DropTriggers {
+		return result, errors.New("resumable imports cannot drop indexes or triggers")
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return result, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return result, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	fingerprint, err := fingerprintFile(file, info.Size())
+	if err != nil {
+		return result, err
+	}
+
+	checkpoint, err := d.resumeCheckpoint(ctx, config.ResumeID, table, filePath, fingerprint)
+	if err != nil {
+		return result, err
+	}
+	result.Checkpoint = checkpoint
+	result.RowsRejected = checkpoint.RowsRejected
+
+	// The header precedes the checkpoint, so it is read before seeking to it
+	var header []string
+	if checkpoint.ByteOffset > 0 {
+		if header, err = readCSVHeader(file); err != nil {
+			return result, fmt.Errorf("failed to resume file: %w", err)
+		}
+	}
+	if _, err = file.Seek(checkpoint.ByteOffset, io.SeekStart); err != nil {
+		return result, fmt.Errorf("failed to resume file: %w", err)
+	}
+
+	source := newCSVSource(file)
+	source.size = info.Size()
+	if checkpoint.ByteOffset > 0 {
+		source.started, source.header, source.lineOffset = true, header, checkpoint.NextLine-1
+	}
+
+	base := checkpoint.ByteOffset
+	batches := &limitedSource{rowSource: source, limit: config.BatchSize}
+	im := newImporter(nil, table, fields, config, result)
+	for !checkpoint.IsCompleted {
+		batches.count = 0
+		loaded := result.RowsLoaded
+		err = d.runImportTransaction(ctx, config, func(tx *sql.Tx) error {
+			if err := lockCheckpoint(ctx, tx, checkpoint); err != nil {
+				return err
+			}
+
+			im.tx = tx
+			if err := im.run(ctx, batches); err != nil {
+				return err
+			}
+
+			checkpoint.ByteOffset = base + source.offset()
+			checkpoint.NextLine = max(checkpoint.NextLine, source.nextLine)
+			checkpoint.RowsCommitted += result.RowsLoaded - loaded
+			checkpoint.RowsRejected = result.RowsRejected
+			checkpoint.IsCompleted = batches.isExhausted
+			if checkpoint.IsCompleted {
+				if err := resyncImportedSequences(ctx, tx, config, result); err != nil {
+					return err
+				}
+			}
+			return saveCheckpoint(ctx, tx, checkpoint)
+		})
+		if err != nil {
+			result.RowsLoaded = loaded
+			break
+		}
+	}
+
+	return result, errors.Join(err, writeRejectFile(config, source.headers(), fields, result))
+}
+
+// readCSVHeader reads the header at the start of the file.
+func readCSVHeader(file *os.File) ([]string, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	return reader.Read()
+}
+
+// resumeCheckpoint returns the checkpoint of the import, or a new one when the import has not run before.
+// It returns ErrCheckpointMismatch when the checkpoint concerns another table or the file changed.
+func (d *DbSvc) resumeCheckpoint(ctx context.Context, importID, table, filePath, fingerprint string) (*ImportCheckpoint, error) {
+	var checkpoint *ImportCheckpoint
+	err := d.RunGuarded(false, func(db *sql.DB) error {
+		if err := createTableLocked(ctx, db, createCheckpointsTableQuery); err != nil {
+			return fmt.Errorf("failed to create checkpoints table: %w", ClassifyError(err))
+		}
+
+		var err error
+		row := db.QueryRowContext(ctx, fmt.Sprintf("SELECT %s FROM import_checkpoints WHERE import_id = $1", checkpointColumns), importID)
+		if checkpoint, err = scanCheckpoint(row); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to retrieve checkpoint: %w", ClassifyError(err))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if checkpoint == nil {
+		return &ImportCheckpoint{ImportID: importID, Table: table, FilePath: filePath, Fingerprint: fingerprint, NextLine: 1}, nil
+	}
+
+	if checkpoint.Table != table {
+		return nil, fmt.Errorf("%w: import %s loads into %s, not %s", ErrCheckpointMismatch, importID, checkpoint.Table, table)
+	}
+	if checkpoint.Fingerprint != fingerprint {
+		return nil, fmt.Errorf("%w: the file of import %s changed since its last checkpoint", ErrCheckpointMismatch, importID)
+	}
+	return checkpoint, nil
+}
+
+// createTableLocked executes the CREATE TABLE IF NOT EXISTS query under an advisory lock, as concurrent ones may otherwise
+// collide on the catalog and fail with a unique violation.
+func createTableLocked(ctx context.Context, db *sql.DB, query string) error {
+	txn, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer txn.Rollback()
+
+	if _, err = txn.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", query); err != nil {
+		return err
+	}
+	if _, err = txn.ExecContext(ctx, query); err != nil {
+		return err
+	}
+	return txn.Commit()
+}
+
+// lockCheckpoint locks the import for the remainder of the transaction of the batch, and checks whether its checkpoint is
+// still where this run left it, as another run of the same import may have advanced it in the meantime.
+func lockCheckpoint(ctx context.Context, tx *sql.Tx, checkpoint *ImportCheckpoint) error {
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", "import:"+checkpoint.ImportID); err != nil {
+		return fmt.Errorf("failed to lock import %s: %w", checkpoint.ImportID, ClassifyError(err))
+	}
+
+	var offset int64
+	err := tx.QueryRowContext(ctx, "SELECT byte_offset FROM import_checkpoints WHERE import_id = $1", checkpoint.ImportID).Scan(&offset)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to retrieve checkpoint: %w", ClassifyError(err))
+	}
+	if offset != checkpoint.ByteOffset {
+		return fmt.Errorf("%w: import %s was advanced to byte %d by another run", ErrCheckpointMismatch, checkpoint.ImportID, offset)
+	}
+	return nil
+}
+
+// saveCheckpoint records the checkpoint within the transaction of the batch.
+func saveCheckpoint(ctx context.Context, tx *sql.Tx, checkpoint *ImportCheckpoint) error {
+	_, err := tx.ExecContext(ctx, saveCheckpointQuery, checkpoint.ImportID, checkpoint.Table, checkpoint.FilePath,
+		checkpoint.Fingerprint, checkpoint.ByteOffset, checkpoint.NextLine, checkpoint.RowsCommitted, checkpoint.RowsRejected,
+		checkpoint.IsCompleted)
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", ClassifyError(err))
+	}
+	return nil
+}
+
+// ListImportCheckpoints retrieves the checkpoints of resumable imports, the most recently updated first.
+func (d *DbSvc) ListImportCheckpoints(ctx context.Context) ([]*ImportCheckpoint, error) {
+	var checkpoints []*ImportCheckpoint
+	err := d.RunGuarded(false, func(db *sql.DB) error {
+		if err := createTableLocked(ctx, db, createCheckpointsTableQuery); err != nil {
+			return fmt.Errorf("failed to create checkpoints table: %w", ClassifyError(err))
+		}
+
+		rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT %s FROM import_checkpoints ORDER BY updated_at DESC", checkpointColumns))
+		if err != nil {
+			return fmt.Errorf("failed to retrieve checkpoints: %w", ClassifyError(err))
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			checkpoint, err := scanCheckpoint(rows)
+			if err != nil {
+				return fmt.Errorf("failed to retrieve checkpoints: %w", ClassifyError(err))
+			}
+			checkpoints = append(checkpoints, checkpoint)
+		}
+
+		if err = rows.Err(); err != nil {
+			return fmt.Errorf("failed to retrieve checkpoints: %w", ClassifyError(err))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return checkpoints, nil
+}
+
+// ClearImportCheckpoint removes the checkpoint of the import, so running it again starts over.
+func (d *DbSvc) ClearImportCheckpoint(ctx context.Context, importID string) error {
+	return d.RunGuarded(false, func(db *sql.DB) error {
+		if err := createTableLocked(ctx, db, createCheckpointsTableQuery); err != nil {
+			return fmt.Errorf("failed to create checkpoints table: %w", ClassifyError(err))
+		}
+
+		if _, err := db.ExecContext(ctx, "DELETE FROM import_checkpoints WHERE import_id = $1", importID); err != nil {
+			return fmt.Errorf("failed to clear checkpoint: %w", ClassifyError(err))
+		}
+		return nil
+	})
+}
+
+// ClearStaleImportCheckpoints removes the checkpoints which have not been updated for the duration, and returns how many.
+func (d *DbSvc) ClearStaleImportCheckpoints(ctx context.Context, olderThan time.Duration) (int, error) {
+	var affected int64
+	err := d.RunGuarded(false, func(db *sql.DB) error {
+		if err := createTableLocked(ctx, db, createCheckpointsTableQuery); err != nil {
+			return fmt.Errorf("failed to create checkpoints table: %w", ClassifyError(err))
+		}
+
+		deleted, err := db.ExecContext(ctx, "DELETE FROM import_checkpoints WHERE updated_at < $1", time.Now().Add(-olderThan))
+		if err == nil {
+			affected, err = deleted.RowsAffected()
+		}
+		if err != nil {
+			return fmt.Errorf("failed to clear checkpoints: %w", ClassifyError(err))
+		}
+		return nil
+	})
+	return int(affected), err
+}
+
+// rowScanner represents the scanning shared by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanCheckpoint scans a checkpoint from the row.
+func scanCheckpoint(row rowScanner) (*ImportCheckpoint, error) {
+	checkpoint := &ImportCheckpoint{}
+	err := row.Scan(&checkpoint.ImportID, &checkpoint.Table, &checkpoint.FilePath, &checkpoint.Fingerprint, &checkpoint.ByteOffset,
+		&checkpoint.NextLine, &checkpoint.RowsCommitted, &checkpoint.RowsRejected, &checkpoint.IsCompleted, &checkpoint.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+// fingerprintFile fingerprints the file by hashing its size along with its first and last megabyte,
+// which detects replaced, truncated and appended files without reading all of it.
+func fingerprintFile(file *os.File, size int64) (string, error) {
+	hash := sha256.New()
+	if err := binary.Write(hash, binary.BigEndian, size); err != nil {
+		return "", fmt.Errorf("failed to fingerprint file: %w", err)
+	}
+
+	head := io.NewSectionReader(file, 0, min(size, fingerprintSample))
+	if _, err := io.Copy(hash, head); err != nil {
+		return "", fmt.Errorf("failed to fingerprint file: %w", err)
+	}
+
+	tailStart := max(size-fingerprintSample, 0)
+	tail := io.NewSectionReader(file, tailStart, size-tailStart)
+	if _, err := io.Copy(hash, tail); err != nil {
+		return "", fmt.Errorf("failed to fingerprint file: %w", err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,82 @@
+package pkg
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestFingerprintFile tests whether the fingerprint of a file changes along with its content.
+func TestFingerprintFile(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "contacts.csv")
+	fingerprint := func(content string) string {
+		if err := os.WriteFile(filePath, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		file, err := os.Open(filePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		result, err := fingerprintFile(file, int64(len(content)))
+		assert.NoError(t, err)
+		return result
+	}
+
+	original := fingerprint("id,name\n1,John Doe\n")
+	assert.Equal(t, original, fingerprint("id,name\n1,John Doe\n"))
+	assert.NotEqual(t, original, fingerprint("id,name\n1,Jane Doe\n"))
+	assert.NotEqual(t, original, fingerprint("id,name\n1,John Doe\n2,Jane Doe\n"))
+}
+
+// TestLimitedSource tests whether rows are read batch by batch, along with the line following the last record.
+func TestLimitedSource(t *testing.T) {
+	source := newCSVSource(strings.NewReader("id,name\n1,\"John\nDoe\"\n2,Jane\n3,Sam\n"))
+	batches := &limitedSource{rowSource: source, limit: 2}
+
+	var lines []int
+	for {
+		row, err := batches.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		assert.NoError(t, err)
+		lines = append(lines, row.line)
+	}
+	assert.Equal(t, []int{2, 4}, lines)
+	assert.Equal(t, 5, source.nextLine)
+	assert.False(t, batches.isExhausted)
+
+	batches.count = 0
+	row, err := batches.next()
+	assert.NoError(t, err)
+	assert.Equal(t, 5, row.line)
+
+	_, err = batches.next()
+	assert.ErrorIs(t, err, io.EOF)
+	assert.True(t, batches.isExhausted)
+}
+
+// TestReadCSVHeader tests whether the header is read from the start of the file, regardless of its current offset.
+func TestReadCSVHeader(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "contacts.csv")
+	if err := os.WriteFile(filePath, []byte("id,name\n1,John Doe\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	_, err = file.Seek(8, io.SeekStart)
+	assert.NoError(t, err)
+	header, err := readCSVHeader(file)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"id", "name"}, header)
+}
@@ -0,0 +1,50 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+)
+
+// SecurityClaims maps session settings, such as "app.user_id", onto their values.
+// They are applied to every transaction opened by DbSvc, so row-level security policies can read them with current_setting.
+// Repositories, paginators, audit trails and tenants run their queries within a transaction when the context holds claims.
+type SecurityClaims map[string]string
+
+// claimsKey is the key under which the security claims are stored in a context.
+type claimsKey struct{}
+
+// ContextWithClaims returns a copy of the context holding the claims, merged with any claims it already holds.
+func ContextWithClaims(ctx context.Context, claims SecurityClaims) context.Context {
+	merged := SecurityClaims{}
+	for setting, value := range ClaimsFromContext(ctx) {
+		merged[setting] = value
+	}
+	for setting, value := range claims {
+		merged[setting] = value
+	}
+	return context.WithValue(ctx, claimsKey{}, merged)
+}
+
+// ClaimsFromContext returns the claims held by the context, or nil when there are none.
+func ClaimsFromContext(ctx context.Context) SecurityClaims {
+	claims, _ := ctx.Value(claimsKey{}).(SecurityClaims)
+	return claims
+}
+
+// applyClaims sets the claims as settings which are local to the transaction, so they are cleared when it ends.
+func applyClaims(ctx context.Context, tx *sql.Tx, claims SecurityClaims) error {
+	settings := make([]string, 0, len(claims))
+	for setting := range claims {
+		settings = append(settings, setting)
+	}
+	sort.Strings(settings)
+
+	for _, setting := range settings {
+		if _, err := tx.ExecContext(ctx, "SELECT set_config($1, $2, true)", setting, claims[setting]); err != nil {
+			return fmt.Errorf("failed applying claim %s: %w", setting, ClassifyError(err))
+		}
+	}
+	return nil
+}
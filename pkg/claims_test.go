@@ -0,0 +1,19 @@
+package pkg
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// TestContextWithClaims tests whether claims are attached to a context and merged with those already attached.
+func TestContextWithClaims(t *testing.T) {
+	ctx := context.Background()
+	assert.Nil(t, ClaimsFromContext(ctx))
+
+	tenantCtx := ContextWithClaims(ctx, SecurityClaims{"app.tenant_id": "acme"})
+	userCtx := ContextWithClaims(tenantCtx, SecurityClaims{"app.user_id": "42"})
+
+	assert.Equal(t, SecurityClaims{"app.tenant_id": "acme"}, ClaimsFromContext(tenantCtx))
+	assert.Equal(t, SecurityClaims{"app.tenant_id": "acme", "app.user_id": "42"}, ClaimsFromContext(userCtx))
+}
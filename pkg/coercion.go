@@ -0,0 +1,131 @@
+package pkg
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// decimalPattern matches decimals once normalised.
+var decimalPattern = regexp.MustCompile(`^[+-]?(\d+(\.\d*)?|\.\d+)$`)
+
+// Coercer converts a value read from a CSV into the value handed to COPY.
+type Coercer func(value string) (interface{}, error)
+
+// WithNullMarkers imports values equal to one of the markers, such as "", `\N` or "NULL", as NULL.
+func WithNullMarkers(markers ...string) ImportOption {
+	return func(c *ImportConfig) {
+		c.NullMarkers = markers
+	}
+}
+
+// WithColumnNullMarkers overrides the NULL markers for the column.
+func WithColumnNullMarkers(column string, markers ...string) ImportOption {
+	return func(c *ImportConfig) {
+		if c.ColumnNullMarkers == nil {
+			c.ColumnNullMarkers = map[string][]string{}
+		}
+		c.ColumnNullMarkers[column] = markers
+	}
+}
+
+// WithCoercer applies the coercer to the values of every column without a coercer of its own.
+func WithCoercer(coercer Coercer) ImportOption {
+	return func(c *ImportConfig) {
+		c.Coercer = coercer
+	}
+}
+
+// WithColumnCoercer applies the coercer to the values of the column.
+func WithColumnCoercer(column string, coercer Coercer) ImportOption {
+	return func(c *ImportConfig) {
+		if c.ColumnCoercers == nil {
+			c.ColumnCoercers = map[string]Coercer{}
+		}
+		c.ColumnCoercers[column] = coercer
+	}
+}
+
+// BooleanCoercer converts the values of the vocabularies, compared case-insensitively, into booleans.
+func BooleanCoercer(trueValues, falseValues []string) Coercer {
+	return func(value string) (interface{}, error) {
+		value = strings.TrimSpace(value)
+		for _, v := range trueValues {
+			if strings.EqualFold(value, v) {
+				return true, nil
+			}
+		}
+		for _, v := range falseValues {
+			if strings.EqualFold(value, v) {
+				return false, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid boolean %q", value)
+	}
+}
+
+// TimeCoercer parses values with the layout, such as "02/01/2006", in the location when the layout holds no time zone.
+func TimeCoercer(layout string, location *time.Location) Coercer {
+	return func(value string) (interface{}, error) {
+		parsed, err := time.ParseInLocation(layout, strings.TrimSpace(value), location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time %q: %w", value, err)
+		}
+		return parsed, nil
+	}
+}
+
+// DecimalCoercer normalises decimals written with locale-specific separators, such as "1.234,56", into "1234.56".
+// The result is kept as text, so no precision is lost before Postgres parses it.
+func DecimalCoercer(groupSeparator, decimalSeparator string) Coercer {
+	return func(value string) (interface{}, error) {
+		normalised := strings.TrimSpace(value)
+		if groupSeparator != "" {
+			normalised = strings.ReplaceAll(normalised, groupSeparator, "")
+		}
+		if decimalSeparator != "." {
+			normalised = strings.Replace(normalised, decimalSeparator, ".", 1)
+		}
+		if !decimalPattern.MatchString(normalised) {
+			return nil, fmt.Errorf("invalid decimal %q", value)
+		}
+		return normalised, nil
+	}
+}
+
+// coerce applies the NULL markers and coercers to the text values of the row, which are matched to the fields by position.
+// It returns the failing field along with the error.
+func (c *ImportConfig) coerce(fields []string, row *sourceRow) (string, error) {
+	for i, value := range row.values {
+		text, ok := value.(string)
+		if !ok || i >= len(fields) {
+			continue
+		}
+
+		field := fields[i]
+		markers, ok := c.ColumnNullMarkers[field]
+		if !ok {
+			markers = c.NullMarkers
+		}
+		if contains(markers, text) {
+			row.values[i] = nil
+			continue
+		}
+
+		coercer, ok := c.ColumnCoercers[field]
+		if !ok {
+			coercer = c.Coercer
+		}
+		if coercer == nil {
+			continue
+		}
+
+		coerced, err := coercer(text)
+		if err != nil {
+			return field, err
+		}
+		row.values[i] = coerced
+	}
+	return "", nil
+}
@@ -0,0 +1,65 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// TestCoercers tests whether the provided coercers convert values and reject invalid ones.
+func TestCoercers(t *testing.T) {
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Skip("time zone database unavailable")
+	}
+
+	tests := []struct {
+		name     string
+		coercer  Coercer
+		value    string
+		expected interface{}
+		isError  bool
+	}{
+		{name: "Boolean true", coercer: BooleanCoercer([]string{"yes", "y"}, []string{"no", "n"}), value: "Yes", expected: true},
+		{name: "Boolean false", coercer: BooleanCoercer([]string{"yes", "y"}, []string{"no", "n"}), value: "n", expected: false},
+		{name: "Boolean invalid", coercer: BooleanCoercer([]string{"yes"}, []string{"no"}), value: "maybe", isError: true},
+		{name: "Date", coercer: TimeCoercer("02/01/2006", amsterdam), value: "17/10/2026", expected: time.Date(2026, 10, 17, 0, 0, 0, 0, amsterdam)},
+		{name: "Date invalid", coercer: TimeCoercer("02/01/2006", time.UTC), value: "2026-10-17", isError: true},
+		{name: "Decimal with comma", coercer: DecimalCoercer(".", ","), value: "1.234,56", expected: "1234.56"},
+		{name: "Decimal with point", coercer: DecimalCoercer(",", "."), value: "-1,234.5", expected: "-1234.5"},
+		{name: "Decimal invalid", coercer: DecimalCoercer(".", ","), value: "12a", isError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := tt.coercer(tt.value)
+			if tt.isError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, value)
+		})
+	}
+}
+
+// TestCoerce tests whether NULL markers and coercers are applied per import and per column.
+func TestCoerce(t *testing.T) {
+	config := newImportConfig([]ImportOption{
+		WithNullMarkers("", `\N`),
+		WithColumnNullMarkers("name", "NULL"),
+		WithColumnCoercer("active", BooleanCoercer([]string{"yes"}, []string{"no"})),
+	})
+
+	row := &sourceRow{values: []interface{}{"", "NULL", "yes", `\N`, 5}}
+	field, err := config.coerce([]string{"id", "name", "active", "phone", "age"}, row)
+	assert.NoError(t, err)
+	assert.Empty(t, field)
+	assert.Equal(t, []interface{}{nil, nil, true, nil, 5}, row.values)
+
+	row = &sourceRow{values: []interface{}{"1", "", "maybe"}}
+	field, err = config.coerce([]string{"id", "name", "active"}, row)
+	assert.Error(t, err)
+	assert.Equal(t, "active", field)
+	assert.Equal(t, "", row.values[1])
+}
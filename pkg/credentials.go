@@ -0,0 +1,321 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"github.com/lib/pq"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Credentials holds the user and password used to open a connection; an empty user keeps the user of the DSN.
+type Credentials struct {
+	User     string
+	Password string
+}
+
+// CredentialProvider represents a source of credentials, which is consulted whenever a new connection is opened.
+type CredentialProvider interface {
+	Credentials(ctx context.Context) (*Credentials, error)
+}
+
+// StaticCredentials provides fixed credentials.
+type StaticCredentials struct {
+	User     string
+	Password string
+}
+
+// NewStaticCredentials creates a new instance of StaticCredentials.
+func NewStaticCredentials(user, password string) *StaticCredentials {
+	return &StaticCredentials{User: user, Password: password}
+}
+
+// Credentials returns the fixed credentials.
+func (s *StaticCredentials) Credentials(_ context.Context) (*Credentials, error) {
+	return &Credentials{User: s.User, Password: s.Password}, nil
+}
+
+// EnvCredentials provides credentials read from environment variables.
+type EnvCredentials struct {
+	UserKey     string
+	PasswordKey string
+}
+
+// NewEnvCredentials creates a new instance of EnvCredentials; an empty userKey keeps the user of the DSN.
+func NewEnvCredentials(userKey, passwordKey string) *EnvCredentials {
+	return &EnvCredentials{UserKey: userKey, PasswordKey: passwordKey}
+}
+
+// Credentials returns the current values of the environment variables.
+func (e *EnvCredentials) Credentials(_ context.Context) (*Credentials, error) {
+	credentials := &Credentials{Password: GetEnvValueAsString(e.PasswordKey)}
+	if e.UserKey != "" {
+		credentials.User = GetEnvValueAsString(e.UserKey)
+	}
+	return credentials, nil
+}
+
+// FileCredentials provides credentials read from files, such as mounted secrets, which are re-read when they change.
+type FileCredentials struct {
+	UserPath     string
+	PasswordPath string
+	mu           sync.Mutex
+	cache        map[string]*fileCredentialCache
+}
+
+// fileCredentialCache holds the content of a file along with the state it was read in.
+type fileCredentialCache struct {
+	modTime time.Time
+	size    int64
+	content string
+}
+
+// NewFileCredentials creates a new instance of FileCredentials; an empty userPath keeps the user of the DSN.
+func NewFileCredentials(userPath, passwordPath string) *FileCredentials {
+	return &FileCredentials{UserPath: userPath, PasswordPath: passwordPath, cache: map[string]*fileCredentialCache{}}
+}
+
+// Credentials returns the content of the files, trimmed of surrounding whitespace.
+func (f *FileCredentials) Credentials(_ context.Context) (*Credentials, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	password, err := f.read(f.PasswordPath)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := &Credentials{Password: password}
+	if f.UserPath != "" {
+		if credentials.User, err = f.read(f.UserPath); err != nil {
+			return nil, err
+		}
+	}
+	return credentials, nil
+}
+
+// read returns the content of the file, which is only read again when its modification time or size changed.
+func (f *FileCredentials) read(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read credentials file: %w", err)
+	}
+
+	cached, ok := f.cache[path]
+	if ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.content, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read credentials file: %w", err)
+	}
+
+	cached = &fileCredentialCache{modTime: info.ModTime(), size: info.Size(), content: strings.TrimSpace(string(content))}
+	f.cache[path] = cached
+	return cached.content, nil
+}
+
+// ExecCredentials provides a password printed by a command, such as the CLI of a secret manager.
+type ExecCredentials struct {
+	User    string
+	Command string
+	Args    []string
+}
+
+// NewExecCredentials creates a new instance of ExecCredentials; an empty user keeps the user of the DSN.
+func NewExecCredentials(user, command string, args ...string) *ExecCredentials {
+	return &ExecCredentials{User: user, Command: command, Args: args}
+}
+
+// Credentials runs the command and returns its output, trimmed of surrounding whitespace, as password.
+func (e *ExecCredentials) Credentials(ctx context.Context) (*Credentials, error) {
+	var stderr bytes.Buffer
+	command := exec.CommandContext(ctx, e.Command, e.Args...)
+	command.Stderr = &stderr
+
+	output, err := command.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run credentials command: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return &Credentials{User: e.User, Password: strings.TrimSpace(string(output))}, nil
+}
+
+// defaultCredentialRefreshInterval is the refresh interval used when none is provided.
+const defaultCredentialRefreshInterval = time.Minute
+
+// WithCredentialProvider makes every new connection use the credentials of the provider.
+// Every refreshInterval, connections about to be reused check for rotated credentials and are recycled when outdated.
+// A refreshInterval of zero or less defaults to a minute, rather than consulting the provider on every reuse.
+func WithCredentialProvider(provider CredentialProvider, refreshInterval time.Duration) DbSvcOption {
+	if refreshInterval <= 0 {
+		refreshInterval = defaultCredentialRefreshInterval
+	}
+	return func(dbs *DbSvc) {
+		dbs.CredentialProvider = provider
+		dbs.CredentialRefreshInterval = refreshInterval
+	}
+}
+
+// credentialConnector opens connections with the credentials of a provider and tracks their rotation.
+type credentialConnector struct {
+	dsn             *DSN
+	provider        CredentialProvider
+	refreshInterval time.Duration
+
+	mu         sync.Mutex
+	current    *Credentials
+	generation int64
+	checkedAt  time.Time
+}
+
+// newCredentialConnector creates a new instance of credentialConnector.
+func newCredentialConnector(dsn *DSN, provider CredentialProvider, refreshInterval time.Duration) *credentialConnector {
+	return &credentialConnector{dsn: dsn, provider: provider, refreshInterval: refreshInterval}
+}
+
+// Connect opens a connection with the current credentials of the provider.
+func (c *credentialConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	credentials, generation, err := c.refresh(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+
+	dsn := *c.dsn
+	if credentials.User != "" {
+		dsn.User = credentials.User
+	}
+	dsn.Password = credentials.Password
+
+	connector, err := pq.NewConnector(dsn.String())
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &credentialConn{Conn: conn, connector: c, generation: generation}, nil
+}
+
+// Driver returns the underlying Postgres driver.
+func (c *credentialConnector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
+
+// refresh consults the provider, unless forced only when the refresh interval has passed, and returns the current generation.
+func (c *credentialConnector) refresh(ctx context.Context, force bool) (*Credentials, int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !force && c.current != nil && time.Since(c.checkedAt) < c.refreshInterval {
+		return c.current, c.generation, nil
+	}
+
+	credentials, err := c.provider.Credentials(ctx)
+	if err != nil {
+		if c.current == nil || force {
+			return nil, 0, fmt.Errorf("failed to retrieve credentials: %w", err)
+		}
+		log.Printf("Failed to refresh credentials, keeping the current ones: %s", err.Error())
+		return c.current, c.generation, nil
+	}
+
+	if c.current == nil || *credentials != *c.current {
+		c.current = credentials
+		c.generation++
+	}
+	c.checkedAt = time.Now()
+
+	return c.current, c.generation, nil
+}
+
+// isCurrent checks whether connections of the generation still use the current credentials.
+func (c *credentialConnector) isCurrent(ctx context.Context, generation int64, refresh bool) bool {
+	if refresh {
+		_, current, err := c.refresh(ctx, false)
+		return err == nil && current == generation
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation == generation
+}
+
+// credentialConn is a connection which is recycled once the credentials it was opened with have rotated.
+type credentialConn struct {
+	driver.Conn
+	connector  *credentialConnector
+	generation int64
+}
+
+// ResetSession discards the connection before reuse when its credentials have rotated.
+func (c *credentialConn) ResetSession(ctx context.Context) error {
+	if !c.connector.isCurrent(ctx, c.generation, true) {
+		return driver.ErrBadConn
+	}
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+// IsValid reports whether the connection may be returned to the pool.
+func (c *credentialConn) IsValid() bool {
+	if !c.connector.isCurrent(context.Background(), c.generation, false) {
+		return false
+	}
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+// BeginTx starts a transaction on the underlying connection.
+func (c *credentialConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+// PrepareContext prepares a statement on the underlying connection.
+func (c *credentialConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+// QueryContext executes a query on the underlying connection.
+func (c *credentialConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if queryer, ok := c.Conn.(driver.QueryerContext); ok {
+		return queryer.QueryContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+// ExecContext executes a statement on the underlying connection.
+func (c *credentialConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if execer, ok := c.Conn.(driver.ExecerContext); ok {
+		return execer.ExecContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+// Ping verifies the underlying connection is alive.
+func (c *credentialConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package pkg
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestCredentialProviders tests whether the built-in providers return the expected credentials.
+func TestCredentialProviders(t *testing.T) {
+	passwordPath := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(passwordPath, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_DB_USER", "env-user")
+	t.Setenv("TEST_DB_PASSWORD", "from-env")
+
+	tests := []struct {
+		name     string
+		provider CredentialProvider
+		expected *Credentials
+	}{
+		{
+			name:     "Static",
+			provider: NewStaticCredentials("docker", "static"),
+			expected: &Credentials{User: "docker", Password: "static"},
+		},
+		{
+			name:     "Environment",
+			provider: NewEnvCredentials("TEST_DB_USER", "TEST_DB_PASSWORD"),
+			expected: &Credentials{User: "env-user", Password: "from-env"},
+		},
+		{
+			name:     "File",
+			provider: NewFileCredentials("", passwordPath),
+			expected: &Credentials{Password: "from-file"},
+		},
+		{
+			name:     "Command",
+			provider: NewExecCredentials("docker", "echo", "from-command"),
+			expected: &Credentials{User: "docker", Password: "from-command"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			credentials, err := tt.provider.Credentials(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.expected, credentials)
+		})
+	}
+}
+
+// TestFileCredentialsRotation tests whether a changed file is read again.
+func TestFileCredentialsRotation(t *testing.T) {
+	passwordPath := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(passwordPath, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	provider := NewFileCredentials("", passwordPath)
+
+	credentials, err := provider.Credentials(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "old", credentials.Password)
+
+	if err = os.WriteFile(passwordPath, []byte("rotated"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	credentials, err = provider.Credentials(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "rotated", credentials.Password)
+}
+
+// TestCredentialConnectorRotation tests whether connections are considered outdated once the credentials rotate.
+func TestCredentialConnectorRotation(t *testing.T) {
+	ctx := context.Background()
+	provider := NewStaticCredentials("docker", "old")
+	connector := newCredentialConnector(&DSN{Host: "localhost"}, provider, time.Nanosecond)
+
+	_, generation, err := connector.refresh(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, connector.isCurrent(ctx, generation, true))
+
+	provider.Password = "rotated"
+	time.Sleep(time.Millisecond)
+
+	assert.False(t, connector.isCurrent(ctx, generation, true))
+	assert.False(t, connector.isCurrent(ctx, generation, false))
+}
+
+// TestCredentialRefreshIntervalDefault tests whether a refresh interval of zero or less is defaulted.
+func TestCredentialRefreshIntervalDefault(t *testing.T) {
+	provider := NewStaticCredentials("docker", "static")
+	for _, interval := range []time.Duration{0, -time.Second} {
+		dbs := &DbSvc{}
+		WithCredentialProvider(provider, interval)(dbs)
+		assert.Equal(t, defaultCredentialRefreshInterval, dbs.CredentialRefreshInterval)
+	}
+
+	dbs := &DbSvc{}
+	WithCredentialProvider(provider, time.Second)(dbs)
+	assert.Equal(t, time.Second, dbs.CredentialRefreshInterval)
+}
@@ -52,14 +52,14 @@ func getColumnValues(records [][]string, index int) []string {
 func GetCSVRecords(filePath string, headers bool) ([][]string, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open file: %s", err.Error())
+		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
 	defer file.Close()
 
 	reader := csv.NewReader(file)
 	records, err := reader.ReadAll()
 	if err != nil {
-		return nil, fmt.Errorf("failed to read the CSV: %s", err.Error())
+		return nil, fmt.Errorf("failed to read the CSV: %w", err)
 	}
 
 	if headers {
@@ -95,7 +95,7 @@ func transformTableRows(tableRows *sql.Rows) ([][]interface{}, error) {
 
 	columns, err := tableRows.Columns()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get columns: %v", err)
+		return nil, fmt.Errorf("failed to get columns: %w", err)
 	}
 
 	for tableRows.Next() {
@@ -106,7 +106,7 @@ func transformTableRows(tableRows *sql.Rows) ([][]interface{}, error) {
 		}
 
 		if err := tableRows.Scan(valuePointers...); err != nil {
-			return nil, fmt.Errorf("failed to scan row: %v", err)
+			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
 
 		scanResults = append(scanResults, values)
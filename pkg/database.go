@@ -1,16 +1,18 @@
 package pkg
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"github.com/lib/pq"
-	_ "github.com/lib/pq"
 	"log"
 	"strconv"
 	"strings"
 	"time"
 )
 
+// portPlaceholder is the deprecated placeholder for the port of the local end of the SSH tunnel in database URLs.
+const portPlaceholder = "<PORT>"
+
 // DbSvcOption is used to instantiate a DbSvc with the provided settings/configurations/actions.
 type DbSvcOption func(*DbSvc)
 
@@ -20,17 +22,23 @@ type DbOps interface {
 	Disconnect()
 	StartMonitoring()
 	StopMonitoring()
-	InsertCSVFile(filePath, table string, fields []string) error
-	BulkInsert(table string, fields []string, data [][]interface{}) error
+	InsertCSVFile(filePath, table string, fields []string, options ...ImportOption) error
+	BulkInsert(table string, fields []string, data [][]interface{}, options ...ImportOption) error
 	DB() *sql.DB
 }
 
 // DbSvc represents a manger of the database connection.
 type DbSvc struct {
-	DriverName, URL     string
-	IsMonitoringEnabled bool
-	SSHTunnel           *SSHTunnel
-	db                  *sql.DB
+	DriverName, URL           string
+	IsMonitoringEnabled       bool
+	SSHTunnel                 *SSHTunnel
+	CredentialProvider        CredentialProvider
+	CredentialRefreshInterval time.Duration
+	Breaker                   *CircuitBreaker
+	ReplicaURL                string
+	ReplicaSSHTunnel          *SSHTunnel
+	db                        *sql.DB
+	replica                   *sql.DB
 }
 
 // NewDbSvc creates a new instance of DbSvc.
@@ -54,11 +62,15 @@ func validateDriver(driverName string) {
 }
 
 // DB returns the underlying *sql.DB instance used for the database connection.
+// It bypasses the circuit breaker; RunGuarded and BeginTx consult it.
 func (d *DbSvc) DB() *sql.DB {
 	return d.db
 }
 
 // WithSSHTunnel establishes an SSH tunnel for connecting to the database.
+// The host and port of the database URL are replaced by the local end of the tunnel, so the URL must hold a valid port.
+// The <PORT> placeholder, as in postgres://user@localhost:<PORT>/db, is deprecated but still replaced by the local port.
+// A URL which cannot be parsed is fatal, like an invalid driver.
 func WithSSHTunnel(config *SSHConfig) DbSvcOption {
 	return func(dbs *DbSvc) {
 		sshTunnel, err := NewSSHTunnel(config)
@@ -66,6 +78,52 @@ func WithSSHTunnel(config *SSHConfig) DbSvcOption {
 			log.Printf("Failed to establish SSH tunnel: %s", err.Error())
 		}
 		dbs.SSHTunnel = sshTunnel
+		validateTunnelURL(dbs.URL, sshTunnel)
+	}
+}
+
+// validateTunnelURL checks whether the URL to connect to through the SSH tunnel can be parsed.
+func validateTunnelURL(URL string, tunnel *SSHTunnel) {
+	if tunnel == nil {
+		return
+	}
+	if _, err := ParseDSN(replacePortPlaceholder(URL, tunnel)); err != nil {
+		log.Fatalf("Invalid database URL for SSH tunnel: %s", err.Error())
+	}
+}
+
+// replacePortPlaceholder replaces the deprecated <PORT> placeholder of the URL by the local port of the SSH tunnel.
+func replacePortPlaceholder(URL string, tunnel *SSHTunnel) string {
+	if !strings.Contains(URL, portPlaceholder) {
+		return URL
+	}
+	return strings.Replace(URL, portPlaceholder, strconv.Itoa(tunnel.Local.Port), 1)
+}
+
+// WithCircuitBreaker makes the database fail fast with ErrCircuitOpen after threshold consecutive connection failures.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) DbSvcOption {
+	return func(dbs *DbSvc) {
+		dbs.Breaker = NewCircuitBreaker(threshold, cooldown)
+	}
+}
+
+// WithReadReplica connects to a replica, which serves read-only work while the circuit breaker is open.
+// The replica uses the credential provider of the primary, if any; as the SSH tunnel of the primary leads to the
+// primary, a replica behind a bastion requires a tunnel of its own through WithReplicaSSHTunnel.
+func WithReadReplica(URL string) DbSvcOption {
+	return func(dbs *DbSvc) {
+		dbs.ReplicaURL = URL
+	}
+}
+
+// WithReplicaSSHTunnel establishes an SSH tunnel for connecting to the replica, of which the URL must hold a valid port.
+func WithReplicaSSHTunnel(config *SSHConfig) DbSvcOption {
+	return func(dbs *DbSvc) {
+		sshTunnel, err := NewSSHTunnel(config)
+		if err != nil {
+			log.Printf("Failed to establish SSH tunnel to replica: %s", err.Error())
+		}
+		dbs.ReplicaSSHTunnel = sshTunnel
 	}
 }
 
@@ -84,25 +142,82 @@ func WithMonitoring() DbSvcOption {
 }
 
 // Connect establishes a connection to the database using the specified driver and URL.
+// Failing to open the database, such as with a URL which cannot be parsed for a credential provider, is logged.
+// The replica, if any, is connected likewise, though without it the primary is still served.
 func (d *DbSvc) Connect() {
-	dbURL := d.URL
 	if d.SSHTunnel != nil {
 		d.SSHTunnel.Start()
-		dbURL = strings.Replace(dbURL, "<PORT>", strconv.Itoa(d.SSHTunnel.Local.Port), 1)
 	}
-
-	var err error
-	d.db, err = sql.Open(d.DriverName, dbURL)
+	db, err := d.open(d.URL, d.SSHTunnel)
 	if err != nil {
 		log.Printf("Failed to connect to database: %s", err.Error())
+		return
 	}
+	d.db = db
+
+	d.connectReplica()
 
 	err = d.DB().Ping()
+	d.observeOutcome(err)
 	if err != nil {
 		log.Printf("Failed to reach database: %s", err.Error())
 	}
 }
 
+// connectReplica opens the replica, if any, unless it is open and reachable already, as when reconnecting to the primary.
+// An unreachable replica is replaced, while its SSH tunnel is only started along with the first connection.
+func (d *DbSvc) connectReplica() {
+	if d.ReplicaURL == "" {
+		return
+	}
+	if d.replica != nil && d.replica.Ping() == nil {
+		return
+	}
+	if d.replica == nil && d.ReplicaSSHTunnel != nil {
+		d.ReplicaSSHTunnel.Start()
+	}
+
+	replica, err := d.open(d.ReplicaURL, d.ReplicaSSHTunnel)
+	if err != nil {
+		log.Printf("Failed to connect to replica: %s", err.Error())
+		return
+	}
+
+	previous := d.replica
+	d.replica = replica
+	if previous != nil {
+		if err = previous.Close(); err != nil {
+			log.Printf("Failed to disconnect from replica: %s", err.Error())
+		}
+	}
+}
+
+// open opens the database at the URL, through the started SSH tunnel when provided and with the credential provider, if any.
+func (d *DbSvc) open(URL string, tunnel *SSHTunnel) (*sql.DB, error) {
+	if tunnel == nil && d.CredentialProvider == nil {
+		return sql.Open(d.DriverName, URL)
+	}
+
+	if tunnel != nil && strings.Contains(URL, portPlaceholder) {
+		log.Printf("The %s placeholder in database URLs is deprecated, use the port of the database instead", portPlaceholder)
+		URL = replacePortPlaceholder(URL, tunnel)
+	}
+
+	dsn, err := ParseDSN(URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	if tunnel != nil {
+		tunnel.RewriteDSN(dsn)
+	}
+
+	if d.CredentialProvider != nil {
+		return sql.OpenDB(newCredentialConnector(dsn, d.CredentialProvider, d.CredentialRefreshInterval)), nil
+	}
+	return sql.Open(d.DriverName, dsn.String())
+}
+
 // Disconnect disconnects from the database.
 func (d *DbSvc) Disconnect() {
 	d.IsMonitoringEnabled = false
@@ -115,9 +230,18 @@ func (d *DbSvc) Disconnect() {
 		log.Printf("Failed to diconnect from database: %s", err.Error())
 	}
 
+	if d.replica != nil {
+		if err = d.replica.Close(); err != nil {
+			log.Printf("Failed to disconnect from replica: %s", err.Error())
+		}
+	}
+
 	if d.SSHTunnel != nil {
 		d.SSHTunnel.Close()
 	}
+	if d.ReplicaSSHTunnel != nil {
+		d.ReplicaSSHTunnel.Close()
+	}
 }
 
 // StartMonitoring monitors the database connection and attempts to reconnect whenever the database is not connected.
@@ -127,7 +251,14 @@ func (d *DbSvc) StartMonitoring() {
 		if !d.IsMonitoringEnabled {
 			break
 		}
+		if d.db == nil {
+			log.Printf("Not connected to the database, attempting to connect...")
+			d.Connect()
+			time.Sleep(15 * time.Second)
+			continue
+		}
 		err := d.DB().Ping()
+		d.observeOutcome(err)
 		if err != nil {
 			log.Printf("Lost connection to the database: %v", err)
 			log.Printf("Attempting to reconnect...")
@@ -142,92 +273,139 @@ func (d *DbSvc) StopMonitoring() {
 	d.IsMonitoringEnabled = false
 }
 
-// InsertCSVFile is the main function that coordinates opening the file and inserting the records to the database
-func (d *DbSvc) InsertCSVFile(filePath, table string, fields []string) error {
-	records, err := GetCSVRecords(filePath, false)
-	if err != nil {
-		return err
-	}
-	return d.insertCSVRecords(table, fields, records)
+// IsReadOnly checks whether the primary is unavailable and read-only work is served by the replica.
+// While the circuit breaker is half-open, the primary is still unproven and only a single probe reaches it.
+func (d *DbSvc) IsReadOnly() bool {
+	return d.Breaker != nil && d.replica != nil && d.Breaker.State() != CircuitClosed
 }
 
-// insertCSVRecords inserts the contents of a .csv file into the database.
-func (d *DbSvc) insertCSVRecords(table string, fields []string, records [][]string) error {
-	transaction, err := d.DB().Begin()
-	if err != nil {
-		return fmt.Errorf("failed to start transaction: %s", err.Error())
+// Replica returns the *sql.DB instance of the replica, or nil when no replica is configured.
+func (d *DbSvc) Replica() *sql.DB {
+	return d.replica
+}
+
+// observeOutcome registers the outcome of a health check of the primary with the circuit breaker, if any.
+func (d *DbSvc) observeOutcome(err error) {
+	if d.Breaker != nil {
+		d.Breaker.Observe(err)
 	}
+}
 
-	statement, err := transaction.Prepare(pq.CopyIn(table, fields...))
-	if err != nil {
-		return fmt.Errorf("failed to prepare statement: %s", err.Error())
+// acquire returns the database to use: the primary when the circuit breaker allows it, otherwise the replica for read-only work.
+// The returned function records the outcome of the call.
+func (d *DbSvc) acquire(readOnly bool) (*sql.DB, func(error), error) {
+	if d.Breaker == nil {
+		return d.DB(), func(error) {}, nil
 	}
 
-	for _, record := range records {
-		data := make([]interface{}, len(record))
-		for i, v := range record {
-			data[i] = v
-		}
-		if _, err = statement.Exec(data...); err != nil {
-			return fmt.Errorf("failed to execute statement: %s", err.Error())
+	if err := d.Breaker.Allow(); err != nil {
+		if readOnly && d.replica != nil {
+			return d.replica, func(error) {}, nil
 		}
+		return nil, nil, ClassifyError(err)
 	}
 
-	if err = statement.Close(); err != nil {
-		return fmt.Errorf("failed to close statement: %s", err.Error())
-	}
+	return d.DB(), d.Breaker.Record, nil
+}
 
-	if err = transaction.Commit(); err != nil {
-		return fmt.Errorf("failed to commit transaction: %s", err.Error())
+// RunGuarded executes fn against the primary, guarded by the circuit breaker.
+// While the circuit is open, read-only work is executed against the replica when one is configured.
+// Security claims are not applied, as they only last for a transaction; work subject to them belongs in RunInTransaction.
+func (d *DbSvc) RunGuarded(readOnly bool, fn func(db *sql.DB) error) error {
+	db, record, err := d.acquire(readOnly)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	err = fn(db)
+	record(err)
+	return err
 }
 
-// BulkInsert helps inserting data in bulk.
-func (d *DbSvc) BulkInsert(table string, fields []string, data [][]interface{}) error {
-	txn, err := d.DB().Begin()
+// runWithClaims executes fn like RunGuarded, unless the context holds security claims,
+// in which case fn is executed within a transaction to which the claims are applied.
+func (d *DbSvc) runWithClaims(ctx context.Context, readOnly bool, fn func(q queryer) error) error {
+	if len(ClaimsFromContext(ctx)) == 0 {
+		return d.RunGuarded(readOnly, func(db *sql.DB) error {
+			return fn(db)
+		})
+	}
+
+	txn, err := d.BeginTx(ctx, &sql.TxOptions{ReadOnly: readOnly})
 	if err != nil {
-		return fmt.Errorf("failed starting transaction: %w", err)
+		return fmt.Errorf("failed starting transaction: %w", ClassifyError(err))
 	}
 	defer txn.Rollback()
 
-	// Create a temporary table
-	tempTable := fmt.Sprintf("%s_temp_%d", table, time.Now().UnixNano())
-	_, err = txn.Exec(fmt.Sprintf("CREATE TEMPORARY TABLE \"%s\" (LIKE \"%s\") ON COMMIT DROP", tempTable, table))
+	if err = fn(txn); err != nil {
+		return err
+	}
+
+	if err = txn.Commit(); err != nil {
+		return fmt.Errorf("failed committing transaction: %w", ClassifyError(err))
+	}
+
+	return nil
+}
+
+// BeginTx starts a transaction on the database with the provided options, guarded by the circuit breaker.
+// Read-only transactions are started on the replica while the circuit is open.
+// The security claims held by the context are applied for the duration of the transaction.
+func (d *DbSvc) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	db, record, err := d.acquire(opts != nil && opts.ReadOnly)
 	if err != nil {
-		return fmt.Errorf("failed creating temporary table: %w", err)
+		return nil, err
 	}
 
-	// Prepare statement for copying into temp table
-	stmt, err := txn.Prepare(pq.CopyIn(tempTable, fields...))
+	txn, err := db.BeginTx(ctx, opts)
+	record(err)
 	if err != nil {
-		return fmt.Errorf("failed preparing statement: %w", err)
+		return nil, err
 	}
 
-	// Copy data into temp table
-	for _, row := range data {
-		_, err := stmt.Exec(row...)
-		if err != nil {
-			return fmt.Errorf("failed executing statement: %w", err)
+	if claims := ClaimsFromContext(ctx); len(claims) > 0 {
+		if err = applyClaims(ctx, txn, claims); err != nil {
+			txn.Rollback()
+			return nil, err
 		}
 	}
 
-	err = stmt.Close()
+	return txn, nil
+}
+
+// RunInTransaction executes fn within a transaction, which is committed when fn succeeds and rolled back otherwise.
+func (d *DbSvc) RunInTransaction(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	txn, err := d.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed closing statement: %w", err)
+		return fmt.Errorf("failed starting transaction: %w", ClassifyError(err))
 	}
+	defer txn.Rollback()
 
-	// Insert from temp table to main table, ignoring conflicts
-	_, err = txn.Exec(fmt.Sprintf("INSERT INTO \"%s\" SELECT * FROM \"%s\" ON CONFLICT DO NOTHING", table, tempTable))
-	if err != nil {
-		return fmt.Errorf("failed inserting from temporary table: %w", err)
+	if err = fn(txn); err != nil {
+		return err
 	}
 
-	err = txn.Commit()
-	if err != nil {
-		return fmt.Errorf("failed committing transaction: %w", err)
+	if err = txn.Commit(); err != nil {
+		return fmt.Errorf("failed committing transaction: %w", ClassifyError(err))
 	}
 
 	return nil
 }
+
+// InsertCSVFile is the main function that coordinates opening the file and inserting the records to the database
+func (d *DbSvc) InsertCSVFile(filePath, table string, fields []string, options ...ImportOption) error {
+	result, err := d.ImportCSVFile(context.Background(), filePath, table, fields, options...)
+	if err != nil {
+		return err
+	}
+	return result.Err()
+}
+
+// BulkInsert helps inserting data in bulk.
+func (d *DbSvc) BulkInsert(table string, fields []string, data [][]interface{}, options ...ImportOption) error {
+	result, err := d.ImportRows(context.Background(), table, fields, data, options...)
+	if err != nil {
+		return err
+	}
+	return result.Err()
+}
@@ -0,0 +1,235 @@
+package pkg
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// DSN represents a Postgres data source name, which can be edited field by field.
+// Parameters without a dedicated field, such as connect_timeout or application_name, are kept in Options.
+type DSN struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	DbName   string
+	SSLMode  string
+	Options  map[string]string
+}
+
+// ParseDSN parses a data source name in either URL form (postgres://...) or key/value form (host=... port=...).
+func ParseDSN(dsn string) (*DSN, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return parseURLDSN(dsn)
+	}
+	return parseKeyValueDSN(dsn)
+}
+
+// parseURLDSN parses a data source name in URL form.
+func parseURLDSN(dsn string) (*DSN, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse DSN: %w", err)
+	}
+
+	parsed := &DSN{Options: map[string]string{}}
+	if err = parsed.set("host", u.Hostname()); err != nil {
+		return nil, err
+	}
+	if err = parsed.set("port", u.Port()); err != nil {
+		return nil, err
+	}
+	if u.User != nil {
+		parsed.User = u.User.Username()
+		parsed.Password, _ = u.User.Password()
+	}
+	parsed.DbName = strings.TrimPrefix(u.Path, "/")
+
+	for key, values := range u.Query() {
+		if err = parsed.set(key, values[len(values)-1]); err != nil {
+			return nil, err
+		}
+	}
+
+	return parsed, nil
+}
+
+// parseKeyValueDSN parses a data source name in key/value form, of which values may be quoted and escaped like libpq does.
+func parseKeyValueDSN(dsn string) (*DSN, error) {
+	parsed := &DSN{Options: map[string]string{}}
+	runes := []rune(dsn)
+	i := 0
+
+	skipSpaces := func() {
+		for i < len(runes) && unicode.IsSpace(runes[i]) {
+			i++
+		}
+	}
+
+	for {
+		skipSpaces()
+		if i >= len(runes) {
+			return parsed, nil
+		}
+
+		start := i
+		for i < len(runes) && runes[i] != '=' && !unicode.IsSpace(runes[i]) {
+			i++
+		}
+		key := string(runes[start:i])
+
+		skipSpaces()
+		if i >= len(runes) || runes[i] != '=' {
+			return nil, fmt.Errorf("failed to parse DSN: missing \"=\" after %q", key)
+		}
+		i++
+		skipSpaces()
+
+		var value strings.Builder
+		quoted := i < len(runes) && runes[i] == '\''
+		if quoted {
+			i++
+		}
+		for {
+			if i >= len(runes) {
+				if quoted {
+					return nil, fmt.Errorf("failed to parse DSN: unterminated quoted value of %q", key)
+				}
+				break
+			}
+			r := runes[i]
+			if quoted && r == '\'' {
+				i++
+				break
+			}
+			if !quoted && unicode.IsSpace(r) {
+				break
+			}
+			if r == '\\' && i+1 < len(runes) {
+				i++
+				r = runes[i]
+			}
+			value.WriteRune(r)
+			i++
+		}
+
+		if err := parsed.set(key, value.String()); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// set assigns the value of the parameter to its field, or to the options when it has no dedicated field.
+func (d *DSN) set(key, value string) error {
+	switch key {
+	case "host":
+		d.Host = value
+	case "port":
+		if value == "" {
+			d.Port = 0
+			return nil
+		}
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("failed to parse DSN: invalid port %q", value)
+		}
+		d.Port = port
+	case "user":
+		d.User = value
+	case "password":
+		d.Password = value
+	case "dbname":
+		d.DbName = value
+	case "sslmode":
+		d.SSLMode = value
+	default:
+		if d.Options == nil {
+			d.Options = map[string]string{}
+		}
+		d.Options[key] = value
+	}
+	return nil
+}
+
+// parameters returns the non-empty parameters of the DSN, with the dedicated fields first and the options sorted by key.
+func (d *DSN) parameters() [][2]string {
+	var parameters [][2]string
+	add := func(key, value string) {
+		if value != "" {
+			parameters = append(parameters, [2]string{key, value})
+		}
+	}
+
+	add("host", d.Host)
+	if d.Port != 0 {
+		add("port", strconv.Itoa(d.Port))
+	}
+	add("user", d.User)
+	add("password", d.Password)
+	add("dbname", d.DbName)
+	add("sslmode", d.SSLMode)
+
+	keys := make([]string, 0, len(d.Options))
+	for key := range d.Options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		add(key, d.Options[key])
+	}
+
+	return parameters
+}
+
+// String renders the DSN in key/value form, quoting and escaping the values where needed.
+func (d *DSN) String() string {
+	parameters := d.parameters()
+	rendered := make([]string, len(parameters))
+	for i, parameter := range parameters {
+		rendered[i] = parameter[0] + "=" + quoteDSNValue(parameter[1])
+	}
+	return strings.Join(rendered, " ")
+}
+
+// URL renders the DSN in URL form.
+func (d *DSN) URL() string {
+	u := &url.URL{Scheme: "postgres", Host: d.Host}
+	if d.Port != 0 {
+		u.Host = net.JoinHostPort(d.Host, strconv.Itoa(d.Port))
+	}
+	if d.User != "" {
+		u.User = url.User(d.User)
+		if d.Password != "" {
+			u.User = url.UserPassword(d.User, d.Password)
+		}
+	}
+	if d.DbName != "" {
+		u.Path = "/" + d.DbName
+	}
+
+	query := url.Values{}
+	for _, parameter := range d.parameters() {
+		switch parameter[0] {
+		case "host", "port", "user", "password", "dbname":
+			continue
+		}
+		query.Set(parameter[0], parameter[1])
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// quoteDSNValue quotes the value when it contains characters which would otherwise break the key/value form.
+func quoteDSNValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\n\r\f\v'\\") {
+		return value
+	}
+	escaped := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+	return "'" + escaped + "'"
+}
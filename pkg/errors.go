@@ -0,0 +1,154 @@
+package pkg
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"net"
+	"syscall"
+)
+
+// The kinds of database errors, which can be matched with errors.Is.
+var (
+	ErrUniqueViolation      = errors.New("unique violation")
+	ErrForeignKeyViolation  = errors.New("foreign key violation")
+	ErrCheckViolation       = errors.New("check violation")
+	ErrNotNullViolation     = errors.New("not null violation")
+	ErrSerializationFailure = errors.New("serialization failure")
+	ErrDeadlock             = errors.New("deadlock detected")
+	ErrConnectionLost       = errors.New("connection lost")
+	ErrQueryCanceled        = errors.New("query canceled")
+)
+
+// errorKinds maps SQLSTATE codes onto the kinds of database errors.
+var errorKinds = map[pq.ErrorCode]error{
+	"23505": ErrUniqueViolation,
+	"23503": ErrForeignKeyViolation,
+	"23514": ErrCheckViolation,
+	"23502": ErrNotNullViolation,
+	"40001": ErrSerializationFailure,
+	"40P01": ErrDeadlock,
+	"57014": ErrQueryCanceled,
+	"57P01": ErrConnectionLost,
+	"57P02": ErrConnectionLost,
+	"57P03": ErrConnectionLost,
+}
+
+// transientCodes holds the SQLSTATE codes, other than those of the transient kinds, which are worth retrying.
+var transientCodes = map[pq.ErrorCode]bool{
+	"53000": true, // insufficient_resources
+	"53100": true, // disk_full
+	"53200": true, // out_of_memory
+	"53300": true, // too_many_connections
+	"55P03": true, // lock_not_available
+}
+
+// DbError represents a classified database error, carrying the details reported by Postgres.
+type DbError struct {
+	Kind       error
+	Code       string
+	Message    string
+	Detail     string
+	Schema     string
+	Table      string
+	Column     string
+	Constraint string
+	Err        error
+}
+
+// Error returns the description of the database error.
+func (e *DbError) Error() string {
+	description := e.Err.Error()
+	if e.Kind != nil {
+		description = fmt.Sprintf("%s: %s", e.Kind.Error(), description)
+	}
+	if e.Constraint != "" {
+		description = fmt.Sprintf("%s (constraint %s)", description, e.Constraint)
+	}
+	return description
+}
+
+// Unwrap returns both the kind and the original error, so either can be matched with errors.Is and errors.As.
+func (e *DbError) Unwrap() []error {
+	if e.Kind == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// ClassifyError wraps the error into a DbError describing its kind; nil and already classified errors are returned as is.
+func ClassifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var dbErr *DbError
+	if errors.As(err, &dbErr) {
+		return err
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		kind := errorKinds[pqErr.Code]
+		if kind == nil && pqErr.Code.Class() == "08" {
+			kind = ErrConnectionLost
+		}
+		return &DbError{
+			Kind:       kind,
+			Code:       string(pqErr.Code),
+			Message:    pqErr.Message,
+			Detail:     pqErr.Detail,
+			Schema:     pqErr.Schema,
+			Table:      pqErr.Table,
+			Column:     pqErr.Column,
+			Constraint: pqErr.Constraint,
+			Err:        err,
+		}
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return &DbError{Kind: ErrQueryCanceled, Message: err.Error(), Err: err}
+	}
+
+	if isConnectionError(err) {
+		return &DbError{Kind: ErrConnectionLost, Message: err.Error(), Err: err}
+	}
+
+	return err
+}
+
+// isConnectionError checks whether the error originates from a broken or unreachable connection.
+// Of the network errors, only failures to dial which are neither timeouts nor failures to resolve the host are considered.
+// End of file errors and other network errors, such as a read timing out on a slow query, may have other causes.
+func isConnectionError(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	return errors.As(err, &opErr) && opErr.Op == "dial" && !opErr.Timeout() && !errors.As(opErr.Err, &dnsErr)
+}
+
+// IsTransient checks whether the error is likely to disappear when the operation is retried.
+// Canceled queries are considered permanent, as retrying would override the decision of the caller.
+func IsTransient(err error) bool {
+	err = ClassifyError(err)
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, ErrSerializationFailure) || errors.Is(err, ErrDeadlock) || errors.Is(err, ErrConnectionLost) ||
+		errors.Is(err, ErrCircuitOpen) {
+		return true
+	}
+
+	var dbErr *DbError
+	return errors.As(err, &dbErr) && transientCodes[pq.ErrorCode(dbErr.Code)]
+}
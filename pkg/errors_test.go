@@ -0,0 +1,112 @@
+package pkg
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// TestClassifyError tests whether errors are classified into their kinds.
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		kind      error
+		transient bool
+	}{
+		{
+			name:      "Unique violation",
+			err:       &pq.Error{Code: "23505", Constraint: "contacts_pkey", Table: "contacts"},
+			kind:      ErrUniqueViolation,
+			transient: false,
+		},
+		{
+			name:      "Not null violation",
+			err:       &pq.Error{Code: "23502", Column: "name"},
+			kind:      ErrNotNullViolation,
+			transient: false,
+		},
+		{
+			name:      "Serialization failure",
+			err:       &pq.Error{Code: "40001"},
+			kind:      ErrSerializationFailure,
+			transient: true,
+		},
+		{
+			name:      "Connection failure",
+			err:       &pq.Error{Code: "08006"},
+			kind:      ErrConnectionLost,
+			transient: true,
+		},
+		{
+			name:      "Bad connection",
+			err:       fmt.Errorf("failed to ping: %w", driver.ErrBadConn),
+			kind:      ErrConnectionLost,
+			transient: true,
+		},
+		{
+			name:      "Refused connection",
+			err:       &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)},
+			kind:      ErrConnectionLost,
+			transient: true,
+		},
+		{
+			name:      "Unreachable network",
+			err:       &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ENETUNREACH)},
+			kind:      ErrConnectionLost,
+			transient: true,
+		},
+		{
+			name:      "Canceled context",
+			err:       context.Canceled,
+			kind:      ErrQueryCanceled,
+			transient: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wrapped := fmt.Errorf("failed executing statement: %w", ClassifyError(tt.err))
+			assert.True(t, errors.Is(wrapped, tt.kind))
+			assert.True(t, errors.Is(wrapped, tt.err))
+			assert.Equal(t, tt.transient, IsTransient(wrapped))
+		})
+	}
+}
+
+// TestClassifyErrorNotConnectionLost tests whether errors which may have other causes are not classified as lost connections.
+func TestClassifyErrorNotConnectionLost(t *testing.T) {
+	for _, err := range []error{
+		io.EOF,
+		&net.DNSError{Err: "i/o timeout", IsTimeout: true},
+		&net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded},
+		&net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded},
+		&net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "db", IsNotFound: true}},
+	} {
+		assert.False(t, errors.Is(ClassifyError(err), ErrConnectionLost), err.Error())
+	}
+}
+
+// TestClassifyErrorDetails tests whether the details reported by Postgres are retained.
+func TestClassifyErrorDetails(t *testing.T) {
+	err := ClassifyError(&pq.Error{Code: "23503", Constraint: "orders_customer_fkey", Table: "orders", Column: "customer_id"})
+
+	var dbErr *DbError
+	if !errors.As(err, &dbErr) {
+		t.Fatalf("expected a DbError, got %T", err)
+	}
+	assert.Equal(t, ErrForeignKeyViolation, dbErr.Kind)
+	assert.Equal(t, "orders_customer_fkey", dbErr.Constraint)
+	assert.Equal(t, "orders", dbErr.Table)
+	assert.Equal(t, "customer_id", dbErr.Column)
+	assert.Nil(t, ClassifyError(nil))
+	assert.Same(t, err, ClassifyError(err))
+}
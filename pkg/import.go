@@ -0,0 +1,796 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrErrorBudgetExceeded is returned when more rows fail than the error budget of an import allows.
+var ErrErrorBudgetExceeded = errors.New("error budget exceeded")
+
+// copyContextPattern extracts the line and column from the context Postgres reports for a failing COPY.
+var copyContextPattern = regexp.MustCompile(`COPY [^,]+, line (\d+)(?:, column ([^:]+))?`)
+
+// ImportOption is used to run an import with the provided settings.
+type ImportOption func(*ImportConfig)
+
+// ImportConfig holds the settings of an import.
+type ImportConfig struct {
+	DryRun            bool
+	DeferConstraints  bool
+	BatchSize         int
+	MaxErrors         int
+	RejectFilePath    string
+	NullMarkers       []string
+	ColumnNullMarkers map[string][]string
+	Coercer           Coercer
+	ColumnCoercers    map[string]Coercer
+	ProgressObserver  ProgressObserver
+	ProgressInterval  time.Duration
+	ResyncSequences   bool
+	DropIndexes       bool
+	DropTriggers      bool
+	KeptTriggers      []string
+	Workers           int
+	ResumeID          string
+	SoftDeleteColumn  string
+	ChangeLog         bool
+}
+
+// newImportConfig creates an ImportConfig with the defaults, to which the options are applied.
+func newImportConfig(options []ImportOption) *ImportConfig {
+	config := &ImportConfig{BatchSize: 10000}
+	for _, option := range options {
+		option(config)
+	}
+	return config
+}
+
+// WithDryRun performs the full import inside a transaction, captures every failing row and rolls back afterwards.
+// Deferred constraints are checked before rolling back, so their violations fail the dry run as they would the import.
+func WithDryRun() ImportOption {
+	return func(c *ImportConfig) {
+		c.DryRun = true
+	}
+}
+
+// WithDeferredConstraints defers the deferrable constraints until the import commits, so rows may be loaded in any order.
+func WithDeferredConstraints() ImportOption {
+	return func(c *ImportConfig) {
+		c.DeferConstraints = true
+	}
+}
+
+// WithBatchSize sets the number of rows copied per COPY statement.
+func WithBatchSize(size int) ImportOption {
+	return func(c *ImportConfig) {
+		c.BatchSize = size
+	}
+}
+
+// WithMaxErrors tolerates up to maxErrors failing rows, which are skipped while the good rows are committed.
+// When more rows fail, the import is rolled back and ErrErrorBudgetExceeded is returned.
+func WithMaxErrors(maxErrors int) ImportOption {
+	return func(c *ImportConfig) {
+		c.MaxErrors = maxErrors
+	}
+}
+
+// WithRejectFile writes the failing rows to a .csv file, with their original line number and error message appended.
+// The file is only created when rows failed.
+func WithRejectFile(filePath string) ImportOption {
+	return func(c *ImportConfig) {
+		c.RejectFilePath = filePath
+	}
+}
+
+// RowFailure describes why a row could not be imported.
+// Line is the line number within the CSV file, or the 1-based position of the row for data that is not read from a file.
+type RowFailure struct {
+	Line   int
+	Column string
+	Reason string
+	Record []string
+	Err    error
+}
+
+// ImportResult summarises an import.
+type ImportResult struct {
+	Table        string
+	FilePath     string
+	DryRun       bool
+	RowsRead     int
+	BytesRead    int64
+	RowsLoaded   int
+	RowsRejected int
+	Failures     []*RowFailure
+	Sequences    []*SequenceResync
+	Checkpoint   *ImportCheckpoint
+	Duration     time.Duration
+	load         *bulkLoad
+}
+
+// RowsPerSecond returns the throughput of the import.
+func (r *ImportResult) RowsPerSecond() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.RowsRead) / r.Duration.Seconds()
+}
+
+// Err returns an ImportError when a dry run found failing rows, and nil otherwise.
+func (r *ImportResult) Err() error {
+	if r.DryRun && len(r.Failures) > 0 {
+		return &ImportError{Table: r.Table, Failures: r.Failures}
+	}
+	return nil
+}
+
+// ImportError is returned when rows of an import failed.
+type ImportError struct {
+	Table    string
+	Failures []*RowFailure
+}
+
+// Error returns the description of the first failure and the number of failures.
+func (e *ImportError) Error() string {
+	first := e.Failures[0]
+	location := fmt.Sprintf("line %d", first.Line)
+	if first.Column != "" {
+		location += fmt.Sprintf(", column %s", first.Column)
+	}
+	return fmt.Sprintf("%d rows failed to import into %s; first at %s: %s", len(e.Failures), e.Table, location, first.Reason)
+}
+
+// sourceRow represents a row to import, along with where it originates from.
+type sourceRow struct {
+	line   int
+	record []string
+	values []interface{}
+}
+
+// rowSource represents a source of rows to import, which returns io.EOF when exhausted.
+type rowSource interface {
+	next() (*sourceRow, error)
+	headers() []string
+	offset() int64
+	total() (int, int64)
+}
+
+// csvSource reads the rows of a CSV file, skipping its headers.
+// The number of fields is not enforced, so rows with missing or extra fields fail as any other invalid row.
+// Its lines are shifted by lineOffset, for readers starting further into a file.
+type csvSource struct {
+	reader     *csv.Reader
+	header     []string
+	size       int64
+	lineOffset int
+	nextLine   int
+	started    bool
+}
+
+// newCSVSource creates a new instance of csvSource.
+func newCSVSource(reader io.Reader) *csvSource {
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	return &csvSource{reader: csvReader}
+}
+
+// next reads the next record along with its line number.
+func (s *csvSource) next() (*sourceRow, error) {
+	if !s.started {
+		s.started = true
+		header, err := s.reader.Read()
+		if err != nil {
+			return nil, s.wrap(err)
+		}
+		s.header = header
+	}
+
+	record, err := s.reader.Read()
+	if err != nil {
+		return nil, s.wrap(err)
+	}
+
+	line, _ := s.reader.FieldPos(0)
+	line += s.lineOffset
+	s.nextLine = line + 1
+	values := make([]interface{}, len(record))
+	for i, v := range record {
+		values[i] = v
+		s.nextLine += strings.Count(v, "\n")
+	}
+	return &sourceRow{line: line, record: record, values: values}, nil
+}
+
+// headers returns the headers of the CSV file, once read.
+func (s *csvSource) headers() []string {
+	return s.header
+}
+
+// offset returns the number of bytes read up to the end of the last record.
+func (s *csvSource) offset() int64 {
+	return s.reader.InputOffset()
+}
+
+// total returns the size of the file, when known.
+func (s *csvSource) total() (int, int64) {
+	return 0, s.size
+}
+
+// wrap wraps reading errors, leaving io.EOF as is.
+func (s *csvSource) wrap(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.EOF
+	}
+	return fmt.Errorf("failed to read the CSV: %w", err)
+}
+
+// sliceSource provides rows held in memory, numbered by their 1-based position.
+type sliceSource struct {
+	data  [][]interface{}
+	index int
+}
+
+// newSliceSource creates a new instance of sliceSource.
+func newSliceSource(data [][]interface{}) *sliceSource {
+	return &sliceSource{data: data}
+}
+
+// next returns the next row.
+func (s *sliceSource) next() (*sourceRow, error) {
+	if s.index >= len(s.data) {
+		return nil, io.EOF
+	}
+	s.index++
+	values := append([]interface{}{}, s.data[s.index-1]...)
+	record := make([]string, len(values))
+	for i, v := range values {
+		record[i] = fmt.Sprint(v)
+	}
+	return &sourceRow{line: s.index, record: record, values: values}, nil
+}
+
+// headers returns no headers, as the data holds none.
+func (s *sliceSource) headers() []string {
+	return nil
+}
+
+// offset returns zero, as no bytes are read.
+func (s *sliceSource) offset() int64 {
+	return 0
+}
+
+// total returns the number of rows.
+func (s *sliceSource) total() (int, int64) {
+	return len(s.data), 0
+}
+
+// ImportCSVFile imports the records of a .csv file into the table and reports the outcome.
+func (d *DbSvc) ImportCSVFile(ctx context.Context, filePath, table string, fields []string, options ...ImportOption) (*ImportResult, error) {
+	config := newImportConfig(options)
+	if config.ResumeID != "" && !config.DryRun {
+		return d.importCSVResumable(ctx, filePath, table, fields, config)
+	}
+	if config.Workers > 1 {
+		return d.importCSVParallel(ctx, filePath, table, fields, config)
+	}
+
+	result := &ImportResult{Table: table, FilePath: filePath, DryRun: config.DryRun}
+	err := d.importInTransaction(ctx, config, []*ImportResult{result}, func(tx *sql.Tx) error {
+		return importCSV(ctx, tx, fields, config, result)
+	})
+	return result, err
+}
+
+// importCSV imports the .csv file of the result into its table within the transaction.
+func importCSV(ctx context.Context, tx *sql.Tx, fields []string, config *ImportConfig, result *ImportResult) error {
+	start := time.Now()
+	defer func() { result.Duration = time.Since(start) }()
+
+	var err error
+	if result.load, err = prepareBulkLoad(ctx, tx, result.Table, config); err != nil {
+		return err
+	}
+
+	if err = stageCSV(ctx, tx, result.Table, fields, config, result); err != nil {
+		return err
+	}
+
+	if err = result.load.restore(ctx, tx); err != nil {
+		return err
+	}
+	return resyncImportedSequences(ctx, tx, config, result)
+}
+
+// stageCSV copies the .csv file of the result into the target table within the transaction.
+// The reject file is written regardless of the outcome.
+func stageCSV(ctx context.Context, tx *sql.Tx, target string, fields []string, config *ImportConfig, result *ImportResult) error {
+	file, err := os.Open(result.FilePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	source := newCSVSource(file)
+	if info, statErr := file.Stat(); statErr == nil {
+		source.size = info.Size()
+	}
+	err = newImporter(tx, target, fields, config, result).run(ctx, source)
+	return errors.Join(err, writeRejectFile(config, source.headers(), fields, result))
+}
+
+// resyncImportedSequences advances the sequences of the table of the result, when configured.
+func resyncImportedSequences(ctx context.Context, tx *sql.Tx, config *ImportConfig, result *ImportResult) error {
+	if !config.ResyncSequences {
+		return nil
+	}
+
+	var err error
+	result.Sequences, err = resyncSequences(ctx, tx, []string{result.Table})
+	return err
+}
+
+// ImportRows imports the data into the table through a temporary table, ignoring conflicting rows, and reports the outcome.
+// When failing rows are captured, such as in a dry run, rows violating the constraints of the table are inserted one by one
+// to capture each of them.
+func (d *DbSvc) ImportRows(ctx context.Context, table string, fields []string, data [][]interface{}, options ...ImportOption) (*ImportResult, error) {
+	config := newImportConfig(options)
+	result := &ImportResult{Table: table, DryRun: config.DryRun}
+	source := newSliceSource(data)
+	start := time.Now()
+	err := d.importInTransaction(ctx, config, []*ImportResult{result}, func(tx *sql.Tx) error {
+		// Create a temporary table
+		tempTable := fmt.Sprintf("%s_temp_%d", table, time.Now().UnixNano())
+		_, err := tx.ExecContext(ctx, fmt.Sprintf("CREATE TEMPORARY TABLE \"%s\" (LIKE \"%s\") ON COMMIT DROP", tempTable, table))
+		if err != nil {
+			return fmt.Errorf("failed creating temporary table: %w", ClassifyError(err))
+		}
+
+		// Copy data into temp table
+		staged := newImporter(tx, tempTable, fields, config, result)
+		if err = staged.run(ctx, source); err != nil {
+			return err
+		}
+
+		if result.load, err = prepareBulkLoad(ctx, tx, table, config); err != nil {
+			return err
+		}
+
+		// Insert from temp table to main table, ignoring conflicts
+		if staged.isTolerant() {
+			if _, err = tx.ExecContext(ctx, "SAVEPOINT import_rows"); err != nil {
+				return fmt.Errorf("failed inserting from temporary table: %w", ClassifyError(err))
+			}
+		}
+		inserted, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO \"%s\" SELECT * FROM \"%s\" ON CONFLICT DO NOTHING", table, tempTable))
+		var affected int64
+		if err == nil {
+			affected, err = inserted.RowsAffected()
+		}
+		switch {
+		case err != nil && staged.isTolerant() && !isFatalImportError(err):
+			if _, err = tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT import_rows"); err != nil {
+				return fmt.Errorf("failed inserting from temporary table: %w", ClassifyError(err))
+			}
+			if affected, err = newImporter(tx, table, fields, config, result).insertRows(ctx, newSliceSource(data)); err != nil {
+				return err
+			}
+		case err != nil:
+			return fmt.Errorf("failed inserting from temporary table: %w", ClassifyError(err))
+		}
+		result.RowsLoaded = int(affected)
+		if err = result.load.restore(ctx, tx); err != nil {
+			return err
+		}
+		return resyncImportedSequences(ctx, tx, config, result)
+	})
+	result.Duration = time.Since(start)
+	return result, errors.Join(err, writeRejectFile(config, source.headers(), fields, result))
+}
+
+// writeRejectFile writes the failing rows to the reject file, when configured, with their line number and error message appended.
+// Without headers in the source, the fields are used as headers instead.
+func writeRejectFile(config *ImportConfig, headers, fields []string, result *ImportResult) error {
+	if config.RejectFilePath == "" || len(result.Failures) == 0 {
+		return nil
+	}
+	if headers == nil {
+		headers = fields
+	}
+
+	file, err := os.Create(config.RejectFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to create reject file: %w", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if err = writer.Write(append(append([]string{}, headers...), "line", "error")); err != nil {
+		return fmt.Errorf("failed to write reject file: %w", err)
+	}
+	for _, failure := range result.Failures {
+		record := append(append([]string{}, failure.Record...), strconv.Itoa(failure.Line), failure.Reason)
+		if err = writer.Write(record); err != nil {
+			return fmt.Errorf("failed to write reject file: %w", err)
+		}
+	}
+
+	writer.Flush()
+	if err = writer.Error(); err != nil {
+		return fmt.Errorf("failed to write reject file: %w", err)
+	}
+	return nil
+}
+
+// importInTransaction executes fn within a transaction, which is rolled back for a dry run and committed otherwise.
+// When the import fails, no rows of the results are reported as loaded.
+func (d *DbSvc) importInTransaction(ctx context.Context, config *ImportConfig, results []*ImportResult, fn func(tx *sql.Tx) error) error {
+	err := d.runImportTransaction(ctx, config, fn)
+	if err != nil {
+		for _, result := range results {
+			result.RowsLoaded = 0
+		}
+		return err
+	}
+	return d.finishBulkLoads(ctx, config, results)
+}
+
+// finishBulkLoads recreates the indexes dropped by the committed imports of the results.
+func (d *DbSvc) finishBulkLoads(ctx context.Context, config *ImportConfig, results []*ImportResult) error {
+	if config.DryRun {
+		return nil
+	}
+
+	var errs []error
+	for _, result := range results {
+		errs = append(errs, d.RunGuarded(false, func(db *sql.DB) error {
+			return result.load.finish(ctx, db)
+		}))
+	}
+	return errors.Join(errs...)
+}
+
+// runImportTransaction executes fn within a transaction, in which constraints are deferred when configured.
+func (d *DbSvc) runImportTransaction(ctx context.Context, config *ImportConfig, fn func(tx *sql.Tx) error) error {
+	if config.DropIndexes {
+		if err := d.createDroppedIndexesTable(ctx); err != nil {
+			return err
+		}
+	}
+
+	txn, err := d.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed starting transaction: %w", ClassifyError(err))
+	}
+	defer txn.Rollback()
+
+	if config.DeferConstraints {
+		if _, err = txn.ExecContext(ctx, "SET CONSTRAINTS ALL DEFERRED"); err != nil {
+			return fmt.Errorf("failed deferring constraints: %w", ClassifyError(err))
+		}
+	}
+
+	if err = fn(txn); err != nil {
+		return err
+	}
+
+	if config.DryRun {
+		// Deferred constraints are only checked on commit, which a dry run never reaches
+		if _, err = txn.ExecContext(ctx, "SET CONSTRAINTS ALL IMMEDIATE"); err != nil {
+			return fmt.Errorf("failed checking deferred constraints: %w", ClassifyError(err))
+		}
+		return nil
+	}
+
+	if err = txn.Commit(); err != nil {
+		return fmt.Errorf("failed committing transaction: %w", ClassifyError(err))
+	}
+
+	return nil
+}
+
+// importer copies rows into a table in batches, isolating failing rows when they are tolerated.
+type importer struct {
+	tx       *sql.Tx
+	table    string
+	fields   []string
+	config   *ImportConfig
+	result   *ImportResult
+	progress *progressTracker
+}
+
+// newImporter creates a new instance of importer; progress is reported under the table of the result.
+func newImporter(tx *sql.Tx, table string, fields []string, config *ImportConfig, result *ImportResult) *importer {
+	return &importer{
+		tx:       tx,
+		table:    table,
+		fields:   fields,
+		config:   config,
+		result:   result,
+		progress: newProgressTracker(result.Table, config),
+	}
+}
+
+// isTolerant checks whether failing rows are captured instead of aborting the import.
+func (im *importer) isTolerant() bool {
+	return im.config.DryRun || im.config.MaxErrors > 0
+}
+
+// run reads the rows from the source and copies them batch by batch.
+// When the context is canceled, the import stops and the error describes how far it got.
+func (im *importer) run(ctx context.Context, source rowSource) (err error) {
+	im.progress.progress.TotalRows, im.progress.progress.TotalBytes = source.total()
+	defer func() {
+		im.result.BytesRead = source.offset()
+		if err != nil && ctx.Err() != nil {
+			err = fmt.Errorf("import into %s canceled after %d rows and %d bytes: %w", im.result.Table, im.result.RowsRead,
+				im.result.BytesRead, ClassifyError(ctx.Err()))
+		}
+	}()
+
+	batch := make([]*sourceRow, 0, im.config.BatchSize)
+	for {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		row, err := source.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		im.result.RowsRead++
+		im.progress.update(im.result.RowsRead, source.offset())
+		if field, err := im.config.coerce(im.fields, row); err != nil {
+			if !im.isTolerant() {
+				return fmt.Errorf("failed to coerce line %d, column %s: %w", row.line, field, err)
+			}
+			if err = im.fail(row, field, err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		batch = append(batch, row)
+		if len(batch) >= im.config.BatchSize {
+			if err = im.copyBatch(ctx, batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	if err = im.copyBatch(ctx, batch); err != nil {
+		return err
+	}
+	im.progress.report()
+	return nil
+}
+
+// copyBatch copies the batch. When failures are tolerated, failing rows are isolated and skipped:
+// the row reported by Postgres is taken out, otherwise the segment is split in halves until the failing row is found.
+func (im *importer) copyBatch(ctx context.Context, batch []*sourceRow) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	if !im.isTolerant() {
+		if err := im.copySegment(ctx, batch); err != nil {
+			index, _ := failedIndex(err, len(batch))
+			if index >= 0 {
+				return fmt.Errorf("failed to copy line %d: %w", batch[index].line, ClassifyError(err))
+			}
+			return fmt.Errorf("failed to copy rows: %w", ClassifyError(err))
+		}
+		im.result.RowsLoaded += len(batch)
+		return nil
+	}
+
+	segments := [][]*sourceRow{batch}
+	for len(segments) > 0 {
+		segment := segments[0]
+		segments = segments[1:]
+		if len(segment) == 0 {
+			continue
+		}
+
+		err := im.copySegment(ctx, segment)
+		if err == nil {
+			im.result.RowsLoaded += len(segment)
+			continue
+		}
+		if isFatalImportError(err) {
+			return fmt.Errorf("failed to copy rows: %w", ClassifyError(err))
+		}
+
+		index, column := failedIndex(err, len(segment))
+		switch {
+		case index >= 0:
+			if err = im.fail(segment[index], column, err); err != nil {
+				return err
+			}
+			segments = append([][]*sourceRow{segment[:index], segment[index+1:]}, segments...)
+		case len(segment) == 1:
+			if err = im.fail(segment[0], column, err); err != nil {
+				return err
+			}
+		default:
+			middle := len(segment) / 2
+			segments = append([][]*sourceRow{segment[:middle], segment[middle:]}, segments...)
+		}
+	}
+	return nil
+}
+
+// copySegment copies the rows with a single COPY statement; when tolerant, within a savepoint which is rolled back on failure.
+func (im *importer) copySegment(ctx context.Context, rows []*sourceRow) error {
+	if im.isTolerant() {
+		if _, err := im.tx.ExecContext(ctx, "SAVEPOINT import_segment"); err != nil {
+			return err
+		}
+	}
+
+	err := im.copy(ctx, rows)
+	if !im.isTolerant() {
+		return err
+	}
+
+	if err != nil {
+		if _, rollbackErr := im.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT import_segment"); rollbackErr != nil {
+			return rollbackErr
+		}
+		return err
+	}
+
+	_, err = im.tx.ExecContext(ctx, "RELEASE SAVEPOINT import_segment")
+	return err
+}
+
+// copy streams the rows into the table with a COPY statement.
+func (im *importer) copy(ctx context.Context, rows []*sourceRow) error {
+	statement, err := im.tx.PrepareContext(ctx, pq.CopyIn(im.table, im.fields...))
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if _, err = statement.ExecContext(ctx, row.values...); err != nil {
+			statement.Close()
+			return err
+		}
+	}
+
+	return statement.Close()
+}
+
+// insertRows inserts the rows of the source one by one, each within a savepoint, ignoring conflicting rows, and returns
+// the number of inserted rows. Every row violating the constraints of the table is registered as failed; rows which
+// already failed are skipped.
+func (im *importer) insertRows(ctx context.Context, source rowSource) (int64, error) {
+	failed := make(map[int]bool, len(im.result.Failures))
+	for _, failure := range im.result.Failures {
+		failed[failure.Line] = true
+	}
+
+	placeholders := make([]string, len(im.fields))
+	for i := range im.fields {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT DO NOTHING", pq.QuoteIdentifier(im.table),
+		strings.Join(quoteIdentifiers(im.fields), ", "), strings.Join(placeholders, ", "))
+
+	var inserted int64
+	for {
+		row, err := source.next()
+		if errors.Is(err, io.EOF) {
+			return inserted, nil
+		}
+		if err != nil {
+			return inserted, err
+		}
+		if failed[row.line] {
+			continue
+		}
+		if _, err = im.config.coerce(im.fields, row); err != nil {
+			continue
+		}
+
+		if _, err = im.tx.ExecContext(ctx, "SAVEPOINT import_row"); err != nil {
+			return inserted, fmt.Errorf("failed to insert line %d: %w", row.line, ClassifyError(err))
+		}
+		changed, err := im.tx.ExecContext(ctx, query, row.values...)
+		if err != nil {
+			if isFatalImportError(err) {
+				return inserted, fmt.Errorf("failed to insert line %d: %w", row.line, ClassifyError(err))
+			}
+			if _, rollbackErr := im.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT import_row"); rollbackErr != nil {
+				return inserted, fmt.Errorf("failed to insert line %d: %w", row.line, ClassifyError(rollbackErr))
+			}
+			if err = im.fail(row, "", err); err != nil {
+				return inserted, err
+			}
+			continue
+		}
+
+		affected, err := changed.RowsAffected()
+		if err != nil {
+			return inserted, fmt.Errorf("failed to insert line %d: %w", row.line, ClassifyError(err))
+		}
+		inserted += affected
+		if _, err = im.tx.ExecContext(ctx, "RELEASE SAVEPOINT import_row"); err != nil {
+			return inserted, fmt.Errorf("failed to insert line %d: %w", row.line, ClassifyError(err))
+		}
+	}
+}
+
+// fail registers the row as failed, and returns ErrErrorBudgetExceeded when the error budget is used up.
+// A dry run captures every failure regardless of the error budget.
+func (im *importer) fail(row *sourceRow, column string, err error) error {
+	failure := &RowFailure{Line: row.line, Column: column, Reason: err.Error(), Record: row.record, Err: ClassifyError(err)}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		failure.Reason = pqErr.Message
+		if failure.Column == "" {
+			failure.Column = pqErr.Column
+		}
+	}
+	im.result.Failures = append(im.result.Failures, failure)
+	im.result.RowsRejected++
+
+	if !im.config.DryRun && im.result.RowsRejected > im.config.MaxErrors {
+		return fmt.Errorf("%w: %d rows failed, first at line %d: %s", ErrErrorBudgetExceeded, im.result.RowsRejected,
+			im.result.Failures[0].Line, im.result.Failures[0].Reason)
+	}
+	return nil
+}
+
+// failedIndex returns the index of the failing row within the COPY as reported by Postgres, or -1 when it is unknown.
+func failedIndex(err error, rows int) (int, string) {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return -1, ""
+	}
+
+	match := copyContextPattern.FindStringSubmatch(pqErr.Where)
+	if match == nil {
+		return -1, pqErr.Column
+	}
+
+	line, convErr := strconv.Atoi(match[1])
+	if convErr != nil || line < 1 || line > rows {
+		return -1, match[2]
+	}
+	return line - 1, match[2]
+}
+
+// isFatalImportError checks whether the error prevents continuing the import, as opposed to being caused by a row.
+func isFatalImportError(err error) bool {
+	classified := ClassifyError(err)
+	if errors.Is(classified, ErrConnectionLost) || errors.Is(classified, ErrQueryCanceled) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return true
+	}
+	switch pqErr.Code.Class() {
+	case "22", "23":
+		return false
+	}
+	return pqErr.Code != "42804"
+}
@@ -0,0 +1,131 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ImportStep represents a .csv file to import into a table as part of an ImportPlan.
+type ImportStep struct {
+	FilePath string
+	Table    string
+	Fields   []string
+	Options  []ImportOption
+}
+
+// NewImportStep creates a new instance of ImportStep; its options are applied after those of the plan.
+func NewImportStep(filePath, table string, fields []string, options ...ImportOption) *ImportStep {
+	return &ImportStep{FilePath: filePath, Table: table, Fields: fields, Options: options}
+}
+
+// ImportPlan represents several imports which are run in order, as a single transaction.
+type ImportPlan struct {
+	Steps   []*ImportStep
+	Options []ImportOption
+}
+
+// NewImportPlan creates a new instance of ImportPlan. Its options apply to every step;
+// whether the plan is a dry run and defers constraints is only taken from these options, as it concerns the whole transaction.
+// The steps share that transaction, so a plan in which WithWorkers or WithResume applies to a step is refused when run.
+func NewImportPlan(options ...ImportOption) *ImportPlan {
+	return &ImportPlan{Options: options}
+}
+
+// AddStep adds a step importing the .csv file into the table.
+func (p *ImportPlan) AddStep(filePath, table string, fields []string, options ...ImportOption) *ImportPlan {
+	p.Steps = append(p.Steps, NewImportStep(filePath, table, fields, options...))
+	return p
+}
+
+// ImportPlanResult summarises an import plan, with the outcome of each step in order.
+type ImportPlanResult struct {
+	DryRun   bool
+	Steps    []*ImportResult
+	Duration time.Duration
+}
+
+// RowsLoaded returns the number of rows loaded over all steps.
+func (r *ImportPlanResult) RowsLoaded() int {
+	loaded := 0
+	for _, step := range r.Steps {
+		loaded += step.RowsLoaded
+	}
+	return loaded
+}
+
+// Err returns an ImportError for the first step of a dry run with failing rows, and nil otherwise.
+func (r *ImportPlanResult) Err() error {
+	for _, step := range r.Steps {
+		if err := step.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunImportPlan runs the steps of the plan in order within a single transaction, so either every file is imported or none.
+// The result holds the steps which have been run, including the one that failed.
+func (d *DbSvc) RunImportPlan(ctx context.Context, plan *ImportPlan) (*ImportPlanResult, error) {
+	config := newImportConfig(plan.Options)
+	result := &ImportPlanResult{DryRun: config.DryRun}
+	start := time.Now()
+
+	stepConfigs, err := plan.stepConfigs(config)
+	if err != nil {
+		return result, err
+	}
+
+	dropsIndexes := false
+	for _, stepConfig := range stepConfigs {
+		dropsIndexes = dropsIndexes || stepConfig.DropIndexes
+	}
+
+	// Only the options of the plan reach the transaction, so the dropped_indexes table is created for its steps here
+	if dropsIndexes && !config.DropIndexes {
+		if err := d.createDroppedIndexesTable(ctx); err != nil {
+			return result, err
+		}
+	}
+
+	err = d.runImportTransaction(ctx, config, func(tx *sql.Tx) error {
+		for i, step := range plan.Steps {
+			stepConfig := stepConfigs[i]
+			stepResult := &ImportResult{Table: step.Table, FilePath: step.FilePath, DryRun: config.DryRun}
+			result.Steps = append(result.Steps, stepResult)
+			if err := importCSV(ctx, tx, step.Fields, stepConfig, stepResult); err != nil {
+				return fmt.Errorf("failed step %d, importing %s into %s: %w", i+1, step.FilePath, step.Table, err)
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		for _, step := range result.Steps {
+			step.RowsLoaded = 0
+		}
+	} else {
+		err = d.finishBulkLoads(ctx, config, result.Steps)
+	}
+	result.Duration = time.Since(start)
+	return result, err
+}
+
+// stepConfigs combines the options of the plan with those of every step, refusing those which cannot be honoured within
+// the single transaction of the plan.
+func (p *ImportPlan) stepConfigs(config *ImportConfig) ([]*ImportConfig, error) {
+	configs := make([]*ImportConfig, len(p.Steps))
+	for i, step := range p.Steps {
+		stepConfig := newImportConfig(append(append([]ImportOption{}, p.Options...), step.Options...))
+		if stepConfig.Workers > 1 {
+			return nil, fmt.Errorf("step %d, importing %s into %s: workers are not supported within an import plan", i+1, step.FilePath, step.Table)
+		}
+		if stepConfig.ResumeID != "" {
+			return nil, fmt.Errorf("step %d, importing %s into %s: resuming is not supported within an import plan", i+1, step.FilePath, step.Table)
+		}
+		stepConfig.DryRun, stepConfig.DeferConstraints = config.DryRun, config.DeferConstraints
+		configs[i] = stepConfig
+	}
+	return configs, nil
+}
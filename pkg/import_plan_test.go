@@ -0,0 +1,27 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// TestImportPlanStepConfigs tests whether the options of the plan apply to every step, and whether options which
+// cannot be honoured within its transaction are refused.
+func TestImportPlanStepConfigs(t *testing.T) {
+	plan := NewImportPlan(WithBatchSize(10)).
+		AddStep("customers.csv", "customers", []string{"id"}).
+		AddStep("orders.csv", "orders", []string{"id"}, WithBatchSize(20), WithDryRun())
+	configs, err := plan.stepConfigs(newImportConfig(plan.Options))
+	assert.NoError(t, err)
+	assert.Equal(t, 10, configs[0].BatchSize)
+	assert.Equal(t, 20, configs[1].BatchSize)
+	assert.False(t, configs[1].DryRun)
+
+	plan = NewImportPlan().AddStep("orders.csv", "orders", []string{"id"}, WithWorkers(4))
+	_, err = plan.stepConfigs(newImportConfig(nil))
+	assert.Error(t, err)
+
+	plan = NewImportPlan(WithResume("orders")).AddStep("orders.csv", "orders", []string{"id"})
+	_, err = plan.stepConfigs(newImportConfig(nil))
+	assert.Error(t, err)
+}
@@ -0,0 +1,109 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestFailedIndex tests whether the failing row of a COPY is located through the context reported by Postgres.
+func TestFailedIndex(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		index  int
+		column string
+	}{
+		{
+			name:   "Invalid value",
+			err:    &pq.Error{Code: "22P02", Where: `COPY contacts, line 3, column id: "abc"`},
+			index:  2,
+			column: "id",
+		},
+		{
+			name:  "Unique violation",
+			err:   fmt.Errorf("wrapped: %w", &pq.Error{Code: "23505", Where: "COPY contacts, line 1"}),
+			index: 0,
+		},
+		{
+			name:   "Not null violation without context",
+			err:    &pq.Error{Code: "23502", Column: "name"},
+			index:  -1,
+			column: "name",
+		},
+		{
+			name:  "Line beyond the rows",
+			err:   &pq.Error{Code: "22P02", Where: "COPY contacts, line 9"},
+			index: -1,
+		},
+		{
+			name:  "Other error",
+			err:   errors.New("broken pipe"),
+			index: -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			index, column := failedIndex(tt.err, 5)
+			assert.Equal(t, tt.index, index)
+			assert.Equal(t, tt.column, column)
+		})
+	}
+}
+
+// TestCSVSourceLines tests whether rows read from a CSV keep the line they start at, including quoted newlines.
+func TestCSVSourceLines(t *testing.T) {
+	source := newCSVSource(strings.NewReader("id,name\n1,\"John\nDoe\"\n2,Jane\n"))
+
+	var lines []int
+	for {
+		row, err := source.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		assert.NoError(t, err)
+		lines = append(lines, row.line)
+	}
+
+	assert.Equal(t, []int{2, 4}, lines)
+}
+
+// TestImportResultErr tests whether only dry runs with failures return an error.
+func TestImportResultErr(t *testing.T) {
+	failures := []*RowFailure{{Line: 3, Column: "id", Reason: "invalid input syntax"}}
+
+	assert.NoError(t, (&ImportResult{Table: "contacts", DryRun: true}).Err())
+	assert.NoError(t, (&ImportResult{Table: "contacts", Failures: failures}).Err())
+
+	err := (&ImportResult{Table: "contacts", DryRun: true, Failures: failures}).Err()
+	var importErr *ImportError
+	assert.ErrorAs(t, err, &importErr)
+	assert.Equal(t, "1 rows failed to import into contacts; first at line 3, column id: invalid input syntax", err.Error())
+}
+
+// TestWriteRejectFile tests whether failing rows are written with their line number and error message appended.
+func TestWriteRejectFile(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "rejects.csv")
+	config := newImportConfig([]ImportOption{WithRejectFile(filePath)})
+	result := &ImportResult{Failures: []*RowFailure{
+		{Line: 3, Reason: "invalid input syntax", Record: []string{"abc", "Jane Doe"}},
+	}}
+
+	err := writeRejectFile(config, []string{"id", "name"}, nil, result)
+	assert.NoError(t, err)
+
+	records, err := GetCSVRecords(filePath, true)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"id", "name", "line", "error"}, {"abc", "Jane Doe", "3", "invalid input syntax"}}, records)
+	// Without failures, no file is created
+	filePath = filepath.Join(t.TempDir(), "rejects.csv")
+	config = newImportConfig([]ImportOption{WithRejectFile(filePath)})
+	assert.NoError(t, writeRejectFile(config, []string{"id", "name"}, nil, &ImportResult{}))
+	assert.NoFileExists(t, filePath)
+}
@@ -0,0 +1,296 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+	"log"
+	"sync"
+	"time"
+)
+
+// OutboxEvent represents an event which is stored in the outbox until it has been published.
+type OutboxEvent struct {
+	ID           int64
+	AggregateKey string
+	Type         string
+	Payload      []byte
+	CreatedAt    time.Time
+	Attempts     int
+}
+
+// Publisher represents a destination to which outbox events are dispatched.
+type Publisher interface {
+	Publish(ctx context.Context, event *OutboxEvent) error
+}
+
+// OutboxSvcOption is used to instantiate an OutboxSvc with the provided settings/configurations/actions.
+type OutboxSvcOption func(*OutboxSvc)
+
+// OutboxOps represents operations related to the transactional outbox.
+type OutboxOps interface {
+	CreateOutboxTable() error
+	Enqueue(tx *sql.Tx, events ...*OutboxEvent) error
+	Relay(ctx context.Context) (int, error)
+	StartRelay()
+	StopRelay()
+}
+
+// OutboxSvc stores events in the same transaction as the business change and relays them to a Publisher.
+// An event which failed to be published MaxAttempts times is dead-lettered: it is kept, along with its last error, but no
+// longer relayed, so the events following it of the same aggregate key are relayed instead. Clearing its dead_at retries it.
+type OutboxSvc struct {
+	Database       *DbSvc
+	Publisher      Publisher
+	Table          string
+	BatchSize      int
+	MaxAttempts    int
+	Interval       time.Duration
+	IsRelayEnabled bool
+}
+
+// NewOutboxSvc creates a new instance of OutboxSvc.
+func NewOutboxSvc(database *DbSvc, publisher Publisher, options ...OutboxSvcOption) *OutboxSvc {
+	outbox := &OutboxSvc{
+		Database:    database,
+		Publisher:   publisher,
+		Table:       "outbox",
+		BatchSize:   100,
+		MaxAttempts: 10,
+		Interval:    time.Second,
+	}
+	for _, option := range options {
+		option(outbox)
+	}
+	return outbox
+}
+
+// WithOutboxTable sets the name of the table in which the events are stored.
+func WithOutboxTable(table string) OutboxSvcOption {
+	return func(o *OutboxSvc) {
+		o.Table = table
+	}
+}
+
+// WithOutboxBatchSize sets the maximum number of events dispatched per relay round.
+func WithOutboxBatchSize(size int) OutboxSvcOption {
+	return func(o *OutboxSvc) {
+		o.BatchSize = size
+	}
+}
+
+// WithOutboxMaxAttempts sets the number of failed attempts after which an event is dead-lettered; 0 retries it forever.
+func WithOutboxMaxAttempts(attempts int) OutboxSvcOption {
+	return func(o *OutboxSvc) {
+		o.MaxAttempts = attempts
+	}
+}
+
+// WithOutboxInterval sets the time the relay waits when there are no events to dispatch.
+func WithOutboxInterval(interval time.Duration) OutboxSvcOption {
+	return func(o *OutboxSvc) {
+		o.Interval = interval
+	}
+}
+
+// CreateOutboxTable creates the outbox table, if it does not exist yet.
+func (o *OutboxSvc) CreateOutboxTable() error {
+	table := pq.QuoteIdentifier(o.Table)
+	return o.Database.RunGuarded(false, func(db *sql.DB) error {
+		_, err := db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			id bigserial PRIMARY KEY,
+			aggregate_key text NOT NULL,
+			event_type text NOT NULL,
+			payload bytea,
+			created_at timestamptz NOT NULL DEFAULT now(),
+			delivered_at timestamptz,
+			attempts int NOT NULL DEFAULT 0,
+			last_error text,
+			dead_at timestamptz
+		)`, table))
+		if err != nil {
+			return fmt.Errorf("failed creating outbox table: %w", err)
+		}
+
+		// Outbox tables created before dead-lettering lack the column
+		if _, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS dead_at timestamptz", table)); err != nil {
+			return fmt.Errorf("failed adding dead_at column to outbox table: %w", err)
+		}
+
+		index := pq.QuoteIdentifier(o.Table + "_pending_idx")
+		_, err = db.Exec(fmt.Sprintf(
+			"CREATE INDEX IF NOT EXISTS %s ON %s (aggregate_key, id) WHERE delivered_at IS NULL", index, table))
+		if err != nil {
+			return fmt.Errorf("failed creating outbox index: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// Enqueue stores the events within the provided transaction, so they are only relayed when the transaction commits.
+func (o *OutboxSvc) Enqueue(tx *sql.Tx, events ...*OutboxEvent) error {
+	query := fmt.Sprintf(
+		"INSERT INTO %s (aggregate_key, event_type, payload) VALUES ($1, $2, $3) RETURNING id, created_at",
+		pq.QuoteIdentifier(o.Table))
+	for _, event := range events {
+		err := tx.QueryRow(query, event.AggregateKey, event.Type, event.Payload).Scan(&event.ID, &event.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed enqueuing event: %w", err)
+		}
+	}
+	return nil
+}
+
+// Relay dispatches a batch of pending events to the Publisher and marks the published ones as delivered.
+// Only the oldest pending event of every aggregate key is dispatched per round, which preserves the order per aggregate
+// until an event is dead-lettered.
+// Events are marked as delivered after being published, so an event is published at least once.
+func (o *OutboxSvc) Relay(ctx context.Context) (int, error) {
+	txn, err := o.Database.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed starting transaction: %w", err)
+	}
+	defer txn.Rollback()
+
+	events, err := o.pendingEvents(ctx, txn)
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for _, event := range events {
+		if err = o.Publisher.Publish(ctx, event); err != nil {
+			if err = o.markFailed(ctx, txn, event, err); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if err = o.markDelivered(ctx, txn, event); err != nil {
+			return 0, err
+		}
+		delivered++
+	}
+
+	if err = txn.Commit(); err != nil {
+		return 0, fmt.Errorf("failed committing transaction: %w", err)
+	}
+
+	return delivered, nil
+}
+
+// pendingEvents locks and retrieves the oldest pending event of every aggregate key, skipping dead-lettered events.
+func (o *OutboxSvc) pendingEvents(ctx context.Context, txn *sql.Tx) ([]*OutboxEvent, error) {
+	table := pq.QuoteIdentifier(o.Table)
+	rows, err := txn.QueryContext(ctx, fmt.Sprintf(`SELECT o.id, o.aggregate_key, o.event_type, o.payload, o.created_at, o.attempts
+		FROM %[1]s o
+		WHERE o.delivered_at IS NULL AND o.dead_at IS NULL
+		AND o.id = (SELECT min(p.id) FROM %[1]s p
+			WHERE p.aggregate_key = o.aggregate_key AND p.delivered_at IS NULL AND p.dead_at IS NULL)
+		ORDER BY o.id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED`, table), o.BatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed retrieving pending events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*OutboxEvent
+	for rows.Next() {
+		event := &OutboxEvent{}
+		err = rows.Scan(&event.ID, &event.AggregateKey, &event.Type, &event.Payload, &event.CreatedAt, &event.Attempts)
+		if err != nil {
+			return nil, fmt.Errorf("failed scanning pending event: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed retrieving pending events: %w", err)
+	}
+
+	return events, nil
+}
+
+// markDelivered marks the event as delivered.
+func (o *OutboxSvc) markDelivered(ctx context.Context, txn *sql.Tx, event *OutboxEvent) error {
+	query := fmt.Sprintf("UPDATE %s SET delivered_at = now() WHERE id = $1", pq.QuoteIdentifier(o.Table))
+	if _, err := txn.ExecContext(ctx, query, event.ID); err != nil {
+		return fmt.Errorf("failed marking event %d as delivered: %w", event.ID, err)
+	}
+	return nil
+}
+
+// markFailed registers a failed publishing attempt of the event, so it is retried in a later round,
+// unless it reached the maximum number of attempts, in which case it is dead-lettered.
+func (o *OutboxSvc) markFailed(ctx context.Context, txn *sql.Tx, event *OutboxEvent, cause error) error {
+	query := fmt.Sprintf(`UPDATE %s SET attempts = attempts + 1, last_error = $2,
+		dead_at = CASE WHEN $3 > 0 AND attempts + 1 >= $3 THEN now() END
+		WHERE id = $1`, pq.QuoteIdentifier(o.Table))
+	if _, err := txn.ExecContext(ctx, query, event.ID, cause.Error(), o.MaxAttempts); err != nil {
+		return fmt.Errorf("failed registering attempt of event %d: %w", event.ID, err)
+	}
+	return nil
+}
+
+// StartRelay continuously relays pending events until the relay is stopped.
+func (o *OutboxSvc) StartRelay() {
+	o.IsRelayEnabled = true
+	for {
+		if !o.IsRelayEnabled {
+			break
+		}
+		delivered, err := o.Relay(context.Background())
+		if err != nil {
+			log.Printf("Failed to relay outbox events: %s", err.Error())
+		}
+		if delivered == 0 {
+			time.Sleep(o.Interval)
+		}
+	}
+}
+
+// StopRelay disables the relay.
+func (o *OutboxSvc) StopRelay() {
+	o.IsRelayEnabled = false
+}
+
+// InMemoryPublisher is a Publisher which keeps the published events in memory.
+type InMemoryPublisher struct {
+	mu     sync.Mutex
+	events []*OutboxEvent
+	err    error
+}
+
+// NewInMemoryPublisher creates a new instance of InMemoryPublisher.
+func NewInMemoryPublisher() *InMemoryPublisher {
+	return &InMemoryPublisher{}
+}
+
+// Publish stores the event, unless a failure has been set.
+func (p *InMemoryPublisher) Publish(_ context.Context, event *OutboxEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	p.events = append(p.events, event)
+	return nil
+}
+
+// SetFailure makes every following Publish fail with the provided error; nil restores publishing.
+func (p *InMemoryPublisher) SetFailure(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
+
+// Events returns the events that have been published, in order of publishing.
+func (p *InMemoryPublisher) Events() []*OutboxEvent {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	events := make([]*OutboxEvent, len(p.events))
+	copy(events, p.events)
+	return events
+}
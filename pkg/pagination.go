@@ -0,0 +1,345 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"reflect"
+	"strings"
+)
+
+// ErrInvalidCursor is returned when a cursor is malformed, tampered with or belongs to another listing.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// SortColumn represents a column by which a page is ordered.
+type SortColumn struct {
+	Column     string
+	Descending bool
+}
+
+// PageRequest holds the data to retrieve a page with keyset pagination.
+// The Query is a SELECT statement without ORDER BY and LIMIT, of which the last sort column must be unique and no sort column may be NULL.
+type PageRequest struct {
+	Query  string
+	Args   []interface{}
+	Sort   []SortColumn
+	Limit  int
+	Cursor string
+}
+
+// OffsetPageRequest holds the data to retrieve a page with offset pagination, of which the Number starts at 1.
+type OffsetPageRequest struct {
+	Query  string
+	Args   []interface{}
+	Sort   []SortColumn
+	Size   int
+	Number int
+}
+
+// Page represents a page of items.
+type Page[T any] struct {
+	Items      []*T
+	HasNext    bool
+	HasPrev    bool
+	NextCursor string
+	PrevCursor string
+	Number     int
+	TotalCount int
+}
+
+// cursor represents the decoded content of an opaque cursor.
+type cursor struct {
+	Values    []interface{} `json:"v"`
+	Backward  bool          `json:"b"`
+	Signature string        `json:"s"`
+}
+
+// Paginator retrieves pages of query results, which are scanned into structs by their tags.
+type Paginator struct {
+	Database *DbSvc
+	Tag      string
+	secret   []byte
+}
+
+// NewPaginator creates a new instance of Paginator, which signs its cursors with the secret.
+func NewPaginator(database *DbSvc, secret []byte) *Paginator {
+	return &Paginator{Database: database, Tag: "db", secret: secret}
+}
+
+// EncodeCursor creates an opaque cursor pointing at the row with the provided sort values.
+func (p *Paginator) EncodeCursor(sort []SortColumn, values []interface{}, backward bool) (string, error) {
+	payload, err := json.Marshal(&cursor{Values: values, Backward: backward, Signature: sortSignature(sort)})
+	if err != nil {
+		return "", fmt.Errorf("failed encoding cursor: %w", err)
+	}
+
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(append(mac.Sum(nil), payload...)), nil
+}
+
+// DecodeCursor verifies and decodes the cursor, returning ErrInvalidCursor when it cannot be trusted.
+func (p *Paginator) DecodeCursor(sort []SortColumn, encoded string) ([]interface{}, bool, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(raw) < sha256.Size {
+		return nil, false, ErrInvalidCursor
+	}
+
+	signature, payload := raw[:sha256.Size], raw[sha256.Size:]
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write(payload)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, false, ErrInvalidCursor
+	}
+
+	decoded := &cursor{}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err = decoder.Decode(decoded); err != nil {
+		return nil, false, ErrInvalidCursor
+	}
+
+	if decoded.Signature != sortSignature(sort) || len(decoded.Values) != len(sort) {
+		return nil, false, ErrInvalidCursor
+	}
+
+	return decoded.Values, decoded.Backward, nil
+}
+
+// PaginateKeyset retrieves the page after (or before) the cursor of the request.
+func PaginateKeyset[T any](ctx context.Context, p *Paginator, request *PageRequest) (*Page[T], error) {
+	if len(request.Sort) == 0 {
+		return nil, errors.New("keyset pagination requires at least one sort column")
+	}
+	if request.Limit < 1 {
+		return nil, fmt.Errorf("page limit must be at least 1, got %d", request.Limit)
+	}
+
+	var values []interface{}
+	backward := false
+	if request.Cursor != "" {
+		var err error
+		values, backward, err = p.DecodeCursor(request.Sort, request.Cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	args := append([]interface{}{}, request.Args...)
+	query := fmt.Sprintf("SELECT * FROM (%s) AS page", request.Query)
+	if values != nil {
+		var condition string
+		condition, args = keysetCondition(request.Sort, values, backward, args)
+		query += " WHERE " + condition
+	}
+	args = append(args, request.Limit+1)
+	query += fmt.Sprintf(" ORDER BY %s LIMIT $%d", orderBy(request.Sort, backward), len(args))
+
+	items, err := queryPage[T](ctx, p, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page[T]{Items: items}
+	hasMore := len(items) > request.Limit
+	if hasMore {
+		page.Items = items[:request.Limit]
+	}
+	if backward {
+		for i, j := 0, len(page.Items)-1; i < j; i, j = i+1, j-1 {
+			page.Items[i], page.Items[j] = page.Items[j], page.Items[i]
+		}
+		page.HasPrev, page.HasNext = hasMore, true
+	} else {
+		page.HasPrev, page.HasNext = request.Cursor != "", hasMore
+	}
+
+	if len(page.Items) > 0 {
+		if page.HasNext {
+			if page.NextCursor, err = p.itemCursor(request.Sort, page.Items[len(page.Items)-1], false); err != nil {
+				return nil, err
+			}
+		}
+		if page.HasPrev {
+			if page.PrevCursor, err = p.itemCursor(request.Sort, page.Items[0], true); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return page, nil
+}
+
+// PaginateOffset retrieves the page with the requested number, along with the total count of rows.
+func PaginateOffset[T any](ctx context.Context, p *Paginator, request *OffsetPageRequest) (*Page[T], error) {
+	if request.Number < 1 {
+		return nil, fmt.Errorf("page number must be at least 1, got %d", request.Number)
+	}
+	if request.Size < 1 {
+		return nil, fmt.Errorf("page size must be at least 1, got %d", request.Size)
+	}
+
+	page := &Page[T]{Number: request.Number}
+	countQuery := fmt.Sprintf("SELECT count(*) FROM (%s) AS page", request.Query)
+	err := p.Database.runWithClaims(ctx, true, func(q queryer) error {
+		return q.QueryRowContext(ctx, countQuery, request.Args...).Scan(&page.TotalCount)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed counting rows: %w", err)
+	}
+
+	args := append([]interface{}{}, request.Args...)
+	args = append(args, request.Size, (request.Number-1)*request.Size)
+	query := fmt.Sprintf("SELECT * FROM (%s) AS page", request.Query)
+	if len(request.Sort) > 0 {
+		query += " ORDER BY " + orderBy(request.Sort, false)
+	}
+	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	if page.Items, err = queryPage[T](ctx, p, query, args); err != nil {
+		return nil, err
+	}
+
+	page.HasPrev = request.Number > 1
+	page.HasNext = request.Number*request.Size < page.TotalCount
+	return page, nil
+}
+
+// queryPage executes the page query and scans the rows into new instances of T.
+func queryPage[T any](ctx context.Context, p *Paginator, query string, args []interface{}) ([]*T, error) {
+	var scanned []interface{}
+	err := p.Database.runWithClaims(ctx, true, func(q queryer) error {
+		rows, err := q.QueryContext(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("failed querying page: %w", err)
+		}
+		defer rows.Close()
+
+		scanned, err = scanStructs(rows, reflect.TypeOf((*T)(nil)).Elem(), p.Tag)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*T, len(scanned))
+	for i, item := range scanned {
+		items[i] = item.(*T)
+	}
+	return items, nil
+}
+
+// itemCursor creates a cursor from the sort values of the item.
+func (p *Paginator) itemCursor(sort []SortColumn, item interface{}, backward bool) (string, error) {
+	names := GetFieldNames(p.Tag, item)
+	fields := GetFields(item)
+
+	values := make([]interface{}, len(sort))
+	for i, column := range sort {
+		found := false
+		for j, name := range names {
+			if name == column.Column {
+				values[i], found = fields[j], true
+				break
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("sort column %s is not mapped onto a field of %T", column.Column, item)
+		}
+	}
+
+	return p.EncodeCursor(sort, values, backward)
+}
+
+// keysetCondition builds the condition selecting the rows after the values, whilst respecting the direction per column.
+func keysetCondition(sort []SortColumn, values []interface{}, backward bool, args []interface{}) (string, []interface{}) {
+	var alternatives []string
+	for i, column := range sort {
+		var parts []string
+		for j := 0; j < i; j++ {
+			args = append(args, values[j])
+			parts = append(parts, fmt.Sprintf("page.%s = $%d", pq.QuoteIdentifier(sort[j].Column), len(args)))
+		}
+
+		operator := ">"
+		if column.Descending != backward {
+			operator = "<"
+		}
+		args = append(args, values[i])
+		parts = append(parts, fmt.Sprintf("page.%s %s $%d", pq.QuoteIdentifier(column.Column), operator, len(args)))
+
+		alternatives = append(alternatives, "("+strings.Join(parts, " AND ")+")")
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")", args
+}
+
+// orderBy builds the ORDER BY list, reversing every direction when paginating backward.
+func orderBy(sort []SortColumn, backward bool) string {
+	columns := make([]string, len(sort))
+	for i, column := range sort {
+		direction := "ASC"
+		if column.Descending != backward {
+			direction = "DESC"
+		}
+		columns[i] = fmt.Sprintf("page.%s %s", pq.QuoteIdentifier(column.Column), direction)
+	}
+	return strings.Join(columns, ", ")
+}
+
+// sortSignature identifies the sort columns, which binds a cursor to the listing it was created for.
+func sortSignature(sort []SortColumn) string {
+	columns := make([]string, len(sort))
+	for i, column := range sort {
+		columns[i] = column.Column
+		if column.Descending {
+			columns[i] += " desc"
+		}
+	}
+	return strings.Join(columns, ",")
+}
+
+// scanStructs scans the rows into new instances of the struct type, mapping the columns onto the fields by their tag.
+func scanStructs(rows *sql.Rows, structType reflect.Type, tag string) ([]interface{}, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get columns: %w", err)
+	}
+
+	var items []interface{}
+	for rows.Next() {
+		value := reflect.New(structType)
+		item := value.Interface()
+		names := GetFieldNames(tag, item)
+
+		pointers := make([]interface{}, len(columns))
+		for i, column := range columns {
+			for j, name := range names {
+				if name == column {
+					pointers[i] = value.Elem().Field(j).Addr().Interface()
+					break
+				}
+			}
+			if pointers[i] == nil {
+				return nil, fmt.Errorf("column %s is not mapped onto a field of %s", column, structType)
+			}
+		}
+
+		if err = rows.Scan(pointers...); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		items = append(items, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to scan rows: %w", err)
+	}
+
+	return items, nil
+}
@@ -0,0 +1,100 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// TestCursors tests whether cursors can be decoded, and whether untrusted cursors are rejected.
+func TestCursors(t *testing.T) {
+	paginator := NewPaginator(nil, []byte("secret"))
+	sort := []SortColumn{{Column: "created_at", Descending: true}, {Column: "id"}}
+
+	encoded, err := paginator.EncodeCursor(sort, []interface{}{"2026-10-17T00:00:00Z", 42}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		paginator   *Paginator
+		sort        []SortColumn
+		cursor      string
+		expectedErr bool
+	}{
+		{
+			name:        "Valid cursor",
+			paginator:   paginator,
+			sort:        sort,
+			cursor:      encoded,
+			expectedErr: false,
+		},
+		{
+			name:        "Tampered cursor",
+			paginator:   paginator,
+			sort:        sort,
+			cursor:      encoded[:len(encoded)-2] + "xx",
+			expectedErr: true,
+		},
+		{
+			name:        "Other secret",
+			paginator:   NewPaginator(nil, []byte("other")),
+			sort:        sort,
+			cursor:      encoded,
+			expectedErr: true,
+		},
+		{
+			name:        "Other listing",
+			paginator:   paginator,
+			sort:        []SortColumn{{Column: "id"}},
+			cursor:      encoded,
+			expectedErr: true,
+		},
+		{
+			name:        "Malformed cursor",
+			paginator:   paginator,
+			sort:        sort,
+			cursor:      "not a cursor",
+			expectedErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, backward, err := tt.paginator.DecodeCursor(tt.sort, tt.cursor)
+			assert.Equal(t, tt.expectedErr, err != nil)
+			if !tt.expectedErr {
+				assert.True(t, backward)
+				assert.Equal(t, []interface{}{"2026-10-17T00:00:00Z", json.Number("42")}, values)
+			}
+		})
+	}
+}
+
+// TestKeysetCondition tests whether the keyset condition respects the direction of every sort column.
+func TestKeysetCondition(t *testing.T) {
+	sort := []SortColumn{{Column: "created_at", Descending: true}, {Column: "id"}}
+
+	condition, args := keysetCondition(sort, []interface{}{"2026-10-17", 42}, false, []interface{}{"active"})
+	assert.Equal(t, `((page."created_at" < $2) OR (page."created_at" = $3 AND page."id" > $4))`, condition)
+	assert.Equal(t, []interface{}{"active", "2026-10-17", "2026-10-17", 42}, args)
+
+	condition, _ = keysetCondition(sort, []interface{}{"2026-10-17", 42}, true, nil)
+	assert.Equal(t, `((page."created_at" > $1) OR (page."created_at" = $2 AND page."id" < $3))`, condition)
+	assert.Equal(t, `page."created_at" ASC, page."id" DESC`, orderBy(sort, true))
+}
+
+// TestPageRequestValidation tests whether page limits and sizes below 1 are rejected before querying.
+func TestPageRequestValidation(t *testing.T) {
+	paginator := NewPaginator(nil, []byte("secret"))
+	sort := []SortColumn{{Column: "id"}}
+
+	for _, limit := range []int{-1, 0} {
+		_, err := PaginateKeyset[struct{}](context.Background(), paginator, &PageRequest{Sort: sort, Limit: limit})
+		assert.Error(t, err)
+	}
+	_, err := PaginateOffset[struct{}](context.Background(), paginator, &OffsetPageRequest{Sort: sort, Size: 0, Number: 1})
+	assert.Error(t, err)
+}
@@ -0,0 +1,278 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"io"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WithWorkers imports a .csv file with the workers loading parts of it concurrently, each over its own connection,
+// into a staging table which is merged into the table within a single transaction.
+// It applies to ImportCSVFile and InsertCSVFile; failing rows are isolated per part, while constraint violations
+// only surface when merging and fail the import as a whole.
+// Combined with WithDryRun, rows failing to be copied are reported per row, but constraint violations are not: the first
+// one fails the dry run as a whole.
+func WithWorkers(workers int) ImportOption {
+	return func(c *ImportConfig) {
+		c.Workers = workers
+	}
+}
+
+// csvChunk represents a part of a CSV file which starts at a record boundary.
+type csvChunk struct {
+	offset int64
+	length int64
+	line   int
+}
+
+// splitCSV splits the CSV into at most parts chunks of similar size. It only splits at newlines outside quoted fields,
+// so records spanning several lines are kept whole.
+func splitCSV(reader io.Reader, size int64, parts int) ([]*csvChunk, error) {
+	target := size / int64(parts)
+	chunks := []*csvChunk{{offset: 0, line: 1}}
+	buffer := make([]byte, 64*1024)
+
+	var offset int64
+	line, isQuoted := 1, false
+	for {
+		n, err := reader.Read(buffer)
+		for _, b := range buffer[:n] {
+			offset++
+			switch b {
+			case '"':
+				isQuoted = !isQuoted
+			case '\n':
+				line++
+				current := chunks[len(chunks)-1]
+				if !isQuoted && len(chunks) < parts && offset-current.offset >= target {
+					chunks = append(chunks, &csvChunk{offset: offset, line: line})
+				}
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the CSV: %w", err)
+		}
+	}
+
+	for i, chunk := range chunks {
+		if i < len(chunks)-1 {
+			chunk.length = chunks[i+1].offset - chunk.offset
+		} else {
+			chunk.length = offset - chunk.offset
+		}
+	}
+	if last := chunks[len(chunks)-1]; len(chunks) > 1 && last.length == 0 {
+		chunks = chunks[:len(chunks)-1]
+	}
+	return chunks, nil
+}
+
+// parallelProgress combines the progress of the workers of an import.
+type parallelProgress struct {
+	mu      sync.Mutex
+	tracker *progressTracker
+	rows    []int
+	bytes   []int64
+}
+
+// newParallelProgress creates a new instance of parallelProgress.
+func newParallelProgress(table string, config *ImportConfig, totalBytes int64, workers int) *parallelProgress {
+	tracker := newProgressTracker(table, config)
+	tracker.progress.TotalBytes = totalBytes
+	return &parallelProgress{tracker: tracker, rows: make([]int, workers), bytes: make([]int64, workers)}
+}
+
+// observer returns the observer registering the progress of the worker.
+func (p *parallelProgress) observer(worker int) ProgressObserver {
+	return func(progress ImportProgress) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.rows[worker], p.bytes[worker] = progress.RowsProcessed, progress.BytesRead
+
+		rows, bytes := 0, int64(0)
+		for i := range p.rows {
+			rows, bytes = rows+p.rows[i], bytes+p.bytes[i]
+		}
+		p.tracker.update(rows, bytes)
+	}
+}
+
+// report hands the combined progress to the observer.
+func (p *parallelProgress) report() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tracker.report()
+}
+
+// importCSVParallel splits the .csv file into parts which are loaded concurrently into a staging table,
+// which is then merged into the table. The staging table is dropped afterwards, whatever the outcome, unless the process
+// itself dies, which leaves it behind under the name of the table followed by _staging_ and a timestamp.
+func (d *DbSvc) importCSVParallel(ctx context.Context, filePath, table string, fields []string, config *ImportConfig) (*ImportResult, error) {
+	start := time.Now()
+	result := &ImportResult{Table: table, FilePath: filePath, DryRun: config.DryRun}
+	defer func() { result.Duration = time.Since(start) }()
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return result, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return result, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	chunks, err := splitCSV(file, info.Size(), config.Workers)
+	if err != nil {
+		return result, err
+	}
+
+	staging := stagingTableName(table, "staging")
+	err = d.RunGuarded(false, func(db *sql.DB) error {
+		_, err := db.ExecContext(ctx, fmt.Sprintf("CREATE UNLOGGED TABLE %s (LIKE %s INCLUDING DEFAULTS)",
+			pq.QuoteIdentifier(staging), quoteTableName(table)))
+		return err
+	})
+	if err != nil {
+		return result, fmt.Errorf("failed creating staging table: %w", ClassifyError(err))
+	}
+	defer d.dropStagingTable(staging)
+
+	headers, err := d.loadChunks(ctx, file, info.Size(), chunks, staging, fields, config, result)
+	if err == nil && !config.DryRun && result.RowsRejected > config.MaxErrors {
+		err = fmt.Errorf("%w: %d rows failed, first at line %d: %s", ErrErrorBudgetExceeded, result.RowsRejected,
+			result.Failures[0].Line, result.Failures[0].Reason)
+	}
+
+	if err == nil {
+		err = d.importInTransaction(ctx, config, []*ImportResult{result}, func(tx *sql.Tx) error {
+			return mergeStaging(ctx, tx, staging, fields, config, result)
+		})
+	}
+	return result, errors.Join(err, writeRejectFile(config, headers, fields, result))
+}
+
+// dropStagingTable drops the staging table of a parallel import, whatever its outcome. It bypasses the circuit breaker and
+// the context of the import, as an open breaker or a canceled import would otherwise leave the table behind.
+func (d *DbSvc) dropStagingTable(staging string) {
+	db := d.DB()
+	if db == nil {
+		log.Printf("Failed to drop staging table %s: not connected", staging)
+		return
+	}
+	if _, err := db.ExecContext(context.Background(), fmt.Sprintf("DROP TABLE IF EXISTS %s", pq.QuoteIdentifier(staging))); err != nil {
+		log.Printf("Failed to drop staging table %s: %s", staging, err.Error())
+	}
+}
+
+// loadChunks loads the chunks concurrently into the staging table, each within a transaction of its own.
+// The outcome of the workers is combined into the result, and the headers of the file are returned.
+func (d *DbSvc) loadChunks(ctx context.Context, file *os.File, size int64, chunks []*csvChunk, staging string, fields []string,
+	config *ImportConfig, result *ImportResult) ([]string, error) {
+	workerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	progress := newParallelProgress(result.Table, config, size, len(chunks))
+	results := make([]*ImportResult, len(chunks))
+	sources := make([]*csvSource, len(chunks))
+	errs := make([]error, len(chunks))
+
+	var wg sync.WaitGroup
+	for i, chunk := range chunks {
+		// The staging table is discarded regardless, so workers commit even for a dry run, which captures every failure
+		workerConfig := *config
+		workerConfig.DryRun, workerConfig.RejectFilePath = false, ""
+		workerConfig.DropIndexes, workerConfig.DropTriggers, workerConfig.ResyncSequences = false, false, false
+		if config.DryRun {
+			workerConfig.MaxErrors = math.MaxInt
+		}
+		if config.ProgressObserver != nil {
+			workerConfig.ProgressObserver = progress.observer(i)
+		}
+
+		sources[i] = newCSVSource(io.NewSectionReader(file, chunk.offset, chunk.length))
+		if i > 0 {
+			sources[i].started, sources[i].lineOffset = true, chunk.line-1
+		}
+		results[i] = &ImportResult{Table: result.Table}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = d.runImportTransaction(workerCtx, &workerConfig, func(tx *sql.Tx) error {
+				return newImporter(tx, staging, fields, &workerConfig, results[i]).run(workerCtx, sources[i])
+			})
+			if errs[i] != nil {
+				cancel()
+			}
+		}(i)
+	}
+	wg.Wait()
+	if config.ProgressObserver != nil {
+		progress.report()
+	}
+
+	for _, r := range results {
+		result.RowsRead += r.RowsRead
+		result.BytesRead += r.BytesRead
+		result.RowsRejected += r.RowsRejected
+		result.Failures = append(result.Failures, r.Failures...)
+	}
+	sort.SliceStable(result.Failures, func(i, j int) bool { return result.Failures[i].Line < result.Failures[j].Line })
+
+	return sources[0].headers(), firstWorkerError(ctx, errs)
+}
+
+// firstWorkerError returns the first error of the workers, other than those caused by canceling the remaining workers.
+func firstWorkerError(ctx context.Context, errs []error) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("import canceled: %w", ClassifyError(err))
+	}
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return err
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// mergeStaging inserts the rows of the staging table into the table of the result.
+func mergeStaging(ctx context.Context, tx *sql.Tx, staging string, fields []string, config *ImportConfig, result *ImportResult) error {
+	var err error
+	if result.load, err = prepareBulkLoad(ctx, tx, result.Table, config); err != nil {
+		return err
+	}
+
+	columnList := strings.Join(quoteIdentifiers(fields), ", ")
+
+	inserted, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s",
+		quoteTableName(result.Table), columnList, columnList, pq.QuoteIdentifier(staging)))
+	if err != nil {
+		return fmt.Errorf("failed merging staging table: %w", ClassifyError(err))
+	}
+
+	affected, err := inserted.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed merging staging table: %w", ClassifyError(err))
+	}
+	result.RowsLoaded = int(affected)
+
+	if err = result.load.restore(ctx, tx); err != nil {
+		return err
+	}
+	return resyncImportedSequences(ctx, tx, config, result)
+}
@@ -0,0 +1,38 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// TestSplitCSV tests whether a CSV is only split at record boundaries, keeping quoted newlines within their record.
+func TestSplitCSV(t *testing.T) {
+	content := "id,name\n1,\"John\nDoe\"\n2,Jane\n3,\"Sam\n\nSmith\"\n4,Rob\n"
+
+	chunks, err := splitCSV(strings.NewReader(content), int64(len(content)), 3)
+	assert.NoError(t, err)
+
+	var parts []string
+	total := int64(0)
+	for _, chunk := range chunks {
+		part := content[chunk.offset : chunk.offset+chunk.length]
+		parts = append(parts, part)
+		total += chunk.length
+		assert.Equal(t, strings.Count(content[:chunk.offset], "\n")+1, chunk.line)
+	}
+
+	assert.Equal(t, int64(len(content)), total)
+	assert.Equal(t, []string{"id,name\n1,\"John\nDoe\"\n", "2,Jane\n3,\"Sam\n\nSmith\"\n", "4,Rob\n"}, parts)
+}
+
+// TestSplitCSVIntoMorePartsThanRecords tests whether a small CSV is not split into empty chunks.
+func TestSplitCSVIntoMorePartsThanRecords(t *testing.T) {
+	content := "id\n1\n"
+
+	chunks, err := splitCSV(strings.NewReader(content), int64(len(content)), 8)
+	assert.NoError(t, err)
+	for _, chunk := range chunks {
+		assert.Greater(t, chunk.length, int64(0))
+	}
+}
@@ -0,0 +1,525 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"log"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The ranges covered by the partitions of a partitioned table.
+const (
+	PartitionDaily   PartitionRange = "daily"
+	PartitionWeekly  PartitionRange = "weekly"
+	PartitionMonthly PartitionRange = "monthly"
+)
+
+// errPartitionsLocked is returned when another instance holds the lock of the partitioned table.
+var errPartitionsLocked = errors.New("partitions locked")
+
+// partitionBoundPattern matches the bounds of a range partition, as described by pg_get_expr.
+// Unbounded ends, MINVALUE and MAXVALUE, are matched as empty.
+var partitionBoundPattern = regexp.MustCompile(`^FOR VALUES FROM \((?:'([^']*)'|MINVALUE)\) TO \((?:'([^']*)'|MAXVALUE)\)$`)
+
+// partitionBoundLayouts lists the layouts in which Postgres outputs the bounds of date and time partitions.
+var partitionBoundLayouts = []string{"2006-01-02 15:04:05.999999999-07", "2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999", "2006-01-02"}
+
+// partitionsQuery retrieves the partitions of the table along with their bounds.
+const partitionsQuery = `SELECT c.relname, pg_get_expr(c.relpartbound, c.oid)
+	FROM pg_inherits i
+	JOIN pg_class c ON c.oid = i.inhrelid
+	WHERE i.inhparent = $1::regclass
+	ORDER BY c.relname`
+
+// partitionStrategyQuery retrieves the partitioning strategy of the table, and whether it is partitioned by a single
+// date or time column.
+const partitionStrategyQuery = `SELECT p.partstrat,
+		p.partnatts = 1 AND coalesce(a.atttypid IN ('date'::regtype, 'timestamp'::regtype, 'timestamptz'::regtype), false)
+	FROM pg_partitioned_table p
+	LEFT JOIN pg_attribute a ON a.attrelid = p.partrelid AND a.attnum = p.partattrs[0]
+	WHERE p.partrelid = $1::regclass`
+
+// PartitionRange represents the range of time covered by each partition.
+type PartitionRange string
+
+// start returns the start of the range holding the moment.
+func (r PartitionRange) start(moment time.Time) time.Time {
+	year, month, day := moment.Date()
+	switch r {
+	case PartitionWeekly:
+		// Weeks start on Monday
+		offset := (int(moment.Weekday()) + 6) % 7
+		return time.Date(year, month, day-offset, 0, 0, 0, 0, moment.Location())
+	case PartitionMonthly:
+		return time.Date(year, month, 1, 0, 0, 0, 0, moment.Location())
+	default:
+		return time.Date(year, month, day, 0, 0, 0, 0, moment.Location())
+	}
+}
+
+// next returns the start of the range following the one starting at the moment.
+func (r PartitionRange) next(start time.Time) time.Time {
+	switch r {
+	case PartitionWeekly:
+		return start.AddDate(0, 0, 7)
+	case PartitionMonthly:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// name returns the name of the partition of the table starting at the moment.
+func (r PartitionRange) name(table string, start time.Time) string {
+	if r == PartitionMonthly {
+		return fmt.Sprintf("%s_p%s", table, start.Format("200601"))
+	}
+	return fmt.Sprintf("%s_p%s", table, start.Format("20060102"))
+}
+
+// PartitionPolicy declares how the partitions of a table partitioned by a range of time are managed.
+type PartitionPolicy struct {
+	Table     string
+	Range     PartitionRange
+	Premake   int
+	RetainFor time.Duration
+	IsDropped bool
+	Location  *time.Location
+	now       func() time.Time
+}
+
+// PartitionPolicyOption is used to instantiate a PartitionPolicy with the provided settings.
+type PartitionPolicyOption func(*PartitionPolicy)
+
+// NewPartitionPolicy creates a new instance of PartitionPolicy, which keeps partitions of the range created ahead of time.
+func NewPartitionPolicy(table string, partitionRange PartitionRange, options ...PartitionPolicyOption) *PartitionPolicy {
+	policy := &PartitionPolicy{
+		Table:    table,
+		Range:    partitionRange,
+		Premake:  3,
+		Location: time.UTC,
+		now:      time.Now,
+	}
+	for _, option := range options {
+		option(policy)
+	}
+	return policy
+}
+
+// WithPremake sets the number of partitions created ahead of the current one.
+func WithPremake(partitions int) PartitionPolicyOption {
+	return func(p *PartitionPolicy) {
+		p.Premake = partitions
+	}
+}
+
+// WithPartitionRetention detaches the partitions of which every value is older than the duration.
+// Detached partitions remain as regular tables, unless dropped is set.
+func WithPartitionRetention(retainFor time.Duration, dropped bool) PartitionPolicyOption {
+	return func(p *PartitionPolicy) {
+		p.RetainFor = retainFor
+		p.IsDropped = dropped
+	}
+}
+
+// WithPartitionLocation sets the time zone in which the ranges start, which is UTC by default.
+func WithPartitionLocation(location *time.Location) PartitionPolicyOption {
+	return func(p *PartitionPolicy) {
+		p.Location = location
+	}
+}
+
+// validate checks whether the policy can be applied.
+func (p *PartitionPolicy) validate() error {
+	if p.Table == "" {
+		return errors.New("partition policy requires a table")
+	}
+	switch p.Range {
+	case PartitionDaily, PartitionWeekly, PartitionMonthly:
+	default:
+		return fmt.Errorf("invalid partition range %q", p.Range)
+	}
+	if p.Premake < 0 {
+		return fmt.Errorf("invalid number of partitions to premake %d", p.Premake)
+	}
+	return nil
+}
+
+// horizon returns the end of the last partition to premake.
+func (p *PartitionPolicy) horizon() time.Time {
+	end := p.Range.next(p.Range.start(p.now().In(p.Location)))
+	for i := 0; i < p.Premake; i++ {
+		end = p.Range.next(end)
+	}
+	return end
+}
+
+// Partition represents a partition of a partitioned table. The default partition has no bounds, and a zero From or To
+// is an unbounded end, such as MINVALUE.
+type Partition struct {
+	Name      string
+	From      time.Time
+	To        time.Time
+	IsDefault bool
+}
+
+// PartitionGap represents a range of time within the coverage of a table for which no partition exists.
+type PartitionGap struct {
+	From time.Time
+	To   time.Time
+}
+
+// PartitionReport summarises the maintenance of the partitions of a table.
+type PartitionReport struct {
+	Table     string
+	Created   []string
+	Detached  []string
+	Dropped   []string
+	Gaps      []*PartitionGap
+	IsSkipped bool
+}
+
+// PartitionSvcOption is used to instantiate a PartitionSvc with the provided settings/configurations/actions.
+type PartitionSvcOption func(*PartitionSvc)
+
+// PartitionOps represents operations related to managing the partitions of tables partitioned by a range of time.
+type PartitionOps interface {
+	AddPolicies(policies ...*PartitionPolicy)
+	Maintain(ctx context.Context, policy *PartitionPolicy) (*PartitionReport, error)
+	MaintainAll(ctx context.Context) ([]*PartitionReport, error)
+	ListPartitions(ctx context.Context, table string) ([]*Partition, error)
+	CoverageGaps(ctx context.Context, policy *PartitionPolicy) ([]*PartitionGap, error)
+	StartMaintenance()
+	StopMaintenance()
+}
+
+// PartitionSvc creates partitions ahead of time and detaches or drops those past their retention, as declared by the policies.
+// Maintenance holds an advisory lock on the table, so several instances can maintain the same tables.
+type PartitionSvc struct {
+	Database             *DbSvc
+	Policies             []*PartitionPolicy
+	Interval             time.Duration
+	IsMaintenanceEnabled bool
+	mu                   sync.Mutex
+}
+
+// NewPartitionSvc creates a new instance of PartitionSvc.
+func NewPartitionSvc(database *DbSvc, options ...PartitionSvcOption) *PartitionSvc {
+	partitions := &PartitionSvc{
+		Database: database,
+		Interval: time.Hour,
+	}
+	for _, option := range options {
+		option(partitions)
+	}
+	return partitions
+}
+
+// WithPartitionPolicies adds the policies to the service.
+func WithPartitionPolicies(policies ...*PartitionPolicy) PartitionSvcOption {
+	return func(p *PartitionSvc) {
+		p.Policies = append(p.Policies, policies...)
+	}
+}
+
+// WithPartitionInterval sets the time between maintenance rounds.
+func WithPartitionInterval(interval time.Duration) PartitionSvcOption {
+	return func(p *PartitionSvc) {
+		p.Interval = interval
+	}
+}
+
+// AddPolicies adds the policies to those maintained.
+func (p *PartitionSvc) AddPolicies(policies ...*PartitionPolicy) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Policies = append(p.Policies, policies...)
+}
+
+// Maintain creates the current and future partitions missing from the table, detaches or drops the partitions past their
+// retention, and reports the gaps in the coverage which remain, all within a single transaction.
+// The maintenance is skipped when another instance is maintaining the table.
+func (p *PartitionSvc) Maintain(ctx context.Context, policy *PartitionPolicy) (*PartitionReport, error) {
+	report := &PartitionReport{Table: policy.Table}
+	if err := policy.validate(); err != nil {
+		return report, err
+	}
+
+	err := p.Database.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		var isLocked bool
+		err := tx.QueryRowContext(ctx, "SELECT pg_try_advisory_xact_lock(hashtext($1))", "partitions:"+policy.Table).Scan(&isLocked)
+		if err != nil {
+			return fmt.Errorf("failed to lock partitions of %s: %w", policy.Table, ClassifyError(err))
+		}
+		if !isLocked {
+			return errPartitionsLocked
+		}
+
+		if err = checkRangePartitioned(ctx, tx, policy.Table); err != nil {
+			return err
+		}
+		partitions, err := listPartitions(ctx, tx, policy.Table, policy.Location)
+		if err != nil {
+			return err
+		}
+
+		if partitions, err = createPartitions(ctx, tx, policy, partitions, report); err != nil {
+			return err
+		}
+		if partitions, err = retirePartitions(ctx, tx, policy, partitions, report); err != nil {
+			return err
+		}
+		report.Gaps = coverageGaps(partitions, policy.horizon())
+		return nil
+	})
+	if errors.Is(err, errPartitionsLocked) {
+		report.IsSkipped = true
+		return report, nil
+	}
+	if err != nil {
+		report.Created, report.Detached, report.Dropped, report.Gaps = nil, nil, nil, nil
+	}
+	return report, err
+}
+
+// checkRangePartitioned checks whether the table is partitioned by range of a date or time column.
+func checkRangePartitioned(ctx context.Context, tx *sql.Tx, table string) error {
+	var strategy string
+	var isTimeKey bool
+	err := tx.QueryRowContext(ctx, partitionStrategyQuery, pq.QuoteIdentifier(table)).Scan(&strategy, &isTimeKey)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("table %s is not partitioned", table)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to retrieve partitioning of %s: %w", table, ClassifyError(err))
+	}
+	if strategy != "r" {
+		return fmt.Errorf("table %s is not partitioned by range", table)
+	}
+	if !isTimeKey {
+		return fmt.Errorf("table %s is not partitioned by a date or time column", table)
+	}
+	return nil
+}
+
+// createPartitions creates the partitions from the current range up to the horizon which do not overlap existing ones.
+// It returns the partitions including those created.
+func createPartitions(ctx context.Context, tx *sql.Tx, policy *PartitionPolicy, partitions []*Partition,
+	report *PartitionReport) ([]*Partition, error) {
+	horizon := policy.horizon()
+	for start := policy.Range.start(policy.now().In(policy.Location)); start.Before(horizon); start = policy.Range.next(start) {
+		partition := &Partition{Name: policy.Range.name(policy.Table, start), From: start, To: policy.Range.next(start)}
+		if overlapsPartitions(partition, partitions) {
+			continue
+		}
+
+		query := fmt.Sprintf("CREATE TABLE %s PARTITION OF %s FOR VALUES FROM (%s) TO (%s)", pq.QuoteIdentifier(partition.Name),
+			pq.QuoteIdentifier(policy.Table), formatPartitionBound(partition.From), formatPartitionBound(partition.To))
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return nil, fmt.Errorf("failed to create partition %s: %w", partition.Name, ClassifyError(err))
+		}
+		partitions = append(partitions, partition)
+		report.Created = append(report.Created, partition.Name)
+	}
+	return partitions, nil
+}
+
+// retirePartitions detaches, or drops, the partitions of which every value is past the retention.
+// Partitions with an unbounded end are never retired. It returns the partitions which remain attached.
+func retirePartitions(ctx context.Context, tx *sql.Tx, policy *PartitionPolicy, partitions []*Partition,
+	report *PartitionReport) ([]*Partition, error) {
+	if policy.RetainFor <= 0 {
+		return partitions, nil
+	}
+
+	cutoff := policy.now().Add(-policy.RetainFor)
+	var remaining []*Partition
+	for _, partition := range partitions {
+		if partition.IsDefault || partition.From.IsZero() || partition.To.IsZero() || partition.To.After(cutoff) {
+			remaining = append(remaining, partition)
+			continue
+		}
+
+		name := pq.QuoteIdentifier(partition.Name)
+		query := fmt.Sprintf("ALTER TABLE %s DETACH PARTITION %s", pq.QuoteIdentifier(policy.Table), name)
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return nil, fmt.Errorf("failed to detach partition %s: %w", partition.Name, ClassifyError(err))
+		}
+		if !policy.IsDropped {
+			report.Detached = append(report.Detached, partition.Name)
+			continue
+		}
+
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("DROP TABLE %s", name)); err != nil {
+			return nil, fmt.Errorf("failed to drop partition %s: %w", partition.Name, ClassifyError(err))
+		}
+		report.Dropped = append(report.Dropped, partition.Name)
+	}
+	return remaining, nil
+}
+
+// ListPartitions retrieves the partitions of the table, ordered by name.
+// Unbounded ends, MINVALUE and MAXVALUE, are left zero.
+func (p *PartitionSvc) ListPartitions(ctx context.Context, table string) ([]*Partition, error) {
+	var partitions []*Partition
+	err := p.Database.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		var err error
+		partitions, err = listPartitions(ctx, tx, table, time.UTC)
+		return err
+	})
+	return partitions, err
+}
+
+// CoverageGaps reports the ranges between the first partition and the horizon of the policy for which no partition exists.
+func (p *PartitionSvc) CoverageGaps(ctx context.Context, policy *PartitionPolicy) ([]*PartitionGap, error) {
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+
+	var partitions []*Partition
+	err := p.Database.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		var err error
+		partitions, err = listPartitions(ctx, tx, policy.Table, policy.Location)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return coverageGaps(partitions, policy.horizon()), nil
+}
+
+// listPartitions retrieves the partitions of the table, with bounds without a time zone read in the location.
+func listPartitions(ctx context.Context, tx *sql.Tx, table string, location *time.Location) ([]*Partition, error) {
+	rows, err := tx.QueryContext(ctx, partitionsQuery, pq.QuoteIdentifier(table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve partitions of %s: %w", table, ClassifyError(err))
+	}
+	defer rows.Close()
+
+	var partitions []*Partition
+	for rows.Next() {
+		var bound string
+		partition := &Partition{}
+		if err = rows.Scan(&partition.Name, &bound); err != nil {
+			return nil, fmt.Errorf("failed to retrieve partitions of %s: %w", table, ClassifyError(err))
+		}
+		partition.IsDefault = bound == "DEFAULT"
+		if matches := partitionBoundPattern.FindStringSubmatch(bound); matches != nil {
+			partition.From = parsePartitionBound(matches[1], location)
+			partition.To = parsePartitionBound(matches[2], location)
+		}
+		partitions = append(partitions, partition)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to retrieve partitions of %s: %w", table, ClassifyError(err))
+	}
+	return partitions, nil
+}
+
+// parsePartitionBound parses a bound in one of the layouts output by Postgres, returning zero when it is none of them.
+func parsePartitionBound(bound string, location *time.Location) time.Time {
+	for _, layout := range partitionBoundLayouts {
+		if parsed, err := time.ParseInLocation(layout, bound, location); err == nil {
+			return parsed
+		}
+	}
+	return time.Time{}
+}
+
+// formatPartitionBound formats the moment as a literal accepted by date, timestamp and timestamptz partition keys.
+func formatPartitionBound(moment time.Time) string {
+	return pq.QuoteLiteral(moment.Format("2006-01-02 15:04:05-07:00"))
+}
+
+// overlapsPartitions checks whether the partition overlaps one of the partitions, of which zero bounds are unbounded.
+func overlapsPartitions(partition *Partition, partitions []*Partition) bool {
+	for _, existing := range partitions {
+		if existing.IsDefault {
+			continue
+		}
+		if (existing.To.IsZero() || partition.From.Before(existing.To)) &&
+			(existing.From.IsZero() || existing.From.Before(partition.To)) {
+			return true
+		}
+	}
+	return false
+}
+
+// coverageGaps returns the ranges between the start of the first partition and the horizon which no partition covers.
+// A partition unbounded from below comes first, and one unbounded from above covers everything after its start.
+func coverageGaps(partitions []*Partition, horizon time.Time) []*PartitionGap {
+	var bounded []*Partition
+	for _, partition := range partitions {
+		if !partition.IsDefault {
+			bounded = append(bounded, partition)
+		}
+	}
+	if len(bounded) == 0 {
+		return nil
+	}
+	sort.Slice(bounded, func(i, j int) bool { return bounded[i].From.Before(bounded[j].From) })
+
+	var gaps []*PartitionGap
+	covered := bounded[0].To
+	for _, partition := range bounded[1:] {
+		if covered.IsZero() {
+			return gaps
+		}
+		if partition.From.After(covered) {
+			gaps = append(gaps, &PartitionGap{From: covered, To: partition.From})
+		}
+		if partition.To.IsZero() || partition.To.After(covered) {
+			covered = partition.To
+		}
+	}
+	if !covered.IsZero() && horizon.After(covered) {
+		gaps = append(gaps, &PartitionGap{From: covered, To: horizon})
+	}
+	return gaps
+}
+
+// MaintainAll maintains the partitions of every policy, one after the other.
+// A failing policy does not prevent the others from being maintained; the errors are joined.
+func (p *PartitionSvc) MaintainAll(ctx context.Context) ([]*PartitionReport, error) {
+	p.mu.Lock()
+	policies := make([]*PartitionPolicy, len(p.Policies))
+	copy(policies, p.Policies)
+	p.mu.Unlock()
+
+	var reports []*PartitionReport
+	var errs []error
+	for _, policy := range policies {
+		report, err := p.Maintain(ctx, policy)
+		reports = append(reports, report)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed maintaining partitions of %s: %w", policy.Table, err))
+		}
+	}
+	return reports, errors.Join(errs...)
+}
+
+// StartMaintenance continuously maintains the partitions of every policy until the maintenance is stopped.
+func (p *PartitionSvc) StartMaintenance() {
+	p.IsMaintenanceEnabled = true
+	for {
+		if !p.IsMaintenanceEnabled {
+			break
+		}
+		if _, err := p.MaintainAll(context.Background()); err != nil {
+			log.Printf("Failed to maintain partitions: %s", err.Error())
+		}
+		time.Sleep(p.Interval)
+	}
+}
+
+// StopMaintenance disables the maintenance.
+func (p *PartitionSvc) StopMaintenance() {
+	p.IsMaintenanceEnabled = false
+}
@@ -0,0 +1,81 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// TestPartitionRanges tests whether ranges start on the first day of their period and are named after it.
+func TestPartitionRanges(t *testing.T) {
+	moment := time.Date(2024, 2, 29, 13, 45, 0, 0, time.UTC)
+
+	start := PartitionDaily.start(moment)
+	assert.Equal(t, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), start)
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), PartitionDaily.next(start))
+	assert.Equal(t, "logs_p20240229", PartitionDaily.name("logs", start))
+
+	start = PartitionWeekly.start(moment)
+	assert.Equal(t, time.Date(2024, 2, 26, 0, 0, 0, 0, time.UTC), start)
+	assert.Equal(t, time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC), PartitionWeekly.next(start))
+	assert.Equal(t, time.Date(2024, 2, 26, 0, 0, 0, 0, time.UTC), PartitionWeekly.start(start))
+
+	start = PartitionMonthly.start(moment)
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), start)
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), PartitionMonthly.next(start))
+	assert.Equal(t, "logs_p202402", PartitionMonthly.name("logs", start))
+}
+
+// TestPartitionHorizon tests whether the horizon lies the number of premade partitions past the current one.
+func TestPartitionHorizon(t *testing.T) {
+	policy := NewPartitionPolicy("logs", PartitionMonthly, WithPremake(2))
+	policy.now = func() time.Time { return time.Date(2024, 11, 15, 0, 0, 0, 0, time.UTC) }
+	assert.Equal(t, time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC), policy.horizon())
+}
+
+// TestParsePartitionBound tests whether the bounds of date and time partitions are parsed.
+func TestParsePartitionBound(t *testing.T) {
+	expected := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.True(t, expected.Equal(parsePartitionBound("2024-01-01 00:00:00+00", time.UTC)))
+	assert.True(t, expected.Equal(parsePartitionBound("2024-01-01 05:30:00+05:30", time.UTC)))
+	assert.True(t, expected.Equal(parsePartitionBound("2024-01-01 00:00:00", time.UTC)))
+	assert.True(t, expected.Equal(parsePartitionBound("2024-01-01", time.UTC)))
+	assert.True(t, parsePartitionBound("MINVALUE", time.UTC).IsZero())
+	assert.Equal(t, `'2024-01-01 00:00:00+00:00'`, formatPartitionBound(expected))
+}
+
+// TestCoverageGaps tests whether the ranges without a partition are reported up to the horizon.
+func TestCoverageGaps(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	partitions := []*Partition{
+		{Name: "logs_p20240103", From: day(3), To: day(4)},
+		{Name: "logs_p20240101", From: day(1), To: day(2)},
+		{Name: "logs_default", IsDefault: true},
+	}
+
+	gaps := coverageGaps(partitions, day(6))
+	assert.Equal(t, []*PartitionGap{{From: day(2), To: day(3)}, {From: day(4), To: day(6)}}, gaps)
+	assert.Equal(t, []*PartitionGap{{From: day(2), To: day(3)}}, coverageGaps(partitions, day(4)))
+	assert.Empty(t, coverageGaps(partitions[:1], day(4)))
+	assert.True(t, overlapsPartitions(&Partition{From: day(3), To: day(5)}, partitions))
+	assert.False(t, overlapsPartitions(&Partition{From: day(2), To: day(3)}, partitions))
+}
+
+// TestUnboundedPartitions tests whether partitions with an unbounded end cover everything before or after their bound.
+func TestUnboundedPartitions(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	partitions := []*Partition{
+		{Name: "logs_initial", To: day(3)},
+		{Name: "logs_p20240104", From: day(4), To: day(5)},
+		{Name: "logs_future", From: day(6)},
+	}
+
+	assert.Equal(t, []*PartitionGap{{From: day(3), To: day(4)}, {From: day(5), To: day(6)}}, coverageGaps(partitions, day(9)))
+	assert.Equal(t, []*PartitionGap{{From: day(3), To: day(4)}}, coverageGaps(partitions[:2], day(5)))
+	assert.True(t, overlapsPartitions(&Partition{From: day(1), To: day(2)}, partitions))
+	assert.True(t, overlapsPartitions(&Partition{From: day(8), To: day(9)}, partitions))
+	assert.False(t, overlapsPartitions(&Partition{From: day(3), To: day(4)}, partitions))
+
+	matches := partitionBoundPattern.FindStringSubmatch("FOR VALUES FROM (MINVALUE) TO ('2024-01-03 00:00:00+00')")
+	assert.Equal(t, []string{"", "2024-01-03 00:00:00+00"}, matches[1:])
+}
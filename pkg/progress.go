@@ -0,0 +1,93 @@
+package pkg
+
+import (
+	"time"
+)
+
+// ImportProgress describes how far an import got.
+// TotalRows and TotalBytes are zero when unknown; BytesRead is zero for data not read from a file.
+type ImportProgress struct {
+	Table         string
+	RowsProcessed int
+	BytesRead     int64
+	TotalRows     int
+	TotalBytes    int64
+	RowsPerSecond float64
+	Elapsed       time.Duration
+}
+
+// Remaining estimates the time left, based on the rate so far; it returns zero when the total is unknown.
+func (p ImportProgress) Remaining() time.Duration {
+	var done float64
+	switch {
+	case p.TotalBytes > 0 && p.BytesRead > 0:
+		done = float64(p.BytesRead) / float64(p.TotalBytes)
+	case p.TotalRows > 0 && p.RowsProcessed > 0:
+		done = float64(p.RowsProcessed) / float64(p.TotalRows)
+	default:
+		return 0
+	}
+	if done >= 1 {
+		return 0
+	}
+	return time.Duration(float64(p.Elapsed) * (1 - done) / done)
+}
+
+// ProgressObserver receives the progress of an import.
+type ProgressObserver func(progress ImportProgress)
+
+// WithProgress reports the progress to the observer every interval, and once more when the import finished reading.
+func WithProgress(observer ProgressObserver, interval time.Duration) ImportOption {
+	return func(c *ImportConfig) {
+		c.ProgressObserver = observer
+		c.ProgressInterval = interval
+	}
+}
+
+// progressTracker keeps track of the progress of an import and reports it at the configured interval.
+type progressTracker struct {
+	observer   ProgressObserver
+	interval   time.Duration
+	progress   ImportProgress
+	start      time.Time
+	reportedAt time.Time
+}
+
+// newProgressTracker creates a new instance of progressTracker.
+func newProgressTracker(table string, config *ImportConfig) *progressTracker {
+	now := time.Now()
+	return &progressTracker{
+		observer:   config.ProgressObserver,
+		interval:   config.ProgressInterval,
+		progress:   ImportProgress{Table: table},
+		start:      now,
+		reportedAt: now,
+	}
+}
+
+// update registers the rows processed and bytes read so far, and reports them once the interval has passed.
+func (t *progressTracker) update(rows int, bytes int64) {
+	t.progress.RowsProcessed, t.progress.BytesRead = rows, bytes
+	if t.observer != nil && time.Since(t.reportedAt) >= t.interval {
+		t.report()
+	}
+}
+
+// report hands the current progress to the observer.
+func (t *progressTracker) report() {
+	if t.observer == nil {
+		return
+	}
+	t.reportedAt = time.Now()
+	t.observer(t.snapshot())
+}
+
+// snapshot returns the current progress along with the elapsed time and rate.
+func (t *progressTracker) snapshot() ImportProgress {
+	progress := t.progress
+	progress.Elapsed = time.Since(t.start)
+	if seconds := progress.Elapsed.Seconds(); seconds > 0 {
+		progress.RowsPerSecond = float64(progress.RowsProcessed) / seconds
+	}
+	return progress
+}
@@ -0,0 +1,63 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestProgressRemaining tests whether the time left is estimated from the bytes or rows done so far.
+func TestProgressRemaining(t *testing.T) {
+	tests := []struct {
+		name     string
+		progress ImportProgress
+		expected time.Duration
+	}{
+		{name: "By bytes", progress: ImportProgress{BytesRead: 25, TotalBytes: 100, Elapsed: time.Minute}, expected: 3 * time.Minute},
+		{name: "By rows", progress: ImportProgress{RowsProcessed: 50, TotalRows: 100, Elapsed: time.Minute}, expected: time.Minute},
+		{name: "Unknown total", progress: ImportProgress{RowsProcessed: 50, Elapsed: time.Minute}, expected: 0},
+		{name: "Done", progress: ImportProgress{RowsProcessed: 100, TotalRows: 100, Elapsed: time.Minute}, expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.progress.Remaining())
+		})
+	}
+}
+
+// TestProgressTracker tests whether progress is only reported once the interval has passed.
+func TestProgressTracker(t *testing.T) {
+	var reports []ImportProgress
+	config := newImportConfig([]ImportOption{WithProgress(func(progress ImportProgress) {
+		reports = append(reports, progress)
+	}, time.Hour)})
+
+	tracker := newProgressTracker("contacts", config)
+	tracker.update(10, 100)
+	assert.Empty(t, reports)
+
+	tracker.report()
+	assert.Len(t, reports, 1)
+	assert.Equal(t, "contacts", reports[0].Table)
+	assert.Equal(t, 10, reports[0].RowsProcessed)
+	assert.Equal(t, int64(100), reports[0].BytesRead)
+	assert.Greater(t, reports[0].RowsPerSecond, 0.0)
+}
+
+// TestImportCanceled tests whether a canceled import stops before copying and describes how far it got.
+func TestImportCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result := &ImportResult{Table: "contacts"}
+	config := newImportConfig(nil)
+	err := newImporter(nil, "contacts", []string{"id"}, config, result).run(ctx, newCSVSource(strings.NewReader("id\n1\n")))
+
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.True(t, errors.Is(err, ErrQueryCanceled))
+	assert.Equal(t, 0, result.RowsRead)
+}
@@ -0,0 +1,397 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ErrNotFound is returned when a record does not exist.
+var ErrNotFound = errors.New("record not found")
+
+// ConflictError is returned when a record was changed by someone else since it was read.
+type ConflictError struct {
+	Table   string
+	Key     interface{}
+	Version int64
+}
+
+// Error returns the description of the conflict.
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("conflicting change of %s %v: version %d is no longer current", e.Table, e.Key, e.Version)
+}
+
+// queryer represents the query operations shared by *sql.DB and *sql.Tx.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// RepositoryMapping holds how an entity is mapped onto a table.
+type RepositoryMapping struct {
+	Table           string
+	Tag             string
+	KeyColumn       string
+	VersionColumn   string
+	DeletedAtColumn string
+	IsKeyGenerated  bool
+}
+
+// RepositoryOption is used to instantiate a Repository with the provided settings/configurations/actions.
+type RepositoryOption func(*RepositoryMapping)
+
+// WithTag sets the struct tag from which the column names are read.
+func WithTag(tag string) RepositoryOption {
+	return func(m *RepositoryMapping) {
+		m.Tag = tag
+	}
+}
+
+// WithKeyColumn sets the primary key column.
+func WithKeyColumn(column string) RepositoryOption {
+	return func(m *RepositoryMapping) {
+		m.KeyColumn = column
+	}
+}
+
+// WithGeneratedKey lets the database generate the primary key when creating a record.
+func WithGeneratedKey() RepositoryOption {
+	return func(m *RepositoryMapping) {
+		m.IsKeyGenerated = true
+	}
+}
+
+// WithVersionColumn enables optimistic locking through the provided integer column.
+func WithVersionColumn(column string) RepositoryOption {
+	return func(m *RepositoryMapping) {
+		m.VersionColumn = column
+	}
+}
+
+// WithSoftDelete makes deleting set the provided timestamp column instead of removing the record.
+func WithSoftDelete(column string) RepositoryOption {
+	return func(m *RepositoryMapping) {
+		m.DeletedAtColumn = column
+	}
+}
+
+// Repository provides CRUD operations for entities of type T, which must be a struct with exported fields.
+type Repository[T any] struct {
+	RepositoryMapping
+	Database *DbSvc
+	columns  []string
+	indices  []int
+	runner   queryer
+}
+
+// NewRepository creates a new instance of Repository, of which the columns are derived from the struct tags of T.
+// It returns an error when a tagged field is unexported, or when the key or integer version column is not mapped.
+func NewRepository[T any](database *DbSvc, table string, options ...RepositoryOption) (*Repository[T], error) {
+	repository := &Repository[T]{
+		RepositoryMapping: RepositoryMapping{Table: table, Tag: "db", KeyColumn: "id"},
+		Database:          database,
+	}
+	for _, option := range options {
+		option(&repository.RepositoryMapping)
+	}
+
+	entityType := reflect.TypeOf(new(T)).Elem()
+	if entityType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%s is not a struct", entityType)
+	}
+	for i := 0; i < entityType.NumField(); i++ {
+		field := entityType.Field(i)
+		name := field.Tag.Get(repository.Tag)
+		if name == "" || name == "-" {
+			continue
+		}
+		if !field.IsExported() {
+			return nil, fmt.Errorf("field %s of %s is mapped onto column %s, but is unexported", field.Name, entityType, name)
+		}
+		repository.columns = append(repository.columns, name)
+		repository.indices = append(repository.indices, i)
+	}
+
+	if !repository.hasColumn(repository.KeyColumn) {
+		return nil, fmt.Errorf("key column %s is not mapped onto a field of %s", repository.KeyColumn, entityType)
+	}
+	if repository.VersionColumn != "" {
+		kind := reflect.Invalid
+		for i, column := range repository.columns {
+			if column == repository.VersionColumn {
+				kind = entityType.Field(repository.indices[i]).Type.Kind()
+			}
+		}
+		switch kind {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		case reflect.Invalid:
+			return nil, fmt.Errorf("version column %s is not mapped onto a field of %s", repository.VersionColumn, entityType)
+		default:
+			return nil, fmt.Errorf("version column %s is mapped onto a field of %s which is not an integer", repository.VersionColumn, entityType)
+		}
+	}
+	if repository.VersionColumn == "" && len(repository.columns) == 1 {
+		return nil, fmt.Errorf("%s maps no column besides key column %s, so there is nothing to update", entityType, repository.KeyColumn)
+	}
+	return repository, nil
+}
+
+// WithTx returns a copy of the repository which operates within the provided transaction.
+func (r *Repository[T]) WithTx(tx *sql.Tx) *Repository[T] {
+	clone := *r
+	clone.runner = tx
+	return &clone
+}
+
+// Columns returns the columns the entity is mapped onto.
+func (r *Repository[T]) Columns() []string {
+	return r.columns
+}
+
+// run executes fn within the transaction, or otherwise against the database guarded by its circuit breaker,
+// within a transaction of its own when the context holds security claims.
+func (r *Repository[T]) run(ctx context.Context, readOnly bool, fn func(q queryer) error) error {
+	if r.runner != nil {
+		return fn(r.runner)
+	}
+	return r.Database.runWithClaims(ctx, readOnly, fn)
+}
+
+// Create inserts the entity, after which it holds the values as stored, such as a generated key.
+func (r *Repository[T]) Create(ctx context.Context, entity *T) error {
+	values := r.values(entity)
+
+	var columns, placeholders []string
+	var args []interface{}
+	for i, column := range r.columns {
+		if r.IsKeyGenerated && column == r.KeyColumn {
+			continue
+		}
+		if column == r.VersionColumn {
+			// The stored version is scanned back into the entity once the insert succeeded
+			args = append(args, 1)
+		} else {
+			args = append(args, values[i])
+		}
+		columns = append(columns, pq.QuoteIdentifier(column))
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) RETURNING %s", quoteTableName(r.Table),
+		strings.Join(columns, ", "), strings.Join(placeholders, ", "), r.selectList())
+	return r.run(ctx, false, func(q queryer) error {
+		if err := q.QueryRowContext(ctx, query, args...).Scan(r.pointers(entity)...); err != nil {
+			return fmt.Errorf("failed creating %s: %w", r.Table, ClassifyError(err))
+		}
+		return nil
+	})
+}
+
+// Get retrieves the entity with the provided key, or returns ErrNotFound.
+func (r *Repository[T]) Get(ctx context.Context, key interface{}) (*T, error) {
+	entities, err := r.Find(ctx, map[string]interface{}{r.KeyColumn: key})
+	if err != nil {
+		return nil, err
+	}
+	if len(entities) == 0 {
+		return nil, fmt.Errorf("failed getting %s %v: %w", r.Table, key, ErrNotFound)
+	}
+	return entities[0], nil
+}
+
+// Find retrieves the entities of which the columns equal the values of the filter; soft deleted entities are excluded.
+func (r *Repository[T]) Find(ctx context.Context, filter map[string]interface{}) ([]*T, error) {
+	conditions, args, err := r.conditions(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s", r.selectList(), quoteTableName(r.Table))
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY " + pq.QuoteIdentifier(r.KeyColumn)
+
+	var entities []*T
+	err = r.run(ctx, true, func(q queryer) error {
+		rows, err := q.QueryContext(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("failed finding %s: %w", r.Table, ClassifyError(err))
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			entity := new(T)
+			if err = rows.Scan(r.pointers(entity)...); err != nil {
+				return fmt.Errorf("failed scanning %s: %w", r.Table, err)
+			}
+			entities = append(entities, entity)
+		}
+
+		if err = rows.Err(); err != nil {
+			return fmt.Errorf("failed finding %s: %w", r.Table, ClassifyError(err))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entities, nil
+}
+
+// Update stores the entity. With a version column, a ConflictError is returned when the entity is not current anymore.
+func (r *Repository[T]) Update(ctx context.Context, entity *T) error {
+	values := r.values(entity)
+
+	var assignments []string
+	var args []interface{}
+	for i, column := range r.columns {
+		if column == r.KeyColumn || column == r.VersionColumn {
+			continue
+		}
+		args = append(args, values[i])
+		assignments = append(assignments, fmt.Sprintf("%s = $%d", pq.QuoteIdentifier(column), len(args)))
+	}
+	if r.VersionColumn != "" {
+		version := pq.QuoteIdentifier(r.VersionColumn)
+		assignments = append(assignments, fmt.Sprintf("%s = %s + 1", version, version))
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET %s", quoteTableName(r.Table), strings.Join(assignments, ", "))
+	return r.change(ctx, entity, query, args)
+}
+
+// Delete removes the entity, or marks it as deleted when soft deletion is enabled.
+// With a version column, a ConflictError is returned when the entity is not current anymore.
+func (r *Repository[T]) Delete(ctx context.Context, entity *T) error {
+	query := fmt.Sprintf("DELETE FROM %s", quoteTableName(r.Table))
+	if r.DeletedAtColumn != "" {
+		query = fmt.Sprintf("UPDATE %s SET %s = now()", quoteTableName(r.Table), pq.QuoteIdentifier(r.DeletedAtColumn))
+		if r.VersionColumn != "" {
+			version := pq.QuoteIdentifier(r.VersionColumn)
+			query += fmt.Sprintf(", %s = %s + 1", version, version)
+		}
+	}
+	return r.change(ctx, entity, query, nil)
+}
+
+// change executes the update or delete statement for the entity, guarded by its key, version and deletion state.
+func (r *Repository[T]) change(ctx context.Context, entity *T, query string, args []interface{}) error {
+	key := r.field(entity, r.KeyColumn).Interface()
+	args = append(args, key)
+	query += fmt.Sprintf(" WHERE %s = $%d", pq.QuoteIdentifier(r.KeyColumn), len(args))
+
+	var version int64
+	if r.VersionColumn != "" {
+		version = r.field(entity, r.VersionColumn).Int()
+		args = append(args, version)
+		query += fmt.Sprintf(" AND %s = $%d", pq.QuoteIdentifier(r.VersionColumn), len(args))
+	}
+	if r.DeletedAtColumn != "" {
+		query += fmt.Sprintf(" AND %s IS NULL", pq.QuoteIdentifier(r.DeletedAtColumn))
+	}
+
+	var affected int64
+	err := r.run(ctx, false, func(q queryer) error {
+		result, err := q.ExecContext(ctx, query, args...)
+		if err == nil {
+			affected, err = result.RowsAffected()
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed changing %s %v: %w", r.Table, key, ClassifyError(err))
+	}
+
+	if affected == 0 {
+		if r.VersionColumn != "" {
+			return &ConflictError{Table: r.Table, Key: key, Version: version}
+		}
+		return fmt.Errorf("failed changing %s %v: %w", r.Table, key, ErrNotFound)
+	}
+
+	if r.VersionColumn != "" {
+		r.field(entity, r.VersionColumn).SetInt(version + 1)
+	}
+	return nil
+}
+
+// conditions translates the filter into SQL conditions and their arguments, ordered by column name.
+func (r *Repository[T]) conditions(filter map[string]interface{}) ([]string, []interface{}, error) {
+	columns := make([]string, 0, len(filter))
+	for column := range filter {
+		if !r.hasColumn(column) {
+			return nil, nil, fmt.Errorf("column %s not found in %s", column, r.Table)
+		}
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	var conditions []string
+	var args []interface{}
+	for _, column := range columns {
+		args = append(args, filter[column])
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", pq.QuoteIdentifier(column), len(args)))
+	}
+	if r.DeletedAtColumn != "" {
+		conditions = append(conditions, fmt.Sprintf("%s IS NULL", pq.QuoteIdentifier(r.DeletedAtColumn)))
+	}
+
+	return conditions, args, nil
+}
+
+// selectList returns the quoted columns, separated by commas.
+func (r *Repository[T]) selectList() string {
+	quoted := make([]string, len(r.columns))
+	for i, column := range r.columns {
+		quoted[i] = pq.QuoteIdentifier(column)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// hasColumn checks whether the column is mapped.
+func (r *Repository[T]) hasColumn(column string) bool {
+	for _, c := range r.columns {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
+
+// values returns the values of the mapped fields of the entity.
+func (r *Repository[T]) values(entity *T) []interface{} {
+	v := reflect.ValueOf(entity).Elem()
+	values := make([]interface{}, len(r.indices))
+	for i, index := range r.indices {
+		values[i] = v.Field(index).Interface()
+	}
+	return values
+}
+
+// pointers returns pointers to the mapped fields of the entity.
+func (r *Repository[T]) pointers(entity *T) []interface{} {
+	v := reflect.ValueOf(entity).Elem()
+	pointers := make([]interface{}, len(r.indices))
+	for i, index := range r.indices {
+		pointers[i] = v.Field(index).Addr().Interface()
+	}
+	return pointers
+}
+
+// field returns the mapped field of the entity for the column, which NewRepository checked to be mapped.
+func (r *Repository[T]) field(entity *T, column string) reflect.Value {
+	for i, c := range r.columns {
+		if c == column {
+			return reflect.ValueOf(entity).Elem().Field(r.indices[i])
+		}
+	}
+	return reflect.Value{}
+}
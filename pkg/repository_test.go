@@ -0,0 +1,41 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// mappedEntity is an entity with an unexported field which is not mapped.
+type mappedEntity struct {
+	ID      int    `db:"id"`
+	Name    string `db:"name"`
+	Version int    `db:"version"`
+	cache   string
+}
+
+// TestNewRepository tests whether the mapping of the entity is validated.
+func TestNewRepository(t *testing.T) {
+	repository, err := NewRepository[mappedEntity](nil, "entities", WithVersionColumn("version"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"id", "name", "version"}, repository.Columns())
+
+	entity := &mappedEntity{ID: 1, Name: "John", Version: 2, cache: "ignored"}
+	assert.Equal(t, []interface{}{1, "John", 2}, repository.values(entity))
+	assert.Len(t, repository.pointers(entity), 3)
+
+	_, err = NewRepository[mappedEntity](nil, "entities", WithKeyColumn("uuid"))
+	assert.Error(t, err)
+	_, err = NewRepository[mappedEntity](nil, "entities", WithVersionColumn("revision"))
+	assert.Error(t, err)
+	_, err = NewRepository[mappedEntity](nil, "entities", WithVersionColumn("name"))
+	assert.Error(t, err)
+	_, err = NewRepository[struct {
+		ID   int    `db:"id"`
+		name string `db:"name"`
+	}](nil, "entities")
+	assert.Error(t, err)
+	_, err = NewRepository[struct {
+		ID int `db:"id"`
+	}](nil, "entities")
+	assert.Error(t, err)
+}
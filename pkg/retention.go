@@ -0,0 +1,530 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// errRetentionLocked is returned by a batch when another instance holds the lock of the policy.
+var errRetentionLocked = errors.New("retention policy locked")
+
+// createRetentionCheckpointsTableQuery creates the table holding the checkpoints of retention runs.
+const createRetentionCheckpointsTableQuery = `CREATE TABLE IF NOT EXISTS retention_checkpoints (
+		policy_key text PRIMARY KEY,
+		table_name text NOT NULL,
+		cutoff timestamptz NOT NULL,
+		batches int NOT NULL,
+		rows_processed bigint NOT NULL,
+		is_completed boolean NOT NULL DEFAULT false,
+		updated_at timestamptz NOT NULL DEFAULT now()
+	)`
+
+// saveRetentionCheckpointQuery inserts or updates a retention checkpoint.
+const saveRetentionCheckpointQuery = `INSERT INTO retention_checkpoints (policy_key, table_name, cutoff, batches, rows_processed, is_completed, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, now())
+	ON CONFLICT (policy_key) DO UPDATE SET cutoff = EXCLUDED.cutoff, batches = EXCLUDED.batches,
+		rows_processed = EXCLUDED.rows_processed, is_completed = EXCLUDED.is_completed, updated_at = EXCLUDED.updated_at`
+
+// RetentionPolicy declares how long the rows of a table are retained, and what happens to them afterwards.
+type RetentionPolicy struct {
+	Table        string
+	TimeColumn   string
+	KeyColumn    string
+	RetainFor    time.Duration
+	ArchiveTable string
+	ExportDir    string
+	BatchSize    int
+	Pause        time.Duration
+	Interval     time.Duration
+	lastRun      time.Time
+}
+
+// RetentionPolicyOption is used to instantiate a RetentionPolicy with the provided settings.
+type RetentionPolicyOption func(*RetentionPolicy)
+
+// NewRetentionPolicy creates a new instance of RetentionPolicy, which purges the rows of the table of which the time column
+// is older than the retention period.
+func NewRetentionPolicy(table, timeColumn string, retainFor time.Duration, options ...RetentionPolicyOption) *RetentionPolicy {
+	policy := &RetentionPolicy{
+		Table:      table,
+		TimeColumn: timeColumn,
+		KeyColumn:  "id",
+		RetainFor:  retainFor,
+		BatchSize:  1000,
+		Pause:      time.Second,
+		Interval:   time.Hour,
+	}
+	for _, option := range options {
+		option(policy)
+	}
+	return policy
+}
+
+// WithRetentionKey sets the column which uniquely identifies the rows, by which batches are selected.
+func WithRetentionKey(column string) RetentionPolicyOption {
+	return func(p *RetentionPolicy) {
+		p.KeyColumn = column
+	}
+}
+
+// WithArchiveTable moves the rows into the archive table, which is created like the table when it does not exist yet.
+// An existing archive table may hold additional columns after those of the table, which are filled with their defaults.
+func WithArchiveTable(table string) RetentionPolicyOption {
+	return func(p *RetentionPolicy) {
+		p.ArchiveTable = table
+	}
+}
+
+// WithArchiveExport writes the rows of every batch to a .csv file in the directory before they are purged.
+// The file is written before the batch commits, so a batch which fails to commit is exported again by the next run.
+func WithArchiveExport(dir string) RetentionPolicyOption {
+	return func(p *RetentionPolicy) {
+		p.ExportDir = dir
+	}
+}
+
+// WithRetentionBatches sets the maximum number of rows purged per batch, and the pause between batches.
+func WithRetentionBatches(size int, pause time.Duration) RetentionPolicyOption {
+	return func(p *RetentionPolicy) {
+		p.BatchSize = size
+		p.Pause = pause
+	}
+}
+
+// WithRetentionInterval sets how often the scheduler runs the policy.
+func WithRetentionInterval(interval time.Duration) RetentionPolicyOption {
+	return func(p *RetentionPolicy) {
+		p.Interval = interval
+	}
+}
+
+// validate checks whether the policy can be run.
+func (p *RetentionPolicy) validate() error {
+	if p.Table == "" || p.TimeColumn == "" || p.KeyColumn == "" {
+		return errors.New("retention policy requires a table, a time column and a key column")
+	}
+	if p.ArchiveTable == p.Table {
+		return fmt.Errorf("table %s cannot be archived into itself", p.Table)
+	}
+	if p.BatchSize <= 0 {
+		return fmt.Errorf("invalid batch size %d", p.BatchSize)
+	}
+	return nil
+}
+
+// key identifies the policy, so several policies on the same table keep their own checkpoints and locks.
+func (p *RetentionPolicy) key() string {
+	return fmt.Sprintf("%s:%s:%s:%s", p.Table, p.TimeColumn, p.RetainFor, p.ArchiveTable)
+}
+
+// purgeQuery deletes a batch of the rows older than the cutoff, the oldest first, and copies them into the archive table
+// when configured. It selects the purged rows when they are exported, and counts them otherwise.
+func (p *RetentionPolicy) purgeQuery() string {
+	table, key, timeColumn := quoteTableName(p.Table), pq.QuoteIdentifier(p.KeyColumn), pq.QuoteIdentifier(p.TimeColumn)
+	query := fmt.Sprintf("WITH purged AS (DELETE FROM %[1]s WHERE %[2]s IN "+
+		"(SELECT %[2]s FROM %[1]s WHERE %[3]s < $1 ORDER BY %[3]s LIMIT $2 FOR UPDATE SKIP LOCKED) RETURNING *)", table, key, timeColumn)
+	if p.ArchiveTable != "" {
+		query += fmt.Sprintf(", archived AS (INSERT INTO %s SELECT * FROM purged)", quoteTableName(p.ArchiveTable))
+	}
+	if p.ExportDir != "" {
+		return query + " SELECT * FROM purged"
+	}
+	return query + " SELECT COUNT(*) FROM purged"
+}
+
+// remainingQuery checks whether any rows older than the cutoff remain.
+func (p *RetentionPolicy) remainingQuery() string {
+	return fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE %s < $1)", quoteTableName(p.Table), pq.QuoteIdentifier(p.TimeColumn))
+}
+
+// exportPath returns the path of the .csv file to which the batch of the run is exported.
+func (p *RetentionPolicy) exportPath(cutoff time.Time, batch int) string {
+	return filepath.Join(p.ExportDir, fmt.Sprintf("%s_%s_%06d.csv", p.Table, cutoff.UTC().Format("20060102T150405"), batch))
+}
+
+// RetentionCheckpoint represents how far a retention run got, as of its last committed batch.
+type RetentionCheckpoint struct {
+	Policy        string
+	Table         string
+	Cutoff        time.Time
+	Batches       int
+	RowsProcessed int
+	IsCompleted   bool
+	UpdatedAt     time.Time
+}
+
+// RetentionProgress is handed to a RetentionObserver after every committed batch.
+type RetentionProgress struct {
+	Table         string
+	Cutoff        time.Time
+	Batch         int
+	BatchRows     int
+	RowsProcessed int
+	Elapsed       time.Duration
+}
+
+// RetentionObserver receives the progress of retention runs.
+type RetentionObserver func(progress RetentionProgress)
+
+// RetentionResult summarises a run of a retention policy.
+type RetentionResult struct {
+	Table         string
+	Cutoff        time.Time
+	Batches       int
+	RowsProcessed int
+	ExportedFiles []string
+	IsCompleted   bool
+	IsSkipped     bool
+	Duration      time.Duration
+}
+
+// RetentionSvcOption is used to instantiate a RetentionSvc with the provided settings/configurations/actions.
+type RetentionSvcOption func(*RetentionSvc)
+
+// RetentionOps represents operations related to purging and archiving old rows.
+type RetentionOps interface {
+	AddPolicies(policies ...*RetentionPolicy)
+	RunPolicy(ctx context.Context, policy *RetentionPolicy) (*RetentionResult, error)
+	RunDuePolicies(ctx context.Context) ([]*RetentionResult, error)
+	StartScheduler()
+	StopScheduler()
+}
+
+// RetentionSvc purges the rows of tables past their retention in bounded batches, as declared by the policies.
+// Every batch commits along with a checkpoint in the retention_checkpoints table, so an interrupted run resumes with its
+// original cutoff. Batches hold an advisory lock on the policy, so several instances can run the same policies.
+type RetentionSvc struct {
+	Database           *DbSvc
+	Policies           []*RetentionPolicy
+	Interval           time.Duration
+	Observer           RetentionObserver
+	IsSchedulerEnabled bool
+	mu                 sync.Mutex
+}
+
+// NewRetentionSvc creates a new instance of RetentionSvc.
+func NewRetentionSvc(database *DbSvc, options ...RetentionSvcOption) *RetentionSvc {
+	retention := &RetentionSvc{
+		Database: database,
+		Interval: time.Minute,
+	}
+	for _, option := range options {
+		option(retention)
+	}
+	return retention
+}
+
+// WithRetentionPolicies adds the policies to the service.
+func WithRetentionPolicies(policies ...*RetentionPolicy) RetentionSvcOption {
+	return func(r *RetentionSvc) {
+		r.Policies = append(r.Policies, policies...)
+	}
+}
+
+// WithRetentionCheckInterval sets how often the scheduler checks which policies are due.
+func WithRetentionCheckInterval(interval time.Duration) RetentionSvcOption {
+	return func(r *RetentionSvc) {
+		r.Interval = interval
+	}
+}
+
+// WithRetentionObserver hands the progress of every committed batch to the observer.
+func WithRetentionObserver(observer RetentionObserver) RetentionSvcOption {
+	return func(r *RetentionSvc) {
+		r.Observer = observer
+	}
+}
+
+// AddPolicies adds the policies to those run by the scheduler.
+func (r *RetentionSvc) AddPolicies(policies ...*RetentionPolicy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Policies = append(r.Policies, policies...)
+}
+
+// RunPolicy purges the rows past the retention of the policy, batch by batch with a pause in between,
+// until no rows older than the cutoff remain. A run interrupted before then is resumed by the next one, as is a run of
+// which the remaining rows are locked by others.
+// The run is skipped when another instance is running the policy.
+func (r *RetentionSvc) RunPolicy(ctx context.Context, policy *RetentionPolicy) (*RetentionResult, error) {
+	start := time.Now()
+	result := &RetentionResult{Table: policy.Table}
+	defer func() { result.Duration = time.Since(start) }()
+
+	if err := policy.validate(); err != nil {
+		return result, err
+	}
+	if err := r.prepare(ctx, policy); err != nil {
+		return result, err
+	}
+
+	for !result.IsCompleted {
+		batches, processed := result.Batches, result.RowsProcessed
+		err := r.Database.RunInTransaction(ctx, func(tx *sql.Tx) error {
+			return r.runBatch(ctx, tx, policy, result)
+		})
+		if errors.Is(err, errRetentionLocked) {
+			result.IsSkipped = result.Batches == 0
+			return result, nil
+		}
+		if err != nil {
+			return result, err
+		}
+
+		if r.Observer != nil && result.Batches > batches {
+			r.Observer(RetentionProgress{Table: policy.Table, Cutoff: result.Cutoff, Batch: result.Batches,
+				BatchRows: result.RowsProcessed - processed, RowsProcessed: result.RowsProcessed, Elapsed: time.Since(start)})
+		}
+		if result.IsCompleted || result.RowsProcessed == processed {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return result, fmt.Errorf("retention of %s canceled after %d batches: %w", policy.Table, result.Batches, ctx.Err())
+		case <-time.After(policy.Pause):
+		}
+	}
+	return result, nil
+}
+
+// prepare creates the checkpoints table, the archive table and the export directory, as far as required.
+func (r *RetentionSvc) prepare(ctx context.Context, policy *RetentionPolicy) error {
+	err := r.Database.RunGuarded(false, func(db *sql.DB) error {
+		if _, err := db.ExecContext(ctx, createRetentionCheckpointsTableQuery); err != nil {
+			return fmt.Errorf("failed to create retention checkpoints table: %w", ClassifyError(err))
+		}
+
+		if policy.ArchiveTable != "" {
+			_, err := db.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (LIKE %s)",
+				quoteTableName(policy.ArchiveTable), quoteTableName(policy.Table)))
+			if err != nil {
+				return fmt.Errorf("failed to create archive table %s: %w", policy.ArchiveTable, ClassifyError(err))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if policy.ExportDir != "" {
+		if err := os.MkdirAll(policy.ExportDir, 0o755); err != nil {
+			return fmt.Errorf("failed to create export directory: %w", err)
+		}
+	}
+	return nil
+}
+
+// runBatch purges a batch under the advisory lock of the policy, and saves the checkpoint within the same transaction.
+// The first batch of a run resumes an incomplete checkpoint, or starts over with a new cutoff.
+func (r *RetentionSvc) runBatch(ctx context.Context, tx *sql.Tx, policy *RetentionPolicy, result *RetentionResult) error {
+	var isLocked bool
+	err := tx.QueryRowContext(ctx, "SELECT pg_try_advisory_xact_lock(hashtext($1))", "retention:"+policy.key()).Scan(&isLocked)
+	if err != nil {
+		return fmt.Errorf("failed to lock retention of %s: %w", policy.Table, ClassifyError(err))
+	}
+	if !isLocked {
+		return errRetentionLocked
+	}
+
+	checkpoint, err := retentionCheckpoint(ctx, tx, policy.key())
+	if err != nil {
+		return err
+	}
+	if checkpoint == nil || (checkpoint.IsCompleted && result.Batches == 0) {
+		checkpoint = &RetentionCheckpoint{Policy: policy.key(), Table: policy.Table, Cutoff: time.Now().Add(-policy.RetainFor)}
+	}
+	if checkpoint.IsCompleted {
+		// Another instance completed the run in between batches
+		result.IsCompleted = true
+		return nil
+	}
+	result.Cutoff = checkpoint.Cutoff
+
+	purged, err := r.purge(ctx, tx, policy, checkpoint, result)
+	if err != nil {
+		return err
+	}
+
+	// Rows skipped as locked by others make a batch short as well, so completion is decided by the rows remaining
+	var isRemaining bool
+	if err = tx.QueryRowContext(ctx, policy.remainingQuery(), checkpoint.Cutoff).Scan(&isRemaining); err != nil {
+		return fmt.Errorf("failed to check remaining rows of %s: %w", policy.Table, ClassifyError(err))
+	}
+
+	checkpoint.Batches++
+	checkpoint.RowsProcessed += purged
+	checkpoint.IsCompleted = !isRemaining
+	_, err = tx.ExecContext(ctx, saveRetentionCheckpointQuery, checkpoint.Policy, checkpoint.Table, checkpoint.Cutoff,
+		checkpoint.Batches, checkpoint.RowsProcessed, checkpoint.IsCompleted)
+	if err != nil {
+		return fmt.Errorf("failed to save retention checkpoint: %w", ClassifyError(err))
+	}
+
+	result.Batches++
+	result.RowsProcessed += purged
+	result.IsCompleted = checkpoint.IsCompleted
+	return nil
+}
+
+// purge purges a batch of rows, exporting them first when configured, and returns their number.
+func (r *RetentionSvc) purge(ctx context.Context, tx *sql.Tx, policy *RetentionPolicy, checkpoint *RetentionCheckpoint,
+	result *RetentionResult) (int, error) {
+	if policy.ExportDir == "" {
+		var purged int
+		if err := tx.QueryRowContext(ctx, policy.purgeQuery(), checkpoint.Cutoff, policy.BatchSize).Scan(&purged); err != nil {
+			return 0, fmt.Errorf("failed to purge %s: %w", policy.Table, ClassifyError(err))
+		}
+		return purged, nil
+	}
+
+	rows, err := tx.QueryContext(ctx, policy.purgeQuery(), checkpoint.Cutoff, policy.BatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge %s: %w", policy.Table, ClassifyError(err))
+	}
+	defer rows.Close()
+
+	filePath := policy.exportPath(checkpoint.Cutoff, checkpoint.Batches+1)
+	purged, err := exportRows(rows, filePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to export %s: %w", policy.Table, err)
+	}
+	if purged > 0 {
+		result.ExportedFiles = append(result.ExportedFiles, filePath)
+	} else if err = os.Remove(filePath); err != nil {
+		return 0, fmt.Errorf("failed to export %s: %w", policy.Table, err)
+	}
+	return purged, nil
+}
+
+// retentionCheckpoint retrieves the checkpoint of the policy, or nil when it has not been run before.
+func retentionCheckpoint(ctx context.Context, tx *sql.Tx, policyKey string) (*RetentionCheckpoint, error) {
+	checkpoint := &RetentionCheckpoint{}
+	err := tx.QueryRowContext(ctx, `SELECT policy_key, table_name, cutoff, batches, rows_processed, is_completed, updated_at
+		FROM retention_checkpoints WHERE policy_key = $1`, policyKey).Scan(&checkpoint.Policy, &checkpoint.Table,
+		&checkpoint.Cutoff, &checkpoint.Batches, &checkpoint.RowsProcessed, &checkpoint.IsCompleted, &checkpoint.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve retention checkpoint: %w", ClassifyError(err))
+	}
+	return checkpoint, nil
+}
+
+// exportRows writes the rows, preceded by their column names, to the .csv file and returns their number.
+func exportRows(rows *sql.Rows, filePath string) (int, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if err = writer.Write(columns); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	record := make([]string, len(columns))
+	for rows.Next() {
+		if err = rows.Scan(pointers...); err != nil {
+			return 0, err
+		}
+		for i, value := range values {
+			record[i] = formatExportValue(value)
+		}
+		if err = writer.Write(record); err != nil {
+			return 0, err
+		}
+		count++
+	}
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	writer.Flush()
+	if err = writer.Error(); err != nil {
+		return 0, err
+	}
+	return count, file.Close()
+}
+
+// formatExportValue formats a value scanned from the database for a .csv file, with NULL as an empty field.
+func formatExportValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// RunDuePolicies runs the policies of which the interval elapsed since their last run, one after the other.
+// A failing policy does not prevent the others from running; the errors are joined.
+func (r *RetentionSvc) RunDuePolicies(ctx context.Context) ([]*RetentionResult, error) {
+	r.mu.Lock()
+	var policies []*RetentionPolicy
+	for _, policy := range r.Policies {
+		if !policy.lastRun.IsZero() && time.Since(policy.lastRun) < policy.Interval {
+			continue
+		}
+		policy.lastRun = time.Now()
+		policies = append(policies, policy)
+	}
+	r.mu.Unlock()
+
+	var results []*RetentionResult
+	var errs []error
+	for _, policy := range policies {
+		result, err := r.RunPolicy(ctx, policy)
+		results = append(results, result)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed retention of %s: %w", policy.Table, err))
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// StartScheduler continuously runs the due policies until the scheduler is stopped.
+func (r *RetentionSvc) StartScheduler() {
+	r.IsSchedulerEnabled = true
+	for {
+		if !r.IsSchedulerEnabled {
+			break
+		}
+		if _, err := r.RunDuePolicies(context.Background()); err != nil {
+			log.Printf("Failed to run retention policies: %s", err.Error())
+		}
+		time.Sleep(r.Interval)
+	}
+}
+
+// StopScheduler disables the scheduler.
+func (r *RetentionSvc) StopScheduler() {
+	r.IsSchedulerEnabled = false
+}
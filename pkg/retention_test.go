@@ -0,0 +1,46 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// TestRetentionPurgeQuery tests whether batches are purged oldest first, archived and exported as configured.
+func TestRetentionPurgeQuery(t *testing.T) {
+	policy := NewRetentionPolicy("events", "created_at", time.Hour)
+	purge := `WITH purged AS (DELETE FROM "events" WHERE "id" IN ` +
+		`(SELECT "id" FROM "events" WHERE "created_at" < $1 ORDER BY "created_at" LIMIT $2 FOR UPDATE SKIP LOCKED) RETURNING *)`
+	assert.Equal(t, purge+` SELECT COUNT(*) FROM purged`, policy.purgeQuery())
+
+	policy = NewRetentionPolicy("events", "created_at", time.Hour, WithArchiveTable("events_archive"), WithArchiveExport("exports"))
+	assert.Equal(t, purge+`, archived AS (INSERT INTO "events_archive" SELECT * FROM purged) SELECT * FROM purged`, policy.purgeQuery())
+	policy = NewRetentionPolicy("audit.events", "created_at", time.Hour, WithArchiveTable("archive.events"))
+	assert.Equal(t, `WITH purged AS (DELETE FROM "audit"."events" WHERE "id" IN `+
+		`(SELECT "id" FROM "audit"."events" WHERE "created_at" < $1 ORDER BY "created_at" LIMIT $2 FOR UPDATE SKIP LOCKED) RETURNING *), `+
+		`archived AS (INSERT INTO "archive"."events" SELECT * FROM purged) SELECT COUNT(*) FROM purged`, policy.purgeQuery())
+}
+
+// TestRetentionPolicyValidation tests whether policies which cannot be run are refused.
+func TestRetentionPolicyValidation(t *testing.T) {
+	assert.NoError(t, NewRetentionPolicy("events", "created_at", time.Hour).validate())
+	assert.Error(t, NewRetentionPolicy("events", "", time.Hour).validate())
+	assert.Error(t, NewRetentionPolicy("events", "created_at", time.Hour, WithArchiveTable("events")).validate())
+	assert.Error(t, NewRetentionPolicy("events", "created_at", time.Hour, WithRetentionBatches(0, 0)).validate())
+}
+
+// TestFormatExportValue tests whether scanned values are formatted for a .csv file.
+func TestFormatExportValue(t *testing.T) {
+	assert.Equal(t, "", formatExportValue(nil))
+	assert.Equal(t, "text", formatExportValue([]byte("text")))
+	assert.Equal(t, "42", formatExportValue(int64(42)))
+	assert.Equal(t, "2024-01-02T03:04:05Z", formatExportValue(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)))
+}
+
+// TestRetentionPolicyKey tests whether policies on the same table are told apart.
+func TestRetentionPolicyKey(t *testing.T) {
+	policy := NewRetentionPolicy("events", "created_at", time.Hour)
+	assert.Equal(t, policy.key(), NewRetentionPolicy("events", "created_at", time.Hour).key())
+	assert.NotEqual(t, policy.key(), NewRetentionPolicy("events", "created_at", 2*time.Hour).key())
+	assert.NotEqual(t, policy.key(), NewRetentionPolicy("events", "created_at", time.Hour, WithArchiveTable("events_archive")).key())
+}
@@ -0,0 +1,118 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+)
+
+// ownedSequencesQuery retrieves the sequences owned by columns, either through serial or identity columns,
+// of the tables provided, or of every table outside the system schemas when none are provided.
+const ownedSequencesQuery = `SELECT tn.nspname, t.relname, a.attname, sn.nspname, s.relname
+	FROM pg_depend d
+	JOIN pg_class s ON s.oid = d.objid AND s.relkind = 'S'
+	JOIN pg_namespace sn ON sn.oid = s.relnamespace
+	JOIN pg_class t ON t.oid = d.refobjid
+	JOIN pg_namespace tn ON tn.oid = t.relnamespace
+	JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = d.refobjsubid
+	WHERE d.classid = 'pg_class'::regclass AND d.refclassid = 'pg_class'::regclass AND d.deptype IN ('a', 'i')
+	AND (cardinality($1::text[]) = 0 OR t.oid = ANY($1::text[]::regclass[]))
+	AND tn.nspname NOT IN ('pg_catalog', 'information_schema')
+	ORDER BY tn.nspname, t.relname, a.attname`
+
+// advanceSequenceQuery advances the sequence to the maximum value of the column, unless its next value already lies beyond.
+const advanceSequenceQuery = `SELECT setval(%s, m.max) FROM (SELECT MAX(%s) AS max FROM %s) m, %s s
+	WHERE m.max IS NOT NULL AND m.max >= s.last_value + CASE WHEN s.is_called THEN 1 ELSE 0 END`
+
+// WithSequenceResync advances the sequences of serial and identity columns past the maximum value loaded,
+// so following inserts relying on them do not conflict with the imported rows.
+func WithSequenceResync() ImportOption {
+	return func(c *ImportConfig) {
+		c.ResyncSequences = true
+	}
+}
+
+// SequenceResync describes a sequence which has been advanced.
+type SequenceResync struct {
+	Table    string
+	Column   string
+	Sequence string
+	Value    int64
+}
+
+// ownedSequence represents a sequence owned by a column.
+type ownedSequence struct {
+	schema         string
+	table          string
+	column         string
+	sequenceSchema string
+	sequence       string
+}
+
+// ResyncSequences advances the sequences of serial and identity columns of the tables past the maximum value of their column.
+// Without tables, the sequences of every table outside the system schemas are resynchronised.
+func (d *DbSvc) ResyncSequences(ctx context.Context, tables ...string) ([]*SequenceResync, error) {
+	var resyncs []*SequenceResync
+	err := d.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		var err error
+		resyncs, err = resyncSequences(ctx, tx, tables)
+		return err
+	})
+	return resyncs, err
+}
+
+// resyncSequences advances the sequences owned by columns of the tables, each of which may be qualified by its schema.
+func resyncSequences(ctx context.Context, runner queryer, tables []string) ([]*SequenceResync, error) {
+	identifiers := make([]string, len(tables))
+	for i, table := range tables {
+		identifiers[i] = quoteTableName(table)
+	}
+
+	sequences, err := ownedSequences(ctx, runner, identifiers)
+	if err != nil {
+		return nil, err
+	}
+
+	var resyncs []*SequenceResync
+	for _, s := range sequences {
+		table := fmt.Sprintf("%s.%s", pq.QuoteIdentifier(s.schema), pq.QuoteIdentifier(s.table))
+		sequence := fmt.Sprintf("%s.%s", pq.QuoteIdentifier(s.sequenceSchema), pq.QuoteIdentifier(s.sequence))
+		query := fmt.Sprintf(advanceSequenceQuery, pq.QuoteLiteral(sequence), pq.QuoteIdentifier(s.column), table, sequence)
+
+		var value int64
+		err = runner.QueryRowContext(ctx, query).Scan(&value)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to advance sequence %s: %w", sequence, ClassifyError(err))
+		}
+		resyncs = append(resyncs, &SequenceResync{Table: table, Column: s.column, Sequence: sequence, Value: value})
+	}
+	return resyncs, nil
+}
+
+// ownedSequences retrieves the sequences owned by columns of the tables, or of every table when none are provided.
+func ownedSequences(ctx context.Context, runner queryer, tables []string) ([]*ownedSequence, error) {
+	rows, err := runner.QueryContext(ctx, ownedSequencesQuery, pq.Array(tables))
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve sequences: %w", ClassifyError(err))
+	}
+	defer rows.Close()
+
+	var sequences []*ownedSequence
+	for rows.Next() {
+		s := &ownedSequence{}
+		if err = rows.Scan(&s.schema, &s.table, &s.column, &s.sequenceSchema, &s.sequence); err != nil {
+			return nil, fmt.Errorf("failed to retrieve sequences: %w", ClassifyError(err))
+		}
+		sequences = append(sequences, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to retrieve sequences: %w", ClassifyError(err))
+	}
+	return sequences, nil
+}
@@ -1,6 +1,7 @@
 package pkg
 
 import (
+	"fmt"
 	"github.com/alexedwards/scs/postgresstore"
 	"github.com/alexedwards/scs/v2"
 	"net/http"
@@ -8,15 +9,16 @@ import (
 
 // SessionManager is for managing sessions.
 type SessionManager struct {
-	Database *DbSvc
-	Manager  *scs.SessionManager
+	Database      *DbSvc
+	Manager       *scs.SessionManager
+	ClaimSettings map[string]string
 }
 
 // NewSessionManager creates a new instance of the SessionManager struct.
 func NewSessionManager(database *DbSvc) *SessionManager {
 	sessionManager := scs.New()
 	sessionManager.Store = postgresstore.New(database.DB())
-	return &SessionManager{Database: database, Manager: sessionManager}
+	return &SessionManager{Database: database, Manager: sessionManager, ClaimSettings: map[string]string{}}
 }
 
 // Store stores a value in the session using the provided key and value.
@@ -28,3 +30,28 @@ func (s *SessionManager) Store(request *http.Request, key string, value interfac
 func (s *SessionManager) Get(request *http.Request, key string) interface{} {
 	return s.Manager.Get(request.Context(), key)
 }
+
+// MapClaim makes the value stored in the session under the key available as the provided security claim setting.
+func (s *SessionManager) MapClaim(key, setting string) {
+	s.ClaimSettings[key] = setting
+}
+
+// Claims returns the security claims of the logged-in user, derived from the values stored in the session.
+func (s *SessionManager) Claims(request *http.Request) SecurityClaims {
+	claims := SecurityClaims{}
+	for key, setting := range s.ClaimSettings {
+		if value := s.Get(request, key); value != nil {
+			claims[setting] = fmt.Sprint(value)
+		}
+	}
+	return claims
+}
+
+// ClaimsMiddleware attaches the security claims of the logged-in user to the context of every request.
+// It must be wrapped by the LoadAndSave middleware of the Manager, so the session is available.
+func (s *SessionManager) ClaimsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ctx := ContextWithClaims(request.Context(), s.Claims(request))
+		next.ServeHTTP(writer, request.WithContext(ctx))
+	})
+}
@@ -57,3 +57,9 @@ func (t *SSHTunnel) Start() {
 func (t *SSHTunnel) Close() {
 	t.SSHTunnel.Close()
 }
+
+// RewriteDSN points the host and port of the DSN at the local end of the SSH Tunnel.
+func (t *SSHTunnel) RewriteDSN(dsn *DSN) {
+	dsn.Host = t.Local.Host
+	dsn.Port = t.Local.Port
+}
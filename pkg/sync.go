@@ -0,0 +1,325 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"strings"
+	"time"
+)
+
+// The actions applied to rows when synchronising a table.
+const (
+	SyncInsert = "insert"
+	SyncUpdate = "update"
+	SyncDelete = "delete"
+)
+
+// ErrIncompleteSnapshot is returned when rows of a snapshot were rejected, as their rows would be deleted from the table.
+var ErrIncompleteSnapshot = errors.New("incomplete snapshot")
+
+// WithSyncSoftDelete marks rows missing from the snapshot as deleted by setting the column to the current time,
+// instead of deleting them. Rows which reappear in a later snapshot have the column cleared again.
+func WithSyncSoftDelete(column string) ImportOption {
+	return func(c *ImportConfig) {
+		c.SoftDeleteColumn = column
+	}
+}
+
+// WithChangeLog lists the key of every row inserted, updated or deleted by a synchronisation.
+func WithChangeLog() ImportOption {
+	return func(c *ImportConfig) {
+		c.ChangeLog = true
+	}
+}
+
+// SyncChange represents a row changed by a synchronisation, identified by its key.
+type SyncChange struct {
+	Action string
+	Key    map[string]interface{}
+}
+
+// SyncResult summarises a synchronisation; for a dry run, it describes the changes which would have been applied.
+type SyncResult struct {
+	Table    string
+	DryRun   bool
+	Inserted int
+	Updated  int
+	Deleted  int
+	Changes  []*SyncChange
+	Import   *ImportResult
+	Duration time.Duration
+}
+
+// tableSync holds the SQL building blocks to synchronise a table with a staging table.
+type tableSync struct {
+	table      string
+	staging    string
+	fields     []string
+	keyColumns []string
+	config     *ImportConfig
+	result     *SyncResult
+}
+
+// SyncCSVFile makes the table match the snapshot in the .csv file, matching rows on the key columns: rows missing from
+// the table are inserted, rows of which a field differs are updated, and rows missing from the snapshot are deleted.
+// The snapshot is staged, the differences are computed in SQL and applied within a single transaction.
+// A dry run previews the changes without applying them.
+// Rows rejected within the error budget are reported, but the snapshot is not applied, as their rows would be deleted.
+func (d *DbSvc) SyncCSVFile(ctx context.Context, filePath, table string, fields, keyColumns []string, options ...ImportOption) (*SyncResult, error) {
+	start := time.Now()
+	config := newImportConfig(options)
+	result := &SyncResult{Table: table, DryRun: config.DryRun}
+	result.Import = &ImportResult{Table: table, FilePath: filePath, DryRun: config.DryRun}
+	defer func() { result.Duration = time.Since(start) }()
+
+	if err := validateKeyColumns(fields, keyColumns); err != nil {
+		return result, err
+	}
+
+	err := d.runImportTransaction(ctx, config, func(tx *sql.Tx) error {
+		staging := stagingTableName(table, "sync")
+		if err := createStagingTable(ctx, tx, staging, table, fields); err != nil {
+			return err
+		}
+
+		// Stage the snapshot, applying the import options such as coercion and the error budget
+		if err := stageCSV(ctx, tx, staging, fields, config, result.Import); err != nil {
+			return err
+		}
+		if result.Import.RowsRejected > 0 {
+			return fmt.Errorf("%w: %d rows were rejected, first at line %d: %s", ErrIncompleteSnapshot,
+				result.Import.RowsRejected, result.Import.Failures[0].Line, result.Import.Failures[0].Reason)
+		}
+
+		s := &tableSync{table: table, staging: staging, fields: fields, keyColumns: keyColumns, config: config, result: result}
+		return s.apply(ctx, tx)
+	})
+	if err != nil {
+		result.Inserted, result.Updated, result.Deleted, result.Changes = 0, 0, 0, nil
+	}
+	return result, err
+}
+
+// validateKeyColumns checks whether there are key columns, each of which is one of the fields.
+func validateKeyColumns(fields, keyColumns []string) error {
+	if len(keyColumns) == 0 {
+		return errors.New("no key columns provided")
+	}
+	for _, key := range keyColumns {
+		if !contains(fields, key) {
+			return fmt.Errorf("key column %s is not one of the fields", key)
+		}
+	}
+	return nil
+}
+
+// stagingTableName names a staging table of the table after its unqualified name, so it is unique within the session.
+func stagingTableName(table, purpose string) string {
+	_, name := splitTableName(table)
+	return fmt.Sprintf("%s_%s_%d", name, purpose, time.Now().UnixNano())
+}
+
+// createStagingTable creates a temporary table, dropped on commit, with the fields of the table.
+func createStagingTable(ctx context.Context, tx *sql.Tx, staging, table string, fields []string) error {
+	query := fmt.Sprintf("CREATE TEMPORARY TABLE %s ON COMMIT DROP AS SELECT %s FROM %s WITH NO DATA",
+		pq.QuoteIdentifier(staging), strings.Join(quoteIdentifiers(fields), ", "), quoteTableName(table))
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed creating staging table: %w", ClassifyError(err))
+	}
+	return nil
+}
+
+// apply checks the snapshot holds every key once, and applies the differences.
+func (s *tableSync) apply(ctx context.Context, tx *sql.Tx) error {
+	err := checkKeys(ctx, tx, s.staging, s.keyColumns)
+	if err != nil {
+		return err
+	}
+
+	if s.result.Updated, err = s.exec(ctx, tx, SyncUpdate, s.updateQuery()); err != nil {
+		return err
+	}
+	if s.result.Inserted, err = s.exec(ctx, tx, SyncInsert, s.insertQuery()); err != nil {
+		return err
+	}
+	s.result.Deleted, err = s.exec(ctx, tx, SyncDelete, s.deleteQuery())
+	return err
+}
+
+// checkKeys checks whether the staging table holds every key once, none of which is NULL, as a NULL key matches no row.
+func checkKeys(ctx context.Context, tx *sql.Tx, staging string, keyColumns []string) error {
+	quoted := quoteIdentifiers(keyColumns)
+	nullKeys := make([]string, len(quoted))
+	for i, key := range quoted {
+		nullKeys[i] = key + " IS NULL"
+	}
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", pq.QuoteIdentifier(staging), strings.Join(nullKeys, " OR "))
+
+	var missing int
+	if err := tx.QueryRowContext(ctx, query).Scan(&missing); err != nil {
+		return fmt.Errorf("failed checking keys: %w", ClassifyError(err))
+	}
+	if missing > 0 {
+		return fmt.Errorf("%d rows have a NULL key", missing)
+	}
+
+	keys := strings.Join(quoted, ", ")
+	query = fmt.Sprintf("SELECT COUNT(*) FROM (SELECT %s FROM %s GROUP BY %s HAVING COUNT(*) > 1) duplicates",
+		keys, pq.QuoteIdentifier(staging), keys)
+
+	var duplicates int
+	if err := tx.QueryRowContext(ctx, query).Scan(&duplicates); err != nil {
+		return fmt.Errorf("failed checking keys: %w", ClassifyError(err))
+	}
+	if duplicates > 0 {
+		return fmt.Errorf("%d keys are provided more than once", duplicates)
+	}
+	return nil
+}
+
+// insertQuery inserts the rows of the snapshot missing from the table.
+func (s *tableSync) insertQuery() string {
+	columns := strings.Join(quoteIdentifiers(s.fields), ", ")
+	return fmt.Sprintf("INSERT INTO %s AS t (%s) SELECT %s FROM %s s WHERE NOT EXISTS (SELECT 1 FROM %s t WHERE %s)",
+		quoteTableName(s.table), columns, columns, pq.QuoteIdentifier(s.staging), quoteTableName(s.table),
+		keyCondition("t", "s", s.keyColumns))
+}
+
+// updateQuery updates the rows of which a field differs from the snapshot, restoring soft-deleted rows.
+func (s *tableSync) updateQuery() string {
+	var assignments, tableValues, stagingValues []string
+	for _, field := range s.fields {
+		if contains(s.keyColumns, field) {
+			continue
+		}
+		column := pq.QuoteIdentifier(field)
+		assignments = append(assignments, fmt.Sprintf("%s = s.%s", column, column))
+		tableValues = append(tableValues, "t."+column)
+		stagingValues = append(stagingValues, "s."+column)
+	}
+
+	var differences []string
+	if len(tableValues) > 0 {
+		differences = append(differences, fmt.Sprintf("ROW(%s) IS DISTINCT FROM ROW(%s)",
+			strings.Join(tableValues, ", "), strings.Join(stagingValues, ", ")))
+	}
+	if s.config.SoftDeleteColumn != "" {
+		column := pq.QuoteIdentifier(s.config.SoftDeleteColumn)
+		assignments = append(assignments, fmt.Sprintf("%s = NULL", column))
+		differences = append(differences, fmt.Sprintf("t.%s IS NOT NULL", column))
+	}
+	if len(differences) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("UPDATE %s t SET %s FROM %s s WHERE %s AND (%s)", quoteTableName(s.table),
+		strings.Join(assignments, ", "), pq.QuoteIdentifier(s.staging), keyCondition("t", "s", s.keyColumns),
+		strings.Join(differences, " OR "))
+}
+
+// deleteQuery deletes, or soft-deletes, the rows of the table missing from the snapshot.
+func (s *tableSync) deleteQuery() string {
+	missing := fmt.Sprintf("NOT EXISTS (SELECT 1 FROM %s s WHERE %s)", pq.QuoteIdentifier(s.staging), keyCondition("t", "s", s.keyColumns))
+	if s.config.SoftDeleteColumn == "" {
+		return fmt.Sprintf("DELETE FROM %s t WHERE %s", quoteTableName(s.table), missing)
+	}
+
+	column := pq.QuoteIdentifier(s.config.SoftDeleteColumn)
+	return fmt.Sprintf("UPDATE %s t SET %s = now() WHERE t.%s IS NULL AND %s", quoteTableName(s.table), column, column, missing)
+}
+
+// exec executes the query and returns the number of affected rows; with a change log, the keys of the rows are kept.
+func (s *tableSync) exec(ctx context.Context, tx *sql.Tx, action, query string) (int, error) {
+	if query == "" {
+		return 0, nil
+	}
+
+	if !s.config.ChangeLog {
+		changed, err := tx.ExecContext(ctx, query)
+		if err != nil {
+			return 0, fmt.Errorf("failed to %s rows: %w", action, ClassifyError(err))
+		}
+		affected, err := changed.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("failed to %s rows: %w", action, ClassifyError(err))
+		}
+		return int(affected), nil
+	}
+
+	keys, err := returningKeys(ctx, tx, query, s.keyColumns)
+	if err != nil {
+		return 0, fmt.Errorf("failed to %s rows: %w", action, ClassifyError(err))
+	}
+	for _, key := range keys {
+		s.result.Changes = append(s.result.Changes, &SyncChange{Action: action, Key: key})
+	}
+	return len(keys), nil
+}
+
+// returningKeys executes the query, returning the key columns of the affected rows.
+func returningKeys(ctx context.Context, tx *sql.Tx, query string, keyColumns []string) ([]map[string]interface{}, error) {
+	returning := make([]string, len(keyColumns))
+	for i, key := range keyColumns {
+		returning[i] = "t." + pq.QuoteIdentifier(key)
+	}
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("%s RETURNING %s", query, strings.Join(returning, ", ")))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []map[string]interface{}
+	for rows.Next() {
+		values := make([]interface{}, len(keyColumns))
+		pointers := make([]interface{}, len(keyColumns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err = rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+
+		key := make(map[string]interface{}, len(keyColumns))
+		for i, column := range keyColumns {
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			key[column] = values[i]
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// keyCondition matches the rows of both aliases on the key columns.
+func keyCondition(left, right string, keyColumns []string) string {
+	conditions := make([]string, len(keyColumns))
+	for i, key := range keyColumns {
+		column := pq.QuoteIdentifier(key)
+		conditions[i] = fmt.Sprintf("%s.%s = %s.%s", left, column, right, column)
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+// quoteIdentifiers quotes each of the identifiers.
+func quoteIdentifiers(identifiers []string) []string {
+	quoted := make([]string, len(identifiers))
+	for i, identifier := range identifiers {
+		quoted[i] = pq.QuoteIdentifier(identifier)
+	}
+	return quoted
+}
+
+// contains checks whether the value is one of the values.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// TestTableSyncQueries tests whether the differences between the table and the snapshot are computed on the key columns.
+func TestTableSyncQueries(t *testing.T) {
+	s := &tableSync{
+		table:      "contacts",
+		staging:    "contacts_sync",
+		fields:     []string{"id", "name", "phone"},
+		keyColumns: []string{"id"},
+		config:     newImportConfig(nil),
+	}
+
+	assert.Equal(t, `INSERT INTO "contacts" AS t ("id", "name", "phone") SELECT "id", "name", "phone" FROM "contacts_sync" s `+
+		`WHERE NOT EXISTS (SELECT 1 FROM "contacts" t WHERE t."id" = s."id")`, s.insertQuery())
+	assert.Equal(t, `UPDATE "contacts" t SET "name" = s."name", "phone" = s."phone" FROM "contacts_sync" s `+
+		`WHERE t."id" = s."id" AND (ROW(t."name", t."phone") IS DISTINCT FROM ROW(s."name", s."phone"))`, s.updateQuery())
+	assert.Equal(t, `DELETE FROM "contacts" t WHERE NOT EXISTS (SELECT 1 FROM "contacts_sync" s WHERE t."id" = s."id")`, s.deleteQuery())
+}
+
+// TestTableSyncQueriesWithSoftDelete tests whether missing rows are soft-deleted and reappearing rows restored.
+func TestTableSyncQueriesWithSoftDelete(t *testing.T) {
+	s := &tableSync{
+		table:      "contacts",
+		staging:    "contacts_sync",
+		fields:     []string{"id"},
+		keyColumns: []string{"id"},
+		config:     newImportConfig([]ImportOption{WithSyncSoftDelete("deleted_at")}),
+	}
+
+	assert.Equal(t, `UPDATE "contacts" t SET "deleted_at" = NULL FROM "contacts_sync" s `+
+		`WHERE t."id" = s."id" AND (t."deleted_at" IS NOT NULL)`, s.updateQuery())
+	assert.Equal(t, `UPDATE "contacts" t SET "deleted_at" = now() WHERE t."deleted_at" IS NULL `+
+		`AND NOT EXISTS (SELECT 1 FROM "contacts_sync" s WHERE t."id" = s."id")`, s.deleteQuery())
+}
+
+// TestTableSyncQueriesQualified tests whether a table qualified by its schema is quoted per part.
+func TestTableSyncQueriesQualified(t *testing.T) {
+	s := &tableSync{
+		table:      "crm.contacts",
+		staging:    stagingTableName("crm.contacts", "sync"),
+		fields:     []string{"id"},
+		keyColumns: []string{"id"},
+		config:     newImportConfig(nil),
+	}
+
+	assert.Regexp(t, `^contacts_sync_\d+$`, s.staging)
+	assert.Equal(t, `DELETE FROM "crm"."contacts" t WHERE NOT EXISTS (SELECT 1 FROM "`+s.staging+`" s WHERE t."id" = s."id")`, s.deleteQuery())
+}
+
+// TestValidateKeyColumns tests whether key columns are required to be fields.
+func TestValidateKeyColumns(t *testing.T) {
+	assert.NoError(t, validateKeyColumns([]string{"id", "name"}, []string{"id"}))
+	assert.Error(t, validateKeyColumns([]string{"id", "name"}, nil))
+	assert.Error(t, validateKeyColumns([]string{"name"}, []string{"id"}))
+}
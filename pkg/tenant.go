@@ -0,0 +1,345 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// tenantNamePattern restricts tenant names to those that are safe to use within schema names.
+var tenantNamePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// maxIdentifierLength is the number of bytes beyond which Postgres truncates identifiers, such as schema names.
+const maxIdentifierLength = 63
+
+// Migration represents a versioned change which is applied to the schema of every tenant.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// TenantSvcOption is used to instantiate a TenantSvc with the provided settings/configurations/actions.
+type TenantSvcOption func(*TenantSvc)
+
+// TenantOps represents operations related to schema-per-tenant isolation.
+type TenantOps interface {
+	Tenant(name string) (*Tenant, error)
+	Provision(ctx context.Context, name string) (*Tenant, error)
+	Migrate(ctx context.Context, tenant *Tenant) error
+	Tenants(ctx context.Context) ([]*Tenant, error)
+	ForEachTenant(ctx context.Context, fn func(ctx context.Context, tenant *Tenant) error) error
+}
+
+// TenantSvc manages the tenants, each of which is isolated in its own Postgres schema.
+// The shared schemas follow the schema of the tenant on its search_path, so the objects in them, such as extensions, stay reachable.
+type TenantSvc struct {
+	Database      *DbSvc
+	Registry      string
+	SchemaPrefix  string
+	SharedSchemas []string
+	Migrations    []*Migration
+}
+
+// NewTenantSvc creates a new instance of TenantSvc.
+func NewTenantSvc(database *DbSvc, options ...TenantSvcOption) *TenantSvc {
+	tenants := &TenantSvc{
+		Database:      database,
+		Registry:      "tenants",
+		SchemaPrefix:  "tenant_",
+		SharedSchemas: []string{"public"},
+	}
+	for _, option := range options {
+		option(tenants)
+	}
+	return tenants
+}
+
+// WithTenantRegistry sets the name of the table in which the tenants are registered.
+func WithTenantRegistry(table string) TenantSvcOption {
+	return func(t *TenantSvc) {
+		t.Registry = table
+	}
+}
+
+// WithSchemaPrefix sets the prefix of the schema names of the tenants.
+func WithSchemaPrefix(prefix string) TenantSvcOption {
+	return func(t *TenantSvc) {
+		t.SchemaPrefix = prefix
+	}
+}
+
+// WithSharedSchemas sets the schemas which follow the schema of the tenant on its search_path; none isolates it completely.
+func WithSharedSchemas(schemas ...string) TenantSvcOption {
+	return func(t *TenantSvc) {
+		t.SharedSchemas = schemas
+	}
+}
+
+// WithMigrations sets the migrations which are applied to the schema of every tenant.
+func WithMigrations(migrations ...*Migration) TenantSvcOption {
+	return func(t *TenantSvc) {
+		t.Migrations = migrations
+	}
+}
+
+// Tenant returns a handle scoped to the schema of the tenant, without checking whether it has been provisioned.
+func (t *TenantSvc) Tenant(name string) (*Tenant, error) {
+	if !tenantNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid tenant name %q: only lowercase letters, digits and underscores are allowed", name)
+	}
+	schema := t.SchemaPrefix + name
+	if len(schema) > maxIdentifierLength {
+		return nil, fmt.Errorf("invalid tenant name %q: schema %s exceeds %d bytes", name, schema, maxIdentifierLength)
+	}
+	return &Tenant{Name: name, Schema: schema, SharedSchemas: t.SharedSchemas, Database: t.Database}, nil
+}
+
+// Provision registers the tenant, creates its schema and applies the migrations to it. It is idempotent.
+func (t *TenantSvc) Provision(ctx context.Context, name string) (*Tenant, error) {
+	tenant, err := t.Tenant(name)
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.Database.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		if err := t.createRegistry(ctx, tx); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", pq.QuoteIdentifier(tenant.Schema))); err != nil {
+			return fmt.Errorf("failed creating schema of tenant %s: %w", name, ClassifyError(err))
+		}
+
+		query := fmt.Sprintf("INSERT INTO %s (name, schema_name) VALUES ($1, $2) ON CONFLICT (name) DO NOTHING",
+			pq.QuoteIdentifier(t.Registry))
+		if _, err := tx.ExecContext(ctx, query, tenant.Name, tenant.Schema); err != nil {
+			return fmt.Errorf("failed registering tenant %s: %w", name, ClassifyError(err))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = t.Migrate(ctx, tenant); err != nil {
+		return nil, err
+	}
+
+	return tenant, nil
+}
+
+// createRegistry creates the registry of tenants, if it does not exist yet.
+func (t *TenantSvc) createRegistry(ctx context.Context, tx *sql.Tx) error {
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", t.Registry); err != nil {
+		return fmt.Errorf("failed acquiring tenant registry lock: %w", ClassifyError(err))
+	}
+
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		name text PRIMARY KEY,
+		schema_name text NOT NULL UNIQUE,
+		created_at timestamptz NOT NULL DEFAULT now()
+	)`, pq.QuoteIdentifier(t.Registry)))
+	if err != nil {
+		return fmt.Errorf("failed creating tenant registry: %w", ClassifyError(err))
+	}
+
+	return nil
+}
+
+// Migrate applies the migrations which have not been applied to the schema of the tenant yet, in order of version.
+func (t *TenantSvc) Migrate(ctx context.Context, tenant *Tenant) error {
+	migrations := make([]*Migration, len(t.Migrations))
+	copy(migrations, t.Migrations)
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return tenant.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", tenant.Schema); err != nil {
+			return fmt.Errorf("failed acquiring migration lock of tenant %s: %w", tenant.Name, ClassifyError(err))
+		}
+
+		_, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version int PRIMARY KEY,
+			name text NOT NULL,
+			applied_at timestamptz NOT NULL DEFAULT now()
+		)`)
+		if err != nil {
+			return fmt.Errorf("failed creating migrations table of tenant %s: %w", tenant.Name, ClassifyError(err))
+		}
+
+		for _, migration := range migrations {
+			var applied bool
+			err = tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)", migration.Version).Scan(&applied)
+			if err != nil {
+				return fmt.Errorf("failed checking migration %d of tenant %s: %w", migration.Version, tenant.Name, ClassifyError(err))
+			}
+			if applied {
+				continue
+			}
+
+			if _, err = tx.ExecContext(ctx, migration.SQL); err != nil {
+				return fmt.Errorf("failed applying migration %d of tenant %s: %w", migration.Version, tenant.Name, ClassifyError(err))
+			}
+
+			_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", migration.Version, migration.Name)
+			if err != nil {
+				return fmt.Errorf("failed registering migration %d of tenant %s: %w", migration.Version, tenant.Name, ClassifyError(err))
+			}
+		}
+
+		return nil
+	})
+}
+
+// Tenants returns the registered tenants, ordered by name.
+func (t *TenantSvc) Tenants(ctx context.Context) ([]*Tenant, error) {
+	var tenants []*Tenant
+	err := t.Database.runWithClaims(ctx, true, func(q queryer) error {
+		rows, err := q.QueryContext(ctx, fmt.Sprintf("SELECT name, schema_name FROM %s ORDER BY name", pq.QuoteIdentifier(t.Registry)))
+		if err != nil {
+			return fmt.Errorf("failed retrieving tenants: %w", ClassifyError(err))
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			tenant := &Tenant{SharedSchemas: t.SharedSchemas, Database: t.Database}
+			if err = rows.Scan(&tenant.Name, &tenant.Schema); err != nil {
+				return fmt.Errorf("failed scanning tenant: %w", err)
+			}
+			tenants = append(tenants, tenant)
+		}
+
+		if err = rows.Err(); err != nil {
+			return fmt.Errorf("failed retrieving tenants: %w", ClassifyError(err))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tenants, nil
+}
+
+// ForEachTenant calls fn for every registered tenant, for example to run maintenance jobs.
+// A failing tenant does not stop the iteration; the errors of all tenants are returned together.
+func (t *TenantSvc) ForEachTenant(ctx context.Context, fn func(ctx context.Context, tenant *Tenant) error) error {
+	tenants, err := t.Tenants(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, tenant := range tenants {
+		if err = ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		if err = fn(ctx, tenant); err != nil {
+			errs = append(errs, fmt.Errorf("tenant %s: %w", tenant.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Tenant is a handle of which the transactions and connections are scoped to the schema of a single tenant.
+type Tenant struct {
+	Name          string
+	Schema        string
+	SharedSchemas []string
+	Database      *DbSvc
+}
+
+// searchPath returns the search_path of the tenant, which starts with its own schema followed by the shared ones.
+func (t *Tenant) searchPath() string {
+	schemas := []string{pq.QuoteIdentifier(t.Schema)}
+	for _, schema := range t.SharedSchemas {
+		schemas = append(schemas, pq.QuoteIdentifier(schema))
+	}
+	return strings.Join(schemas, ", ")
+}
+
+// BeginTx starts a transaction in which the search_path is pinned to the schema of the tenant, followed by the shared schemas.
+// The setting is local to the transaction, so it cannot leak onto other uses of the connection.
+func (t *Tenant) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	txn, err := t.Database.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = txn.ExecContext(ctx, "SELECT set_config('search_path', $1, true)", t.searchPath()); err != nil {
+		txn.Rollback()
+		return nil, fmt.Errorf("failed setting search_path of tenant %s: %w", t.Name, ClassifyError(err))
+	}
+
+	return txn, nil
+}
+
+// RunInTransaction executes fn within a transaction scoped to the tenant, which is committed when fn succeeds.
+func (t *Tenant) RunInTransaction(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	txn, err := t.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed starting transaction: %w", err)
+	}
+	defer txn.Rollback()
+
+	if err = fn(txn); err != nil {
+		return err
+	}
+
+	if err = txn.Commit(); err != nil {
+		return fmt.Errorf("failed committing transaction: %w", ClassifyError(err))
+	}
+
+	return nil
+}
+
+// Conn reserves a connection of which the search_path is pinned to the schema of the tenant, followed by the shared schemas, until it is closed.
+// Security claims cannot be applied to a connection outside a transaction, so a context holding them is refused.
+func (t *Tenant) Conn(ctx context.Context) (*TenantConn, error) {
+	if len(ClaimsFromContext(ctx)) > 0 {
+		return nil, fmt.Errorf("connection of tenant %s cannot apply security claims, use a transaction instead", t.Name)
+	}
+
+	var conn *sql.Conn
+	err := t.Database.RunGuarded(false, func(db *sql.DB) error {
+		var err error
+		if conn, err = db.Conn(ctx); err != nil {
+			return fmt.Errorf("failed reserving connection: %w", ClassifyError(err))
+		}
+
+		if _, err = conn.ExecContext(ctx, "SELECT set_config('search_path', $1, false)", t.searchPath()); err != nil {
+			conn.Close()
+			return fmt.Errorf("failed setting search_path of tenant %s: %w", t.Name, ClassifyError(err))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TenantConn{Conn: conn}, nil
+}
+
+// TenantConn is a connection scoped to the schema of a tenant.
+type TenantConn struct {
+	*sql.Conn
+}
+
+// Close resets the search_path and returns the connection to the pool.
+// When resetting fails, the connection is discarded rather than returned with the schema of the tenant.
+func (c *TenantConn) Close() error {
+	if _, err := c.ExecContext(context.Background(), "RESET search_path"); err != nil {
+		c.Raw(func(interface{}) error { return driver.ErrBadConn })
+		return fmt.Errorf("failed resetting search_path: %w", ClassifyError(err))
+	}
+	return c.Conn.Close()
+}
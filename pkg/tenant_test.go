@@ -0,0 +1,25 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// TestTenant tests whether tenant names are validated and their search_path is followed by the shared schemas.
+func TestTenant(t *testing.T) {
+	tenant, err := NewTenantSvc(nil).Tenant("acme")
+	assert.NoError(t, err)
+	assert.Equal(t, `"tenant_acme", "public"`, tenant.searchPath())
+
+	tenant, err = NewTenantSvc(nil, WithSharedSchemas()).Tenant("acme")
+	assert.NoError(t, err)
+	assert.Equal(t, `"tenant_acme"`, tenant.searchPath())
+
+	_, err = NewTenantSvc(nil).Tenant("Acme")
+	assert.Error(t, err)
+	_, err = NewTenantSvc(nil).Tenant(strings.Repeat("a", maxIdentifierLength-len("tenant_")))
+	assert.NoError(t, err)
+	_, err = NewTenantSvc(nil).Tenant(strings.Repeat("a", maxIdentifierLength-len("tenant_")+1))
+	assert.Error(t, err)
+}
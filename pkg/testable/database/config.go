@@ -12,10 +12,26 @@ type ContainerConfig struct {
 	DbName   string
 
 	Env map[string]string
+	Cmd []string
+}
+
+// ContainerConfigOption is used to instantiate a ContainerConfig with the provided settings.
+type ContainerConfigOption func(*ContainerConfig)
+
+// WithCommand overrides the command with which the container starts.
+func WithCommand(cmd ...string) ContainerConfigOption {
+	return func(c *ContainerConfig) {
+		c.Cmd = cmd
+	}
+}
+
+// WithLogicalReplication starts Postgres with wal_level=logical, as required by logical replication slots.
+func WithLogicalReplication() ContainerConfigOption {
+	return WithCommand("postgres", "-c", "wal_level=logical")
 }
 
 // NewPostgresContainerConfig creates a default ContainerConfig for a Postgres database container.
-func NewPostgresContainerConfig() *ContainerConfig {
+func NewPostgresContainerConfig(options ...ContainerConfigOption) *ContainerConfig {
 	config := &ContainerConfig{
 		Driver:   "postgres",
 		Image:    "postgres:13",
@@ -32,5 +48,9 @@ func NewPostgresContainerConfig() *ContainerConfig {
 		"POSTGRES_DB":       config.DbName,
 	}
 
+	for _, option := range options {
+		option(config)
+	}
+
 	return config
 }
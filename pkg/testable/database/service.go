@@ -8,6 +8,7 @@ import (
 	"github.com/shvdg-coder/base-logic/pkg"
 	tstcon "github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
+	"strconv"
 )
 
 // ContainerManagement represents the actions regarding container management.
@@ -64,6 +65,7 @@ func (c *ContainerSvc) newContainerRequest(config *ContainerConfig) tstcon.Conta
 		ExposedPorts: []string{exposedPort},
 		WaitingFor:   wait.ForListeningPort(nat.Port(exposedPort)),
 		Env:          config.Env,
+		Cmd:          config.Cmd,
 	}
 }
 
@@ -85,10 +87,25 @@ func (c *ContainerSvc) createURL(host, port string, config *ContainerConfig) (st
 
 // createPostgresURL constructs Postgres database connection URL.
 func (c *ContainerSvc) createPostgresURL(host, port string, config *ContainerConfig) (string, error) {
-	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		host,
-		port,
-		config.User,
-		config.Password,
-		config.DbName), nil
+	dsn := &pkg.DSN{
+		User:     config.User,
+		Password: config.Password,
+		DbName:   config.DbName,
+		SSLMode:  "disable",
+	}
+	if err := c.rewriteDSN(dsn, host, port); err != nil {
+		return "", err
+	}
+	return dsn.String(), nil
+}
+
+// rewriteDSN points the host and port of the DSN at the mapped port of the container.
+func (c *ContainerSvc) rewriteDSN(dsn *pkg.DSN, host, port string) error {
+	mappedPort, err := strconv.Atoi(port)
+	if err != nil {
+		return fmt.Errorf("invalid mapped port %q: %w", port, err)
+	}
+	dsn.Host = host
+	dsn.Port = mappedPort
+	return nil
 }
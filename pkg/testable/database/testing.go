@@ -0,0 +1,36 @@
+package database
+
+import (
+	"github.com/shvdg-coder/base-logic/pkg"
+	"testing"
+)
+
+// NewTestContainer creates a Postgres container for the test, along with the *pkg.DbSvc connected to it.
+// The test fails when the container cannot be created; tearing it down is left to the test.
+func NewTestContainer(t testing.TB, options ...ContainerConfigOption) (ContainerOps, *pkg.DbSvc) {
+	t.Helper()
+	dbContainer, err := NewContainerSvc().CreateContainer(NewPostgresContainerConfig(options...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbs, ok := dbContainer.DbOps.(*pkg.DbSvc)
+	if !ok {
+		dbContainer.Teardown()
+		t.Fatal("expected the container to be backed by a DbSvc")
+	}
+
+	return dbContainer, dbs
+}
+
+// AssertCount asserts that the query counts the expected number of rows.
+func AssertCount(t testing.TB, database pkg.DbOps, query string, expected int) {
+	t.Helper()
+	var count int
+	if err := database.DB().QueryRow(query).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != expected {
+		t.Fatalf("expected %d, got %d", expected, count)
+	}
+}
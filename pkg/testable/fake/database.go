@@ -0,0 +1,209 @@
+package fake
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/shvdg-coder/base-logic/pkg"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// The names of the recorded methods, used to script errors.
+const (
+	MethodConnect       = "Connect"
+	MethodInsertCSVFile = "InsertCSVFile"
+	MethodBulkInsert    = "BulkInsert"
+)
+
+// CSVInsert represents a recorded call of InsertCSVFile, along with the records of the file.
+type CSVInsert struct {
+	FilePath string
+	Table    string
+	Fields   []string
+	Records  [][]string
+	Options  []pkg.ImportOption
+}
+
+// BulkInsert represents a recorded call of BulkInsert.
+type BulkInsert struct {
+	Table   string
+	Fields  []string
+	Data    [][]interface{}
+	Options []pkg.ImportOption
+}
+
+// Database is a fake implementation of pkg.DbOps, which records its calls instead of changing a database.
+// Its DB is backed by a recording driver, so code using *sql.DB can be tested without a real database.
+type Database struct {
+	mu                  sync.Mutex
+	IsConnected         bool
+	IsMonitoringEnabled bool
+	csvInserts          []*CSVInsert
+	bulkInserts         []*BulkInsert
+	errors              map[string]error
+	recorder            *recorder
+	db                  *sql.DB
+}
+
+// Ensure Database can stand in for the real database service.
+var _ pkg.DbOps = (*Database)(nil)
+
+// NewDatabase creates a new instance of Database.
+func NewDatabase() *Database {
+	recorder := newRecorder()
+	return &Database{
+		errors:   map[string]error{},
+		recorder: recorder,
+		db:       sql.OpenDB(&connector{recorder: recorder}),
+	}
+}
+
+// SetError makes every following call of the method fail with the provided error; nil restores the method.
+func (d *Database) SetError(method string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.errors[method] = err
+}
+
+// SetResult scripts the result of the query when it is executed through DB.
+func (d *Database) SetResult(query string, result *Result) {
+	d.recorder.mu.Lock()
+	defer d.recorder.mu.Unlock()
+	d.recorder.results[query] = result
+}
+
+// Connect marks the database as connected.
+func (d *Database) Connect() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.IsConnected = d.errors[MethodConnect] == nil
+}
+
+// Disconnect marks the database as disconnected.
+func (d *Database) Disconnect() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.IsConnected = false
+	d.IsMonitoringEnabled = false
+}
+
+// StartMonitoring marks the monitoring as enabled, without blocking.
+func (d *Database) StartMonitoring() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.IsMonitoringEnabled = true
+}
+
+// StopMonitoring marks the monitoring as disabled.
+func (d *Database) StopMonitoring() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.IsMonitoringEnabled = false
+}
+
+// InsertCSVFile records the call along with the records of the file, unless an error has been scripted.
+func (d *Database) InsertCSVFile(filePath, table string, fields []string, options ...pkg.ImportOption) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.errors[MethodInsertCSVFile]; err != nil {
+		return err
+	}
+
+	records, err := pkg.GetCSVRecords(filePath, false)
+	if err != nil {
+		return err
+	}
+
+	d.csvInserts = append(d.csvInserts, &CSVInsert{FilePath: filePath, Table: table, Fields: fields, Records: records, Options: options})
+	return nil
+}
+
+// BulkInsert records the call, unless an error has been scripted.
+func (d *Database) BulkInsert(table string, fields []string, data [][]interface{}, options ...pkg.ImportOption) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.errors[MethodBulkInsert]; err != nil {
+		return err
+	}
+
+	d.bulkInserts = append(d.bulkInserts, &BulkInsert{Table: table, Fields: fields, Data: data, Options: options})
+	return nil
+}
+
+// DB returns a *sql.DB backed by the recording driver.
+func (d *Database) DB() *sql.DB {
+	return d.db
+}
+
+// CSVInserts returns the recorded calls of InsertCSVFile.
+func (d *Database) CSVInserts() []*CSVInsert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]*CSVInsert{}, d.csvInserts...)
+}
+
+// BulkInserts returns the recorded calls of BulkInsert.
+func (d *Database) BulkInserts() []*BulkInsert {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]*BulkInsert{}, d.bulkInserts...)
+}
+
+// Statements returns the statements executed through DB, including BEGIN, COMMIT and ROLLBACK.
+func (d *Database) Statements() []Statement {
+	d.recorder.mu.Lock()
+	defer d.recorder.mu.Unlock()
+	return append([]Statement{}, d.recorder.statements...)
+}
+
+// AssertCSVInserted asserts that a file with the expected number of records was inserted into the table.
+func (d *Database) AssertCSVInserted(t testing.TB, table string, expectedRecords int) {
+	t.Helper()
+	for _, insert := range d.CSVInserts() {
+		if insert.Table == table && len(insert.Records) == expectedRecords {
+			return
+		}
+	}
+	t.Errorf("expected a CSV file with %d records to be inserted into %s, got %s", expectedRecords, table, d.describeCSVInserts())
+}
+
+// AssertBulkInserted asserts that the data was bulk inserted into the table.
+func (d *Database) AssertBulkInserted(t testing.TB, table string, expectedData [][]interface{}) {
+	t.Helper()
+	for _, insert := range d.BulkInserts() {
+		if insert.Table == table && reflect.DeepEqual(insert.Data, expectedData) {
+			return
+		}
+	}
+	t.Errorf("expected %v to be bulk inserted into %s", expectedData, table)
+}
+
+// AssertNothingInserted asserts that neither InsertCSVFile nor BulkInsert succeeded.
+func (d *Database) AssertNothingInserted(t testing.TB) {
+	t.Helper()
+	if len(d.CSVInserts()) > 0 || len(d.BulkInserts()) > 0 {
+		t.Errorf("expected nothing to be inserted, got %s and %d bulk inserts", d.describeCSVInserts(), len(d.BulkInserts()))
+	}
+}
+
+// AssertExecuted asserts that the query was executed through DB with the expected arguments.
+func (d *Database) AssertExecuted(t testing.TB, query string, expectedArgs ...interface{}) {
+	t.Helper()
+	for _, statement := range d.Statements() {
+		if statement.Query == query && (len(expectedArgs) == 0 || reflect.DeepEqual(statement.Args, expectedArgs)) {
+			return
+		}
+	}
+	t.Errorf("expected %q to be executed with %v", query, expectedArgs)
+}
+
+// describeCSVInserts describes the recorded calls of InsertCSVFile for failure messages.
+func (d *Database) describeCSVInserts() string {
+	inserts := d.CSVInserts()
+	descriptions := make([]string, len(inserts))
+	for i, insert := range inserts {
+		descriptions[i] = fmt.Sprintf("%d records into %s", len(insert.Records), insert.Table)
+	}
+	return fmt.Sprint(descriptions)
+}
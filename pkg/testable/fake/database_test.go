@@ -0,0 +1,62 @@
+package fake
+
+import (
+	"errors"
+	"github.com/shvdg-coder/base-logic/pkg"
+	"testing"
+)
+
+const contactsCSVPath = "../../tests/csv/resources/contacts.csv"
+
+// importContacts represents code under test, which depends on pkg.DbOps.
+func importContacts(database pkg.DbOps) error {
+	if err := database.InsertCSVFile(contactsCSVPath, "contacts", []string{"id", "name", "phone"}); err != nil {
+		return err
+	}
+	_, err := database.DB().Exec("UPDATE contacts SET imported = $1", true)
+	return err
+}
+
+// TestRecording verifies whether calls and statements are recorded.
+func TestRecording(t *testing.T) {
+	database := NewDatabase()
+
+	if err := importContacts(database); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := pkg.GetCSVRecords(contactsCSVPath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	database.AssertCSVInserted(t, "contacts", len(records))
+	database.AssertExecuted(t, "UPDATE contacts SET imported = $1", true)
+}
+
+// TestScriptedErrors verifies whether scripted errors are returned instead of recording the call.
+func TestScriptedErrors(t *testing.T) {
+	database := NewDatabase()
+	failure := errors.New("disk full")
+	database.SetError(MethodInsertCSVFile, failure)
+
+	if err := importContacts(database); !errors.Is(err, failure) {
+		t.Fatalf("expected %v, got %v", failure, err)
+	}
+
+	database.AssertNothingInserted(t)
+}
+
+// TestScriptedResults verifies whether queries return their scripted rows.
+func TestScriptedResults(t *testing.T) {
+	database := NewDatabase()
+	database.SetResult("SELECT name FROM contacts", &Result{Columns: []string{"name"}, Rows: [][]interface{}{{"John Doe"}}})
+
+	var name string
+	if err := database.DB().QueryRow("SELECT name FROM contacts").Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+	if name != "John Doe" {
+		t.Fatalf("expected John Doe, got %s", name)
+	}
+}
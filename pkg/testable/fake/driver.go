@@ -0,0 +1,201 @@
+package fake
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"sync"
+)
+
+// Statement represents a statement that was executed through the recording driver.
+type Statement struct {
+	Query string
+	Args  []interface{}
+}
+
+// Result represents the scripted outcome of a query: the rows it returns, or the error it fails with.
+type Result struct {
+	Columns      []string
+	Rows         [][]interface{}
+	RowsAffected int64
+	Err          error
+}
+
+// recorder records the statements executed through the driver and holds the scripted results.
+type recorder struct {
+	mu         sync.Mutex
+	statements []Statement
+	results    map[string]*Result
+}
+
+// newRecorder creates a new instance of recorder.
+func newRecorder() *recorder {
+	return &recorder{results: map[string]*Result{}}
+}
+
+// record stores the statement and returns the result scripted for its query, if any.
+func (r *recorder) record(query string, args []driver.NamedValue) *Result {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	r.statements = append(r.statements, Statement{Query: query, Args: values})
+
+	if result, ok := r.results[query]; ok {
+		return result
+	}
+	return &Result{}
+}
+
+// connector opens connections to the recording driver.
+type connector struct {
+	recorder *recorder
+}
+
+// Connect opens a connection which records its statements.
+func (c *connector) Connect(_ context.Context) (driver.Conn, error) {
+	return &conn{recorder: c.recorder}, nil
+}
+
+// Driver returns the recording driver.
+func (c *connector) Driver() driver.Driver {
+	return &recordingDriver{connector: c}
+}
+
+// recordingDriver is a database/sql driver which records statements instead of sending them to a database.
+type recordingDriver struct {
+	connector *connector
+}
+
+// Open opens a connection which records its statements.
+func (d *recordingDriver) Open(_ string) (driver.Conn, error) {
+	return d.connector.Connect(context.Background())
+}
+
+// conn is a connection which records its statements.
+type conn struct {
+	recorder *recorder
+}
+
+// Prepare prepares a statement which is recorded whenever it is executed.
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{conn: c, query: query}, nil
+}
+
+// Close closes the connection.
+func (c *conn) Close() error {
+	return nil
+}
+
+// Begin starts a transaction.
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+// BeginTx starts a transaction, which is recorded as BEGIN.
+func (c *conn) BeginTx(_ context.Context, _ driver.TxOptions) (driver.Tx, error) {
+	if result := c.recorder.record("BEGIN", nil); result.Err != nil {
+		return nil, result.Err
+	}
+	return &tx{conn: c}, nil
+}
+
+// ExecContext records the statement and returns its scripted result.
+func (c *conn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	result := c.recorder.record(query, args)
+	if result.Err != nil {
+		return nil, result.Err
+	}
+	return driver.RowsAffected(result.RowsAffected), nil
+}
+
+// QueryContext records the query and returns its scripted rows.
+func (c *conn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	result := c.recorder.record(query, args)
+	if result.Err != nil {
+		return nil, result.Err
+	}
+	return &rows{columns: result.Columns, values: result.Rows}, nil
+}
+
+// tx is a transaction of which the outcome is recorded as COMMIT or ROLLBACK.
+type tx struct {
+	conn *conn
+}
+
+// Commit records the commit.
+func (t *tx) Commit() error {
+	return t.conn.recorder.record("COMMIT", nil).Err
+}
+
+// Rollback records the rollback.
+func (t *tx) Rollback() error {
+	return t.conn.recorder.record("ROLLBACK", nil).Err
+}
+
+// stmt is a prepared statement which is recorded whenever it is executed.
+type stmt struct {
+	conn  *conn
+	query string
+}
+
+// Close closes the statement.
+func (s *stmt) Close() error {
+	return nil
+}
+
+// NumInput returns -1, as the number of placeholders is not checked.
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+// Exec records the statement and returns its scripted result.
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.ExecContext(context.Background(), s.query, namedValues(args))
+}
+
+// Query records the query and returns its scripted rows.
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.QueryContext(context.Background(), s.query, namedValues(args))
+}
+
+// namedValues converts positional values into named values.
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return named
+}
+
+// rows iterates over scripted rows.
+type rows struct {
+	columns []string
+	values  [][]interface{}
+	index   int
+}
+
+// Columns returns the names of the columns.
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+// Close closes the rows.
+func (r *rows) Close() error {
+	return nil
+}
+
+// Next populates dest with the values of the next row.
+func (r *rows) Next(dest []driver.Value) error {
+	if r.index >= len(r.values) {
+		return io.EOF
+	}
+	for i, value := range r.values[r.index] {
+		dest[i] = value
+	}
+	r.index++
+	return nil
+}
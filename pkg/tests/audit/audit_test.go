@@ -0,0 +1,129 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"github.com/shvdg-coder/base-logic/pkg"
+	"github.com/shvdg-coder/base-logic/pkg/testable/database"
+	"testing"
+	"time"
+)
+
+// TestAuditTrail verifies whether changes to an audited table are recorded along with their actor.
+func TestAuditTrail(t *testing.T) {
+	dbContainer, dbs := setup(t)
+	defer dbContainer.Teardown()
+
+	audit := pkg.NewAuditSvc(dbs)
+	customers := pkg.NewAuditedTable("customers", "id")
+
+	// Setup twice, as it is expected to be idempotent
+	for i := 0; i < 2; i++ {
+		if err := audit.Setup(customers); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Execute
+	ctx := context.Background()
+	from := time.Now().Add(-time.Minute)
+	err := dbs.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		if err := audit.SetActor(ctx, tx, "alice"); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(insertCustomerQuery, 1, "John Doe"); err != nil {
+			return err
+		}
+		_, err := tx.Exec(updateCustomerQuery, 1, "Jane Doe")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test the history of the row
+	history, err := audit.History(ctx, "customers", map[string]interface{}{"id": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].Operation != "INSERT" || history[1].Operation != "UPDATE" {
+		t.Fatalf("unexpected history: %v", history)
+	}
+	if history[1].Actor != "alice" || history[1].Old == nil || history[1].New == nil {
+		t.Fatalf("unexpected update entry: %+v", history[1])
+	}
+
+	// Test the history within a time range
+	entries, err := audit.Range(ctx, "customers", from, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+}
+
+// TestAuditTrailPerSchema verifies whether the changes of equally named tables in different schemas are kept apart.
+func TestAuditTrailPerSchema(t *testing.T) {
+	dbContainer, dbs := setup(t)
+	defer dbContainer.Teardown()
+
+	if _, err := dbs.DB().Exec(createArchivedCustomersTableQuery); err != nil {
+		t.Fatal(err)
+	}
+	audit := pkg.NewAuditSvc(dbs)
+	if err := audit.Setup(pkg.NewAuditedTable("customers", "id"), pkg.NewAuditedTable("archive.customers", "id")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Execute
+	ctx := context.Background()
+	if _, err := dbs.DB().Exec(insertCustomerQuery, 1, "John Doe"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dbs.DB().Exec(insertArchivedCustomerQuery, 1, "Jane Doe"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A writer of which the search_path holds the archive schema only
+	err := dbs.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(pinArchiveSearchPathQuery); err != nil {
+			return err
+		}
+		_, err := tx.Exec(insertCustomerQuery, 2, "Jim Doe")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test
+	key := map[string]interface{}{"id": 1}
+	history, err := audit.History(ctx, "archive.customers", map[string]interface{}{"id": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 {
+		t.Fatalf("expected the change under the pinned search_path to be recorded, got %v", history)
+	}
+	for table, schema := range map[string]string{"customers": "public", "archive.customers": "archive"} {
+		history, err := audit.History(ctx, table, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history) != 1 || history[0].Schema != schema {
+			t.Fatalf("expected a single entry of schema %s for %s, got %v", schema, table, history)
+		}
+	}
+}
+
+// setup prepares the tests by performing the minimally required steps.
+func setup(t *testing.T) (database.ContainerOps, *pkg.DbSvc) {
+	dbContainer, dbs := database.NewTestContainer(t)
+
+	if _, err := dbs.DB().Exec(createCustomersTableQuery); err != nil {
+		t.Fatal(err)
+	}
+
+	return dbContainer, dbs
+}
@@ -0,0 +1,26 @@
+package audit
+
+// createCustomersTableQuery creates the customers table.
+const createCustomersTableQuery = `CREATE TABLE customers (
+		id int NOT NULL PRIMARY KEY,
+		name varchar(255)
+    );`
+
+// insertCustomerQuery inserts a customer.
+const insertCustomerQuery = `INSERT INTO customers (id, name) VALUES ($1, $2);`
+
+// updateCustomerQuery updates the name of a customer.
+const updateCustomerQuery = `UPDATE customers SET name = $2 WHERE id = $1;`
+
+// createArchivedCustomersTableQuery creates the customers table in the archive schema.
+const createArchivedCustomersTableQuery = `CREATE SCHEMA archive;
+	CREATE TABLE archive.customers (
+		id int NOT NULL PRIMARY KEY,
+		name varchar(255)
+    );`
+
+// insertArchivedCustomerQuery inserts a customer in the archive schema.
+const insertArchivedCustomerQuery = `INSERT INTO archive.customers (id, name) VALUES ($1, $2);`
+
+// pinArchiveSearchPathQuery pins the search_path of the transaction to the archive schema.
+const pinArchiveSearchPathQuery = `SELECT set_config('search_path', 'archive', true);`
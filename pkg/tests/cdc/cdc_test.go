@@ -0,0 +1,109 @@
+package cdc
+
+import (
+	"context"
+	"errors"
+	"github.com/shvdg-coder/base-logic/pkg"
+	"github.com/shvdg-coder/base-logic/pkg/testable/database"
+	"testing"
+)
+
+// TestConsumingChanges verifies whether the changes of a transaction are delivered as typed events.
+func TestConsumingChanges(t *testing.T) {
+	dbContainer, dbs := setup(t)
+	defer dbContainer.Teardown()
+
+	var transactions []*pkg.ChangeTransaction
+	stream := pkg.NewChangeStreamSvc(dbs, func(_ context.Context, transaction *pkg.ChangeTransaction) error {
+		transactions = append(transactions, transaction)
+		return nil
+	}, slotName, []string{contactsTableName})
+	if err := stream.CreateChangeStream(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer stream.DropChangeStream(context.Background())
+
+	if _, err := dbs.DB().Exec(changeContactsQuery); err != nil {
+		t.Fatal(err)
+	}
+
+	// Execute
+	delivered, err := stream.Consume(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test
+	if delivered != 1 || len(transactions) != 1 || len(transactions[0].Events) != 4 {
+		t.Fatalf("expected a single transaction with 4 changes, got %d transactions", len(transactions))
+	}
+	events := transactions[0].Events
+	kinds := []string{pkg.ChangeInsert, pkg.ChangeInsert, pkg.ChangeUpdate, pkg.ChangeDelete}
+	for i, event := range events {
+		if event.Kind != kinds[i] || event.Table != contactsTableName {
+			t.Fatalf("expected a %s of %s, got %+v", kinds[i], contactsTableName, event)
+		}
+	}
+	if events[2].After["active"] != false || events[2].After["id"] != int64(1) || events[3].Before["id"] != int64(2) ||
+		len(events[3].Before) != 1 {
+		t.Fatalf("unexpected values, got %+v and %+v", events[2], events[3])
+	}
+
+	// Consumed changes are not delivered again
+	if delivered, err = stream.Consume(context.Background()); err != nil || delivered != 0 {
+		t.Fatalf("expected nothing to be delivered, got %d: %v", delivered, err)
+	}
+}
+
+// TestRedeliveringFailedChanges verifies whether a transaction the handler fails is delivered again, while those handled
+// before it are not.
+func TestRedeliveringFailedChanges(t *testing.T) {
+	dbContainer, dbs := setup(t)
+	defer dbContainer.Teardown()
+
+	failure := errors.New("index unavailable")
+	attempts := 0
+	stream := pkg.NewChangeStreamSvc(dbs, func(_ context.Context, transaction *pkg.ChangeTransaction) error {
+		attempts++
+		if attempts == 2 {
+			return failure
+		}
+		return nil
+	}, slotName, []string{"public." + contactsTableName})
+	if err := stream.CreateChangeStream(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer stream.DropChangeStream(context.Background())
+
+	for _, query := range []string{insertContactQuery, insertOtherContactQuery} {
+		if _, err := dbs.DB().Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Execute
+	delivered, err := stream.Consume(context.Background())
+	if !errors.Is(err, failure) || delivered != 1 {
+		t.Fatalf("expected the handler to fail on the second transaction, got %d deliveries and %v", delivered, err)
+	}
+	delivered, err = stream.Consume(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test
+	if delivered != 1 || attempts != 3 {
+		t.Fatalf("expected only the failed transaction to be delivered again, got %d deliveries in %d attempts", delivered, attempts)
+	}
+}
+
+// setup prepares the tests by starting Postgres with logical replication, and creating the contacts table.
+func setup(t *testing.T) (database.ContainerOps, *pkg.DbSvc) {
+	dbContainer, dbs := database.NewTestContainer(t, database.WithLogicalReplication())
+
+	if _, err := dbs.DB().Exec(createContactsTableQuery); err != nil {
+		t.Fatal(err)
+	}
+
+	return dbContainer, dbs
+}
@@ -0,0 +1,4 @@
+package cdc
+
+const slotName = "contacts_changes"
+const contactsTableName = "contacts"
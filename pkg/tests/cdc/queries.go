@@ -0,0 +1,21 @@
+package cdc
+
+// createContactsTableQuery creates the contacts table.
+const createContactsTableQuery = `CREATE TABLE contacts (
+		id int NOT NULL PRIMARY KEY,
+		name varchar(255),
+		active boolean
+    );`
+
+// changeContactsQuery inserts, updates and deletes contacts within a single transaction.
+const changeContactsQuery = `BEGIN;
+	INSERT INTO contacts (id, name, active) VALUES (1, 'John', true), (2, 'Jane', true);
+	UPDATE contacts SET active = false WHERE id = 1;
+	DELETE FROM contacts WHERE id = 2;
+	COMMIT;`
+
+// insertContactQuery inserts a contact.
+const insertContactQuery = `INSERT INTO contacts (id, name, active) VALUES (3, 'Sam', true);`
+
+// insertOtherContactQuery inserts another contact.
+const insertOtherContactQuery = `INSERT INTO contacts (id, name, active) VALUES (4, 'Kim', true);`
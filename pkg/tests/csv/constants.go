@@ -8,3 +8,28 @@ const contactsColumnName = "name"
 const contactsColumnPhone = "phone"
 
 var columnNames = []string{contactsColumnID, contactsColumnName, contactsColumnPhone}
+
+// Invalid contacts, of which the rows at lines 3 and 6 fail
+const invalidContactsCSVPath = "./resources/invalid_contacts.csv"
+
+// Customers and their orders
+const customersCSVPath = "./resources/customers.csv"
+const newCustomersCSVPath = "./resources/new_customers.csv"
+const ordersCSVPath = "./resources/orders.csv"
+const customersTableName = "customers"
+const ordersTableName = "orders"
+
+var customerColumnNames = []string{"id", "name"}
+var orderColumnNames = []string{"id", "customer_id", "total"}
+
+// Contacts of which the id is generated by a sequence
+const serialContactsTableName = "serial_contacts"
+
+// Contacts with a secondary index and a trigger
+const indexedContactsTableName = "indexed_contacts"
+
+// A snapshot of the contacts, in which one contact changed, two are missing and one is new
+const contactsSnapshotCSVPath = "./resources/contacts_snapshot.csv"
+
+// A snapshot of the contacts, of which one contact lacks its key
+const contactsSnapshotWithoutKeyCSVPath = "./resources/contacts_snapshot_without_key.csv"
@@ -1,14 +1,22 @@
 package csv
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"github.com/shvdg-coder/base-logic/pkg"
 	"github.com/shvdg-coder/base-logic/pkg/testable/database"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 )
 
 // TestInsertingCSV verifies whether a .csv file can be inserted into the database.
 func TestInsertingCSV(t *testing.T) {
-	dbContainer := setup(t)
+	dbContainer, _ := setup(t)
 	defer dbContainer.Teardown()
 
 	// Execute
@@ -43,21 +51,618 @@ func TestInsertingCSV(t *testing.T) {
 
 }
 
-// setup prepares the tests by performing the minimally required steps.
-func setup(t *testing.T) database.ContainerOps {
-	// Instantiate a database container
-	dbContainerService := database.NewContainerSvc()
-	config := database.NewPostgresContainerConfig()
-	dbContainer, err := dbContainerService.CreateContainer(config)
+// TestDryRunCSVImport verifies whether a dry run reports every failing row without changing the table.
+func TestDryRunCSVImport(t *testing.T) {
+	dbContainer, dbSvc := setup(t)
+	defer dbContainer.Teardown()
+
+	// Execute
+	result, err := dbSvc.ImportCSVFile(context.Background(), invalidContactsCSVPath, contactsTableName, columnNames, pkg.WithDryRun())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test
+	if result.RowsRead != 5 || result.RowsLoaded != 3 {
+		t.Fatalf("expected 5 rows read and 3 loaded, got %d and %d", result.RowsRead, result.RowsLoaded)
+	}
+	if len(result.Failures) != 2 {
+		t.Fatalf("expected 2 failures, got %d", len(result.Failures))
+	}
+	if result.Failures[0].Line != 3 || result.Failures[0].Column != contactsColumnID {
+		t.Fatalf("expected the failure at line 3, column id, got line %d, column %s", result.Failures[0].Line, result.Failures[0].Column)
+	}
+	if result.Failures[1].Line != 6 {
+		t.Fatalf("expected the failure at line 6, got line %d", result.Failures[1].Line)
+	}
+
+	var count int
+	if err = dbContainer.DB().QueryRow(countContactsQuery).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Fatalf("expected the dry run to leave the table empty, got %d rows", count)
+	}
+
+	err = dbContainer.InsertCSVFile(invalidContactsCSVPath, contactsTableName, columnNames, pkg.WithDryRun())
+	if err == nil {
+		t.Fatal("expected the dry run to return the failures")
+	}
+}
+
+// TestDryRunRowsImport verifies whether a dry run of in-memory rows captures every row violating the constraints of the table.
+func TestDryRunRowsImport(t *testing.T) {
+	dbContainer, dbSvc := setup(t)
+	defer dbContainer.Teardown()
+
+	_, err := dbContainer.DB().Exec(createCustomersAndOrdersTablesQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbContainer.InsertCSVFile(customersCSVPath, customersTableName, customerColumnNames)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Execute
+	orders := [][]interface{}{
+		{1, 1, "10.00"},
+		{2, 99, "5.00"},
+		{3, "abc", "7.50"},
+		{4, 2, "1.50"},
+		{1, 2, "3.00"},
+	}
+	result, err := dbSvc.ImportRows(context.Background(), ordersTableName, orderColumnNames, orders, pkg.WithDryRun())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test
+	if result.RowsLoaded != 2 || len(result.Failures) != 2 {
+		t.Fatalf("expected 2 rows loaded and 2 failures, got %d and %d", result.RowsLoaded, len(result.Failures))
+	}
+	failures := map[int]*pkg.RowFailure{}
+	for _, failure := range result.Failures {
+		failures[failure.Line] = failure
+	}
+	if failures[2] == nil || !strings.Contains(failures[2].Reason, "foreign key") {
+		t.Fatalf("expected the foreign key violation at line 2, got %+v", result.Failures)
+	}
+	if failures[3] == nil || failures[3].Column != "customer_id" {
+		t.Fatalf("expected the failure at line 3, column customer_id, got %+v", result.Failures)
+	}
+	database.AssertCount(t, dbContainer, countOrdersQuery, 0)
+}
+
+// TestCSVImportWithErrorBudget verifies whether good rows are committed and failing rows rejected within the error budget.
+func TestCSVImportWithErrorBudget(t *testing.T) {
+	dbContainer, dbSvc := setup(t)
+	defer dbContainer.Teardown()
+
+	// Execute
+	rejectFilePath := filepath.Join(t.TempDir(), "rejects.csv")
+	result, err := dbSvc.ImportCSVFile(context.Background(), invalidContactsCSVPath, contactsTableName, columnNames,
+		pkg.WithMaxErrors(2), pkg.WithRejectFile(rejectFilePath))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test
+	if result.RowsLoaded != 3 || result.RowsRejected != 2 {
+		t.Fatalf("expected 3 rows loaded and 2 rejected, got %d and %d", result.RowsLoaded, result.RowsRejected)
+	}
+
+	var count int
+	if err = dbContainer.DB().QueryRow(countContactsQuery).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Fatalf("expected 3 rows to be committed, got %d", count)
+	}
+
+	rejects, err := pkg.GetCSVRecords(rejectFilePath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rejects) != 2 || rejects[0][3] != "3" || rejects[1][3] != "6" {
+		t.Fatalf("expected the rows at lines 3 and 6 to be rejected, got %v", rejects)
+	}
+
+	// Exceeding the error budget rolls back the import
+	_, err = dbSvc.ImportCSVFile(context.Background(), invalidContactsCSVPath, contactsTableName, columnNames, pkg.WithMaxErrors(1))
+	if !errors.Is(err, pkg.ErrErrorBudgetExceeded) {
+		t.Fatalf("expected the error budget to be exceeded, got %v", err)
+	}
+}
+
+// TestImportPlan verifies whether the steps of an import plan are committed together, or not at all.
+func TestImportPlan(t *testing.T) {
+	dbContainer, dbSvc := setup(t)
+	defer dbContainer.Teardown()
+
+	_, err := dbContainer.DB().Exec(createCustomersAndOrdersTablesQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A dry run checks the deferred constraints, which the orders violate without their customers
+	plan := pkg.NewImportPlan(pkg.WithDeferredConstraints(), pkg.WithDryRun()).
+		AddStep(ordersCSVPath, ordersTableName, orderColumnNames)
+	if _, err = dbSvc.RunImportPlan(context.Background(), plan); !errors.Is(err, pkg.ErrForeignKeyViolation) {
+		t.Fatalf("expected the orders to violate the deferred foreign key, got %v", err)
+	}
+
+	// Execute, importing the orders before their customers
+	plan = pkg.NewImportPlan(pkg.WithDeferredConstraints()).
+		AddStep(ordersCSVPath, ordersTableName, orderColumnNames).
+		AddStep(customersCSVPath, customersTableName, customerColumnNames)
+	result, err := dbSvc.RunImportPlan(context.Background(), plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test
+	if len(result.Steps) != 2 || result.Steps[0].RowsLoaded != 3 || result.Steps[1].RowsLoaded != 2 {
+		t.Fatalf("expected 3 orders and 2 customers to be loaded, got %+v", result.Steps)
+	}
+
+	// A failing step rolls back the steps before it
+	plan = pkg.NewImportPlan().
+		AddStep(newCustomersCSVPath, customersTableName, customerColumnNames).
+		AddStep(ordersCSVPath, ordersTableName, orderColumnNames)
+	_, err = dbSvc.RunImportPlan(context.Background(), plan)
+	if !errors.Is(err, pkg.ErrUniqueViolation) {
+		t.Fatalf("expected the orders to conflict, got %v", err)
+	}
+
+	var count int
+	if err = dbContainer.DB().QueryRow(countCustomersQuery).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Fatalf("expected the new customer to be rolled back, got %d customers", count)
+	}
+}
+
+// TestSequenceResync verifies whether the sequence of a serial column is advanced past the imported ids.
+func TestSequenceResync(t *testing.T) {
+	dbContainer, dbSvc := setup(t)
+	defer dbContainer.Teardown()
+
+	_, err := dbContainer.DB().Exec(createSerialContactsTableQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Execute
+	err = dbContainer.InsertCSVFile(contactsCSVPath, serialContactsTableName, columnNames, pkg.WithSequenceResync())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test
+	var id int
+	if err = dbContainer.DB().QueryRow(insertSerialContactQuery).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	if id != 5 {
+		t.Fatalf("expected the next id to be 5, got %d", id)
+	}
+
+	// The sequence is already ahead, so resynchronising all sequences leaves it as is
+	resyncs, err := dbSvc.ResyncSequences(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resyncs) != 0 {
+		t.Fatalf("expected no sequences to be advanced, got %d", len(resyncs))
+	}
+
+	// The table can be qualified by its schema
+	if _, err = dbSvc.ResyncSequences(context.Background(), "public."+serialContactsTableName); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestImportWithIndexesAndTriggersDropped verifies whether indexes and triggers are dropped during a load and restored afterwards.
+func TestImportWithIndexesAndTriggersDropped(t *testing.T) {
+	dbContainer, _ := setup(t)
+	defer dbContainer.Teardown()
+
+	_, err := dbContainer.DB().Exec(createIndexedContactsTableQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A failing load restores the indexes and triggers
+	err = dbContainer.InsertCSVFile(invalidContactsCSVPath, indexedContactsTableName, columnNames,
+		pkg.WithIndexesDropped(), pkg.WithTriggersDropped())
+	if err == nil {
+		t.Fatal("expected the invalid contacts to fail")
+	}
+	database.AssertCount(t, dbContainer, countIndexedContactsIndexesQuery, 2)
+	database.AssertCount(t, dbContainer, countIndexedContactsTriggersQuery, 1)
+
+	// Execute
+	err = dbContainer.InsertCSVFile(contactsCSVPath, indexedContactsTableName, columnNames,
+		pkg.WithIndexesDropped(), pkg.WithTriggersDropped())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test
+	database.AssertCount(t, dbContainer, countMaskedContactsQuery, 0)
+	database.AssertCount(t, dbContainer, countIndexedContactsIndexesQuery, 2)
+	database.AssertCount(t, dbContainer, countIndexedContactsTriggersQuery, 1)
+	database.AssertCount(t, dbContainer, countDroppedIndexesQuery, 0)
+}
+
+// TestRestoreDroppedIndexes verifies whether indexes which failed to be recreated after a load can be restored.
+func TestRestoreDroppedIndexes(t *testing.T) {
+	dbContainer, dbSvc := setup(t)
+	defer dbContainer.Teardown()
+
+	_, err := dbContainer.DB().Exec(createIndexedContactsTableQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dbContainer.InsertCSVFile(contactsCSVPath, indexedContactsTableName, columnNames, pkg.WithIndexesDropped())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = dbContainer.DB().Exec(dropIndexedContactsNameIndexQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database.AssertCount(t, dbContainer, countIndexedContactsIndexesQuery, 1)
+
+	// Execute
+	restored, err := dbSvc.RestoreDroppedIndexes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test
+	if len(restored) != 1 || restored[0] != `"public"."indexed_contacts_name_idx"` {
+		t.Errorf("expected the name index to be restored, got %v", restored)
+	}
+	database.AssertCount(t, dbContainer, countIndexedContactsIndexesQuery, 2)
+	database.AssertCount(t, dbContainer, countDroppedIndexesQuery, 0)
+}
+
+// TestParallelCSVImport verifies whether a .csv file split over several workers is imported completely.
+func TestParallelCSVImport(t *testing.T) {
+	dbContainer, dbSvc := setup(t)
+	defer dbContainer.Teardown()
+
+	// Generate a file of which every tenth name spans two lines
+	filePath := filepath.Join(t.TempDir(), "contacts.csv")
+	var builder strings.Builder
+	builder.WriteString("id,name,phone\n")
+	for i := 1; i <= 1000; i++ {
+		name := fmt.Sprintf("Contact %d", i)
+		if i%10 == 0 {
+			name = fmt.Sprintf("\"Contact\n%d\"", i)
+		}
+		builder.WriteString(fmt.Sprintf("%d,%s,+1-202-555-%04d\n", i, name, i))
+	}
+	if err := os.WriteFile(filePath, []byte(builder.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Execute
+	var reports int
+	result, err := dbSvc.ImportCSVFile(context.Background(), filePath, contactsTableName, columnNames, pkg.WithWorkers(4),
+		pkg.WithBatchSize(100), pkg.WithProgress(func(progress pkg.ImportProgress) { reports++ }, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test
+	if result.RowsRead != 1000 || result.RowsLoaded != 1000 {
+		t.Fatalf("expected 1000 rows read and loaded, got %d and %d", result.RowsRead, result.RowsLoaded)
+	}
+	if reports == 0 {
+		t.Fatal("expected the progress to be reported")
+	}
+	database.AssertCount(t, dbContainer, countContactsQuery, 1000)
+}
+
+// TestResumableCSVImport verifies whether an import resumes after its last checkpoint, unless the file changed.
+func TestResumableCSVImport(t *testing.T) {
+	dbContainer, dbSvc := setup(t)
+	defer dbContainer.Teardown()
+
+	filePath := filepath.Join(t.TempDir(), "contacts.csv")
+	content := "Id,Name,Phone\n1,John,1\n2,Jane,2\n3,Sam,3\n4,Rob,4\nx,Ann,5\n6,Tom,6\n"
+	if err := os.WriteFile(filePath, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The third batch fails, after the first two have been committed
+	_, err := dbSvc.ImportCSVFile(context.Background(), filePath, contactsTableName, columnNames,
+		pkg.WithResume("contacts"), pkg.WithBatchSize(2))
+	if err == nil {
+		t.Fatal("expected the invalid row to fail")
+	}
+	database.AssertCount(t, dbContainer, countContactsQuery, 4)
+
+	checkpoints, err := dbSvc.ListImportCheckpoints(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checkpoints) != 1 || checkpoints[0].RowsCommitted != 4 || checkpoints[0].NextLine != 6 {
+		t.Fatalf("expected a checkpoint after 4 rows, got %+v", checkpoints)
+	}
+
+	// Execute, resuming with an error budget
+	rejectFilePath := filepath.Join(t.TempDir(), "rejects.csv")
+	result, err := dbSvc.ImportCSVFile(context.Background(), filePath, contactsTableName, columnNames,
+		pkg.WithResume("contacts"), pkg.WithBatchSize(2), pkg.WithMaxErrors(1), pkg.WithRejectFile(rejectFilePath))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test
+	if result.RowsLoaded != 1 || !result.Checkpoint.IsCompleted || result.Failures[0].Line != 6 {
+		t.Fatalf("expected the remaining row to be loaded and line 6 to be rejected, got %+v", result)
+	}
+	database.AssertCount(t, dbContainer, countContactsQuery, 5)
+
+	rejects, err := pkg.GetCSVRecords(rejectFilePath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rejects) != 2 || strings.Join(rejects[0], ",") != "Id,Name,Phone,line,error" {
+		t.Fatalf("expected the rejected row under the header of the file, got %v", rejects)
+	}
+
+	// A changed file is rejected
+	if err = os.WriteFile(filePath, []byte(content+"7,Eve,7\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err = dbSvc.ImportCSVFile(context.Background(), filePath, contactsTableName, columnNames, pkg.WithResume("contacts"))
+	if !errors.Is(err, pkg.ErrCheckpointMismatch) {
+		t.Fatalf("expected a checkpoint mismatch, got %v", err)
+	}
+
+	if err = dbSvc.ClearImportCheckpoint(context.Background(), "contacts"); err != nil {
+		t.Fatal(err)
+	}
+	checkpoints, err = dbSvc.ListImportCheckpoints(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checkpoints) != 0 {
+		t.Fatalf("expected the checkpoint to be cleared, got %d", len(checkpoints))
+	}
+}
+
+// TestInterruptedResumableCSVImport verifies whether an import canceled midway loads every row exactly once when resumed.
+func TestInterruptedResumableCSVImport(t *testing.T) {
+	dbContainer, dbSvc := setup(t)
+	defer dbContainer.Teardown()
+
+	filePath := filepath.Join(t.TempDir(), "contacts.csv")
+	if err := os.WriteFile(filePath, []byte(generateContactsCSV(10)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cancel the run once it committed a few batches
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err := dbSvc.ImportCSVFile(ctx, filePath, contactsTableName, columnNames, pkg.WithResume("contacts"), pkg.WithBatchSize(2),
+		pkg.WithProgress(func(progress pkg.ImportProgress) {
+			if progress.RowsProcessed >= 4 {
+				cancel()
+			}
+		}, 0))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the import to be canceled, got %v", err)
+	}
+	checkpoints, err := dbSvc.ListImportCheckpoints(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checkpoints) != 1 || checkpoints[0].IsCompleted || checkpoints[0].RowsCommitted < 4 {
+		t.Fatalf("expected an incomplete checkpoint after at least 4 rows, got %+v", checkpoints)
+	}
+
+	// Execute
+	result, err := dbSvc.ImportCSVFile(context.Background(), filePath, contactsTableName, columnNames,
+		pkg.WithResume("contacts"), pkg.WithBatchSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test
+	if !result.Checkpoint.IsCompleted || result.Checkpoint.RowsCommitted != 10 {
+		t.Fatalf("expected the import to complete with 10 rows committed, got %+v", result.Checkpoint)
+	}
+	database.AssertCount(t, dbContainer, countContactsQuery, 10)
+}
+
+// TestConcurrentResumableCSVImports verifies whether concurrent runs of the same import do not load a batch twice.
+func TestConcurrentResumableCSVImports(t *testing.T) {
+	dbContainer, dbSvc := setup(t)
+	defer dbContainer.Teardown()
+
+	filePath := filepath.Join(t.TempDir(), "contacts.csv")
+	if err := os.WriteFile(filePath, []byte(generateContactsCSV(100)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Execute
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = dbSvc.ImportCSVFile(context.Background(), filePath, contactsTableName, columnNames,
+				pkg.WithResume("contacts"), pkg.WithBatchSize(5))
+		}(i)
+	}
+	wg.Wait()
+
+	// Test, runs overtaken by another stop without loading
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, pkg.ErrCheckpointMismatch) {
+			t.Fatal(err)
+		}
+	}
+	database.AssertCount(t, dbContainer, countContactsQuery, 100)
+}
+
+// generateContactsCSV generates a .csv file with a header and the number of contacts.
+func generateContactsCSV(contacts int) string {
+	var builder strings.Builder
+	builder.WriteString("Id,Name,Phone\n")
+	for i := 1; i <= contacts; i++ {
+		builder.WriteString(fmt.Sprintf("%d,Contact %d,%d\n", i, i, i))
+	}
+	return builder.String()
+}
+
+// TestSyncCSVFile verifies whether a table is made to match a snapshot, and whether a dry run only previews the changes.
+func TestSyncCSVFile(t *testing.T) {
+	dbContainer, dbSvc := setup(t)
+	defer dbContainer.Teardown()
+
+	err := dbContainer.InsertCSVFile(contactsCSVPath, contactsTableName, columnNames)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Preview
+	key := []string{contactsColumnID}
+	preview, err := dbSvc.SyncCSVFile(context.Background(), contactsSnapshotCSVPath, contactsTableName, columnNames, key,
+		pkg.WithDryRun(), pkg.WithChangeLog())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Inserted != 1 || preview.Updated != 1 || preview.Deleted != 2 || len(preview.Changes) != 4 {
+		t.Fatalf("expected 1 insert, 1 update and 2 deletes, got %+v", preview)
+	}
+	database.AssertCount(t, dbContainer, countContactsQuery, 5)
+
+	// Execute
+	result, err := dbSvc.SyncCSVFile(context.Background(), contactsSnapshotCSVPath, contactsTableName, columnNames, key)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// Create table
-	_, err = dbContainer.DB().Query(createContactsTableQuery)
+	// Test
+	if result.Inserted != 1 || result.Updated != 1 || result.Deleted != 2 {
+		t.Fatalf("expected 1 insert, 1 update and 2 deletes, got %+v", result)
+	}
+
+	snapshotRows, err := pkg.GetCSVRecords(contactsSnapshotCSVPath, false)
 	if err != nil {
 		t.Fatal(err)
 	}
+	tableRows, err := dbContainer.DB().Query(getOrderedContactsQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tableRows.Close()
+	if err = pkg.CompareRows(snapshotRows, tableRows); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestSyncIncompleteCSVFile verifies whether a snapshot of which rows were rejected is not applied.
+func TestSyncIncompleteCSVFile(t *testing.T) {
+	dbContainer, dbSvc := setup(t)
+	defer dbContainer.Teardown()
+
+	err := dbContainer.InsertCSVFile(contactsCSVPath, contactsTableName, columnNames)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Execute
+	result, err := dbSvc.SyncCSVFile(context.Background(), invalidContactsCSVPath, contactsTableName, columnNames,
+		[]string{contactsColumnID}, pkg.WithMaxErrors(5))
+
+	// Test
+	if !errors.Is(err, pkg.ErrIncompleteSnapshot) {
+		t.Fatalf("expected the snapshot to be refused, got %v", err)
+	}
+	if result.Import.RowsRejected != 1 || result.Deleted != 0 {
+		t.Fatalf("expected 1 rejected row and no deletes, got %+v", result)
+	}
+	database.AssertCount(t, dbContainer, countContactsQuery, 5)
+}
+
+// TestSyncCSVFileWithoutKey verifies whether a snapshot of which a row lacks its key is not applied.
+func TestSyncCSVFileWithoutKey(t *testing.T) {
+	dbContainer, dbSvc := setup(t)
+	defer dbContainer.Teardown()
+
+	err := dbContainer.InsertCSVFile(contactsCSVPath, contactsTableName, columnNames)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Execute
+	_, err = dbSvc.SyncCSVFile(context.Background(), contactsSnapshotWithoutKeyCSVPath, contactsTableName, columnNames,
+		[]string{contactsColumnID}, pkg.WithNullMarkers(""))
+
+	// Test
+	if err == nil || !strings.Contains(err.Error(), "NULL key") {
+		t.Fatalf("expected the snapshot to be refused for its NULL key, got %v", err)
+	}
+	database.AssertCount(t, dbContainer, countContactsQuery, 5)
+}
+
+// TestBulkUpdateAndDelete verifies whether rows are updated and deleted by key, within a single transaction.
+func TestBulkUpdateAndDelete(t *testing.T) {
+	dbContainer, dbSvc := setup(t)
+	defer dbContainer.Teardown()
+
+	err := dbContainer.InsertCSVFile(contactsCSVPath, contactsTableName, columnNames)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Execute
+	var updated, deleted int
+	key := []string{contactsColumnID}
+	err = dbSvc.RunInTransaction(context.Background(), func(tx *sql.Tx) error {
+		data := [][]interface{}{{1, "masked"}, {2, "masked"}, {9, "masked"}}
+		if updated, err = pkg.BulkUpdateTx(context.Background(), tx, contactsTableName, key, []string{contactsColumnPhone}, data); err != nil {
+			return err
+		}
+		deleted, err = pkg.BulkDeleteTx(context.Background(), tx, contactsTableName, key, [][]interface{}{{3}, {4}, {9}})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test
+	if updated != 2 || deleted != 2 {
+		t.Fatalf("expected 2 rows updated and 2 deleted, got %d and %d", updated, deleted)
+	}
+	database.AssertCount(t, dbContainer, countContactsQuery, 3)
+	database.AssertCount(t, dbContainer, countMaskedContactsPhonesQuery, 2)
+
+	// Keys provided more than once are refused
+	_, err = dbSvc.BulkDelete(context.Background(), contactsTableName, key, [][]interface{}{{5}, {5}})
+	if err == nil {
+		t.Fatal("expected duplicate keys to fail")
+	}
+	database.AssertCount(t, dbContainer, countContactsQuery, 3)
+}
+
+// setup prepares the tests by performing the minimally required steps.
+func setup(t *testing.T) (database.ContainerOps, *pkg.DbSvc) {
+	dbContainer, dbs := database.NewTestContainer(t)
+
+	if _, err := dbs.DB().Exec(createContactsTableQuery); err != nil {
+		t.Fatal(err)
+	}
 
-	return dbContainer
+	return dbContainer, dbs
 }
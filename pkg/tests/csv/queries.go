@@ -9,3 +9,71 @@ const createContactsTableQuery = `CREATE TABLE contacts (
 
 // getContactsQuery retrieves the contacts.
 const getContactsQuery = `SELECT id, name, phone FROM contacts;`
+
+// getOrderedContactsQuery retrieves the contacts ordered by their id.
+const getOrderedContactsQuery = `SELECT id, name, phone FROM contacts ORDER BY id;`
+
+// countContactsQuery counts the contacts.
+const countContactsQuery = `SELECT COUNT(*) FROM contacts;`
+
+// createCustomersAndOrdersTablesQuery creates the customers table and the orders table, which references it through a deferrable constraint.
+const createCustomersAndOrdersTablesQuery = `CREATE TABLE customers (
+		id int NOT NULL PRIMARY KEY,
+		name varchar(255)
+    );
+	CREATE TABLE orders (
+		id int NOT NULL PRIMARY KEY,
+		customer_id int NOT NULL REFERENCES customers (id) DEFERRABLE INITIALLY IMMEDIATE,
+		total numeric(10, 2)
+    );`
+
+// countCustomersQuery counts the customers.
+const countCustomersQuery = `SELECT COUNT(*) FROM customers;`
+
+// countOrdersQuery counts the orders.
+const countOrdersQuery = `SELECT COUNT(*) FROM orders;`
+
+// createSerialContactsTableQuery creates the serial_contacts table, of which the id is generated by a sequence.
+const createSerialContactsTableQuery = `CREATE TABLE serial_contacts (
+		id serial PRIMARY KEY,
+		name varchar(255),
+		phone varchar(255)
+    );`
+
+// insertSerialContactQuery inserts a contact relying on the sequence for its id.
+const insertSerialContactQuery = `INSERT INTO serial_contacts (name, phone) VALUES ('Ann Lee', '+1-202-555-0129') RETURNING id;`
+
+// createIndexedContactsTableQuery creates the indexed_contacts table, with a secondary index and a trigger masking phone numbers.
+const createIndexedContactsTableQuery = `CREATE TABLE indexed_contacts (
+		id int NOT NULL PRIMARY KEY,
+		name varchar(255),
+		phone varchar(255)
+    );
+	CREATE INDEX indexed_contacts_name_idx ON indexed_contacts (name);
+	CREATE FUNCTION mask_phone() RETURNS trigger AS $$
+	BEGIN
+		NEW.phone := 'masked';
+		RETURN NEW;
+	END;
+	$$ LANGUAGE plpgsql;
+	CREATE TRIGGER indexed_contacts_mask BEFORE INSERT ON indexed_contacts FOR EACH ROW EXECUTE FUNCTION mask_phone();`
+
+// countIndexedContactsIndexesQuery counts the valid indexes of the indexed_contacts table.
+const countIndexedContactsIndexesQuery = `SELECT COUNT(*) FROM pg_index WHERE indrelid = 'indexed_contacts'::regclass AND indisvalid;`
+
+// countIndexedContactsTriggersQuery counts the triggers of the indexed_contacts table.
+const countIndexedContactsTriggersQuery = `SELECT COUNT(*) FROM pg_trigger WHERE tgrelid = 'indexed_contacts'::regclass AND NOT tgisinternal;`
+
+// countMaskedContactsQuery counts the contacts of which the phone number was masked.
+const countMaskedContactsQuery = `SELECT COUNT(*) FROM indexed_contacts WHERE phone = 'masked';`
+
+// countMaskedContactsPhonesQuery counts the contacts of which the phone number was masked.
+const countMaskedContactsPhonesQuery = `SELECT COUNT(*) FROM contacts WHERE phone = 'masked';`
+
+// countDroppedIndexesQuery counts the indexes awaiting to be recreated.
+const countDroppedIndexesQuery = `SELECT COUNT(*) FROM dropped_indexes;`
+
+// dropIndexedContactsNameIndexQuery drops the name index of the indexed_contacts table, recording it as a failed rebuild would.
+const dropIndexedContactsNameIndexQuery = `INSERT INTO dropped_indexes (index_name, table_name, definition)
+	SELECT '"public"."indexed_contacts_name_idx"', '"indexed_contacts"', pg_get_indexdef('indexed_contacts_name_idx'::regclass);
+	DROP INDEX indexed_contacts_name_idx;`
@@ -0,0 +1,5 @@
+package outbox
+
+const outboxTableName = "outbox"
+const orderAggregateKey = "order-1"
+const customerAggregateKey = "customer-1"
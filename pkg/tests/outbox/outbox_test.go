@@ -0,0 +1,139 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/shvdg-coder/base-logic/pkg"
+	"github.com/shvdg-coder/base-logic/pkg/testable/database"
+	"testing"
+)
+
+// TestRelayingEvents verifies whether enqueued events are published in order per aggregate key.
+func TestRelayingEvents(t *testing.T) {
+	dbContainer, dbs := database.NewTestContainer(t)
+	defer dbContainer.Teardown()
+
+	publisher := pkg.NewInMemoryPublisher()
+	outbox := pkg.NewOutboxSvc(dbs, publisher, pkg.WithOutboxTable(outboxTableName))
+	if err := outbox.CreateOutboxTable(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Enqueue events within a transaction
+	ctx := context.Background()
+	err := dbs.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		return outbox.Enqueue(tx,
+			&pkg.OutboxEvent{AggregateKey: orderAggregateKey, Type: "created"},
+			&pkg.OutboxEvent{AggregateKey: customerAggregateKey, Type: "created"},
+			&pkg.OutboxEvent{AggregateKey: orderAggregateKey, Type: "paid"},
+		)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Relay until there is nothing left
+	for {
+		delivered, err := outbox.Relay(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if delivered == 0 {
+			break
+		}
+	}
+
+	// Test
+	var orderTypes []string
+	for _, event := range publisher.Events() {
+		if event.AggregateKey == orderAggregateKey {
+			orderTypes = append(orderTypes, event.Type)
+		}
+	}
+	if len(publisher.Events()) != 3 || len(orderTypes) != 2 || orderTypes[0] != "created" || orderTypes[1] != "paid" {
+		t.Fatalf("unexpected published events: %v", orderTypes)
+	}
+}
+
+// TestRelayingRolledBackEvents verifies whether events of a rolled back transaction are never published.
+func TestRelayingRolledBackEvents(t *testing.T) {
+	dbContainer, dbs := database.NewTestContainer(t)
+	defer dbContainer.Teardown()
+
+	publisher := pkg.NewInMemoryPublisher()
+	outbox := pkg.NewOutboxSvc(dbs, publisher, pkg.WithOutboxTable(outboxTableName))
+	if err := outbox.CreateOutboxTable(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Enqueue events within a transaction that fails
+	ctx := context.Background()
+	failure := errors.New("business change failed")
+	err := dbs.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		if err := outbox.Enqueue(tx, &pkg.OutboxEvent{AggregateKey: orderAggregateKey, Type: "created"}); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("expected %v, got %v", failure, err)
+	}
+
+	// Test
+	delivered, err := outbox.Relay(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivered != 0 {
+		t.Fatalf("expected no delivered events, got %d", delivered)
+	}
+}
+
+// TestDeadLetteringEvents verifies whether an event failing too often is dead-lettered, unblocking its aggregate key.
+func TestDeadLetteringEvents(t *testing.T) {
+	dbContainer, dbs := database.NewTestContainer(t)
+	defer dbContainer.Teardown()
+
+	publisher := pkg.NewInMemoryPublisher()
+	outbox := pkg.NewOutboxSvc(dbs, publisher, pkg.WithOutboxTable(outboxTableName), pkg.WithOutboxMaxAttempts(2))
+	if err := outbox.CreateOutboxTable(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	err := dbs.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		return outbox.Enqueue(tx, &pkg.OutboxEvent{AggregateKey: orderAggregateKey, Type: "created"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first event fails until it is dead-lettered
+	publisher.SetFailure(errors.New("rejected"))
+	for i := 0; i < 2; i++ {
+		if _, err = outbox.Relay(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	database.AssertCount(t, dbContainer, countDeadEventsQuery, 1)
+
+	// Execute
+	publisher.SetFailure(nil)
+	err = dbs.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		return outbox.Enqueue(tx, &pkg.OutboxEvent{AggregateKey: orderAggregateKey, Type: "paid"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	delivered, err := outbox.Relay(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test
+	events := publisher.Events()
+	if delivered != 1 || len(events) != 1 || events[0].Type != "paid" {
+		t.Fatalf("expected only the event following the dead-lettered one to be published, got %v", events)
+	}
+}
@@ -0,0 +1,4 @@
+package outbox
+
+// countDeadEventsQuery counts the dead-lettered events of the outbox.
+const countDeadEventsQuery = `SELECT COUNT(*) FROM outbox WHERE dead_at IS NOT NULL;`
@@ -0,0 +1,4 @@
+package pagination
+
+const pageLimit = 3
+const cursorSecret = "secret"
@@ -0,0 +1,101 @@
+package pagination
+
+import (
+	"context"
+	"github.com/shvdg-coder/base-logic/pkg"
+	"github.com/shvdg-coder/base-logic/pkg/testable/database"
+	"reflect"
+	"testing"
+)
+
+// product represents a row of the products table.
+type product struct {
+	ID    int    `db:"id"`
+	Name  string `db:"name"`
+	Price int    `db:"price"`
+}
+
+// bySortedPrice orders the products from expensive to cheap, with ties broken by their ID.
+var bySortedPrice = []pkg.SortColumn{{Column: "price", Descending: true}, {Column: "id"}}
+
+// TestPaginatingKeyset verifies whether pages are traversed forward and backward across products sharing a price.
+func TestPaginatingKeyset(t *testing.T) {
+	dbContainer, paginator := setup(t)
+	defer dbContainer.Teardown()
+	ctx := context.Background()
+
+	request := func(cursor string) *pkg.PageRequest {
+		return &pkg.PageRequest{Query: selectProductsQuery, Args: []interface{}{30},
+			Sort: bySortedPrice, Limit: pageLimit, Cursor: cursor}
+	}
+
+	// Forward
+	first := paginate(t, ctx, paginator, request(""), []int{6, 7, 3}, false, true)
+	second := paginate(t, ctx, paginator, request(first.NextCursor), []int{4, 5, 1}, true, true)
+	last := paginate(t, ctx, paginator, request(second.NextCursor), []int{2}, true, false)
+
+	// Backward
+	previous := paginate(t, ctx, paginator, request(last.PrevCursor), []int{4, 5, 1}, true, true)
+	paginate(t, ctx, paginator, request(previous.PrevCursor), []int{6, 7, 3}, false, true)
+}
+
+// TestPaginatingOffset verifies whether a page is retrieved by its number along with the total count.
+func TestPaginatingOffset(t *testing.T) {
+	dbContainer, paginator := setup(t)
+	defer dbContainer.Teardown()
+
+	page, err := pkg.PaginateOffset[product](context.Background(), paginator, &pkg.OffsetPageRequest{
+		Query: selectProductsQuery, Args: []interface{}{20}, Sort: bySortedPrice, Size: pageLimit, Number: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if page.TotalCount != 5 {
+		t.Errorf("expected a total count of 5, got %d", page.TotalCount)
+	}
+	if ids := productIDs(page.Items); !reflect.DeepEqual(ids, []int{1, 2}) {
+		t.Errorf("expected products %v, got %v", []int{1, 2}, ids)
+	}
+	if !page.HasPrev || page.HasNext {
+		t.Errorf("expected only a previous page, got HasPrev %t and HasNext %t", page.HasPrev, page.HasNext)
+	}
+}
+
+// paginate retrieves the page of the request and verifies its products and neighbours.
+func paginate(t *testing.T, ctx context.Context, paginator *pkg.Paginator, request *pkg.PageRequest,
+	expected []int, hasPrev, hasNext bool) *pkg.Page[product] {
+	t.Helper()
+
+	page, err := pkg.PaginateKeyset[product](ctx, paginator, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := productIDs(page.Items); !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected products %v, got %v", expected, ids)
+	}
+	if page.HasPrev != hasPrev || page.HasNext != hasNext {
+		t.Errorf("expected HasPrev %t and HasNext %t, got %t and %t", hasPrev, hasNext, page.HasPrev, page.HasNext)
+	}
+	return page
+}
+
+// productIDs returns the IDs of the products.
+func productIDs(products []*product) []int {
+	ids := make([]int, len(products))
+	for i, p := range products {
+		ids[i] = p.ID
+	}
+	return ids
+}
+
+// setup starts a database container with the products table and returns a paginator on it.
+func setup(t *testing.T) (database.ContainerOps, *pkg.Paginator) {
+	dbContainer, dbs := database.NewTestContainer(t)
+
+	if _, err := dbs.DB().Exec(createProductsTableQuery); err != nil {
+		t.Fatal(err)
+	}
+
+	return dbContainer, pkg.NewPaginator(dbs, []byte(cursorSecret))
+}
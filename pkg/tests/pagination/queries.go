@@ -0,0 +1,15 @@
+package pagination
+
+// createProductsTableQuery creates the products table, of which several products share a price.
+const createProductsTableQuery = `CREATE TABLE products (
+		id int NOT NULL PRIMARY KEY,
+		name varchar(255),
+		price int NOT NULL
+    );
+	INSERT INTO products (id, name, price) VALUES
+		(1, 'Pen', 10), (2, 'Pencil', 10),
+		(3, 'Ruler', 20), (4, 'Eraser', 20), (5, 'Stapler', 20),
+		(6, 'Notebook', 30), (7, 'Binder', 30);`
+
+// selectProductsQuery selects the products up to a maximum price.
+const selectProductsQuery = `SELECT id, name, price FROM products WHERE price <= $1`
@@ -0,0 +1,6 @@
+package partition
+
+const logsTableName = "logs"
+const oldLogsPartitionName = "logs_old"
+const eventsTableName = "events"
+const accountsTableName = "accounts"
@@ -0,0 +1,170 @@
+package partition
+
+import (
+	"context"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/shvdg-coder/base-logic/pkg"
+	"github.com/shvdg-coder/base-logic/pkg/testable/database"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestMaintainingPartitions verifies whether future partitions are created and those past their retention detached.
+func TestMaintainingPartitions(t *testing.T) {
+	dbContainer, dbs := setup(t)
+	defer dbContainer.Teardown()
+
+	partitions := pkg.NewPartitionSvc(dbs)
+	policy := pkg.NewPartitionPolicy(logsTableName, pkg.PartitionDaily, pkg.WithPremake(2),
+		pkg.WithPartitionRetention(30*24*time.Hour, false))
+
+	// Execute
+	report, err := partitions.Maintain(context.Background(), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test
+	if len(report.Created) != 3 || len(report.Detached) != 1 || report.Detached[0] != oldLogsPartitionName || len(report.Gaps) != 0 {
+		t.Fatalf("expected 3 partitions created and the old one detached, got %+v", report)
+	}
+	database.AssertCount(t, dbContainer, countLogsPartitionsQuery, 3)
+	if _, err = dbContainer.DB().Exec(insertLogQuery); err != nil {
+		t.Fatal(err)
+	}
+
+	// Maintaining again changes nothing
+	report, err = partitions.Maintain(context.Background(), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Created) != 0 || len(report.Detached) != 0 {
+		t.Fatalf("expected nothing to change, got %+v", report)
+	}
+}
+
+// TestReportingCoverageGaps verifies whether a missing partition is reported as a gap.
+func TestReportingCoverageGaps(t *testing.T) {
+	dbContainer, dbs := setup(t)
+	defer dbContainer.Teardown()
+
+	partitions := pkg.NewPartitionSvc(dbs)
+	policy := pkg.NewPartitionPolicy(logsTableName, pkg.PartitionDaily, pkg.WithPremake(2))
+	if _, err := partitions.Maintain(context.Background(), policy); err != nil {
+		t.Fatal(err)
+	}
+
+	// Remove the partition of tomorrow
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1)
+	name := fmt.Sprintf("%s_p%s", logsTableName, tomorrow.Format("20060102"))
+	if _, err := dbContainer.DB().Exec(fmt.Sprintf("DROP TABLE %s", pq.QuoteIdentifier(name))); err != nil {
+		t.Fatal(err)
+	}
+
+	// Execute
+	gaps, err := partitions.CoverageGaps(context.Background(), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test, the old partition is followed by a gap up to today, and tomorrow is missing
+	if len(gaps) != 2 || gaps[1].To.Sub(gaps[1].From) != 24*time.Hour {
+		t.Fatalf("expected 2 gaps, got %+v", gaps)
+	}
+}
+
+// TestMaintainingPartitionsConcurrently verifies whether several instances can maintain the same table at once.
+func TestMaintainingPartitionsConcurrently(t *testing.T) {
+	dbContainer, dbs := setup(t)
+	defer dbContainer.Teardown()
+
+	policy := pkg.NewPartitionPolicy(logsTableName, pkg.PartitionMonthly, pkg.WithPremake(1))
+
+	// Execute
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = pkg.NewPartitionSvc(dbs).Maintain(context.Background(), policy)
+		}(i)
+	}
+	wg.Wait()
+
+	// Test
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	gaps, err := pkg.NewPartitionSvc(dbs).CoverageGaps(context.Background(), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gaps) != 1 {
+		t.Fatalf("expected the gap between the old partition and the current month only, got %+v", gaps)
+	}
+}
+
+// TestMaintainingUnboundedPartitions verifies whether a partition unbounded from below is neither retired nor overlapped.
+func TestMaintainingUnboundedPartitions(t *testing.T) {
+	dbContainer, dbs := setup(t)
+	defer dbContainer.Teardown()
+
+	// The initial partition holds everything up to the day after tomorrow
+	bound := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 2)
+	query := fmt.Sprintf(createEventsTableQuery, pq.QuoteLiteral(bound.Format("2006-01-02 15:04:05-07:00")))
+	if _, err := dbs.DB().Exec(query); err != nil {
+		t.Fatal(err)
+	}
+
+	partitions := pkg.NewPartitionSvc(dbs)
+	policy := pkg.NewPartitionPolicy(eventsTableName, pkg.PartitionDaily, pkg.WithPremake(2),
+		pkg.WithPartitionRetention(24*time.Hour, true))
+
+	// Execute
+	report, err := partitions.Maintain(context.Background(), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test
+	if len(report.Created) != 1 || len(report.Detached) != 0 || len(report.Dropped) != 0 || len(report.Gaps) != 0 {
+		t.Fatalf("expected only the partition after the initial one to be created, got %+v", report)
+	}
+	database.AssertCount(t, dbContainer, countEventsPartitionsQuery, 2)
+}
+
+// TestMaintainingNonTimePartitions verifies whether a table partitioned by a range of ids is refused.
+func TestMaintainingNonTimePartitions(t *testing.T) {
+	dbContainer, dbs := setup(t)
+	defer dbContainer.Teardown()
+
+	if _, err := dbs.DB().Exec(createAccountsTableQuery); err != nil {
+		t.Fatal(err)
+	}
+
+	// Execute
+	policy := pkg.NewPartitionPolicy(accountsTableName, pkg.PartitionDaily, pkg.WithPartitionRetention(time.Hour, true))
+	_, err := pkg.NewPartitionSvc(dbs).Maintain(context.Background(), policy)
+
+	// Test
+	if err == nil {
+		t.Fatal("expected a table partitioned by ids to be refused")
+	}
+	database.AssertCount(t, dbContainer, countAccountsPartitionsQuery, 1)
+}
+
+// setup prepares the tests by creating the partitioned logs table.
+func setup(t *testing.T) (database.ContainerOps, *pkg.DbSvc) {
+	dbContainer, dbs := database.NewTestContainer(t)
+
+	if _, err := dbs.DB().Exec(createLogsTableQuery); err != nil {
+		t.Fatal(err)
+	}
+
+	return dbContainer, dbs
+}
@@ -0,0 +1,35 @@
+package partition
+
+// createLogsTableQuery creates the logs table, partitioned by day, along with a partition long past its retention.
+const createLogsTableQuery = `CREATE TABLE logs (
+		id bigserial,
+		message text,
+		created_at timestamptz NOT NULL
+    ) PARTITION BY RANGE (created_at);
+	CREATE TABLE logs_old PARTITION OF logs FOR VALUES FROM ('2000-01-01 00:00:00+00') TO ('2000-01-02 00:00:00+00');`
+
+// countLogsPartitionsQuery counts the partitions attached to the logs table.
+const countLogsPartitionsQuery = `SELECT COUNT(*) FROM pg_inherits WHERE inhparent = 'logs'::regclass;`
+
+// insertLogQuery inserts a log of the current time.
+const insertLogQuery = `INSERT INTO logs (message, created_at) VALUES ('started', now());`
+
+// createEventsTableQuery creates the events table, partitioned by day, along with a partition holding everything up to
+// the bound to be formatted.
+const createEventsTableQuery = `CREATE TABLE events (
+		id bigserial,
+		created_at timestamptz NOT NULL
+    ) PARTITION BY RANGE (created_at);
+	CREATE TABLE events_initial PARTITION OF events FOR VALUES FROM (MINVALUE) TO (%s);`
+
+// countEventsPartitionsQuery counts the partitions attached to the events table.
+const countEventsPartitionsQuery = `SELECT COUNT(*) FROM pg_inherits WHERE inhparent = 'events'::regclass;`
+
+// createAccountsTableQuery creates the accounts table, partitioned by a range of ids.
+const createAccountsTableQuery = `CREATE TABLE accounts (
+		id bigint NOT NULL
+    ) PARTITION BY RANGE (id);
+	CREATE TABLE accounts_first PARTITION OF accounts FOR VALUES FROM (MINVALUE) TO (1000);`
+
+// countAccountsPartitionsQuery counts the partitions attached to the accounts table.
+const countAccountsPartitionsQuery = `SELECT COUNT(*) FROM pg_inherits WHERE inhparent = 'accounts'::regclass;`
@@ -0,0 +1,16 @@
+package repository
+
+// createContactsTableQuery creates the contacts table.
+const createContactsTableQuery = `CREATE TABLE contacts (
+		id serial NOT NULL PRIMARY KEY,
+		name varchar(255),
+		phone varchar(255),
+		version int NOT NULL,
+		deleted_at timestamptz
+    );`
+
+// createWhoAmIViewQuery creates a view exposing the user claim of the current transaction.
+const createWhoAmIViewQuery = `CREATE VIEW whoami AS SELECT 1 AS id, coalesce(current_setting('app.user_id', true), '') AS user_id;`
+
+// selectUserClaimQuery selects the user claim of the current transaction.
+const selectUserClaimQuery = `SELECT coalesce(current_setting('app.user_id', true), '');`
@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/shvdg-coder/base-logic/pkg"
+	"github.com/shvdg-coder/base-logic/pkg/testable/database"
+	"strings"
+	"testing"
+)
+
+// contact represents a row of the contacts table.
+type contact struct {
+	ID      int    `db:"id"`
+	Name    string `db:"name"`
+	Phone   string `db:"phone"`
+	Version int    `db:"version"`
+}
+
+// TestRepository verifies whether entities can be created, retrieved, updated and soft deleted.
+func TestRepository(t *testing.T) {
+	dbContainer, repository := setup(t)
+	defer dbContainer.Teardown()
+	ctx := context.Background()
+
+	// Create
+	john := &contact{Name: "John Doe", Phone: "+1-202-555-0125"}
+	if err := repository.Create(ctx, john); err != nil {
+		t.Fatal(err)
+	}
+	if john.ID == 0 || john.Version != 1 {
+		t.Fatalf("expected a generated key and version 1, got %+v", john)
+	}
+
+	// Update
+	john.Phone = "+1-202-555-0126"
+	if err := repository.Update(ctx, john); err != nil {
+		t.Fatal(err)
+	}
+
+	// Find
+	found, err := repository.Find(ctx, map[string]interface{}{"phone": "+1-202-555-0126"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Version != 2 {
+		t.Fatalf("unexpected found contacts: %v", found)
+	}
+
+	// Delete
+	if err = repository.Delete(ctx, john); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repository.Get(ctx, john.ID); !errors.Is(err, pkg.ErrNotFound) {
+		t.Fatalf("expected %v, got %v", pkg.ErrNotFound, err)
+	}
+}
+
+// TestRepositoryConflict verifies whether updating a stale entity is reported as a conflict.
+func TestRepositoryConflict(t *testing.T) {
+	dbContainer, repository := setup(t)
+	defer dbContainer.Teardown()
+	ctx := context.Background()
+
+	john := &contact{Name: "John Doe"}
+	if err := repository.Create(ctx, john); err != nil {
+		t.Fatal(err)
+	}
+
+	stale, err := repository.Get(ctx, john.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	john.Name = "Jane Doe"
+	if err = repository.Update(ctx, john); err != nil {
+		t.Fatal(err)
+	}
+
+	// Test
+	var conflict *pkg.ConflictError
+	stale.Name = "Jim Doe"
+	if err = repository.Update(ctx, stale); !errors.As(err, &conflict) {
+		t.Fatalf("expected a conflict, got %v", err)
+	}
+	// A failed create leaves the version of the entity untouched
+	tooLong := &contact{Name: strings.Repeat("J", 256)}
+	if err = repository.Create(ctx, tooLong); err == nil || tooLong.Version != 0 {
+		t.Fatalf("expected a failed create leaving version 0, got %v and version %d", err, tooLong.Version)
+	}
+}
+
+// whoAmI represents the row of the whoami view.
+type whoAmI struct {
+	ID     int    `db:"id"`
+	UserID string `db:"user_id"`
+}
+
+// TestSecurityClaims verifies whether the claims held by the context are applied to transactions and repository calls.
+func TestSecurityClaims(t *testing.T) {
+	dbContainer, repository := setup(t)
+	defer dbContainer.Teardown()
+	dbs := repository.Database
+	ctx := pkg.ContextWithClaims(context.Background(), pkg.SecurityClaims{"app.user_id": "42"})
+
+	if _, err := dbs.DB().Exec(createWhoAmIViewQuery); err != nil {
+		t.Fatal(err)
+	}
+
+	// Within a transaction
+	var userID string
+	err := dbs.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		return tx.QueryRowContext(ctx, selectUserClaimQuery).Scan(&userID)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userID != "42" {
+		t.Fatalf("expected the user claim within the transaction, got %q", userID)
+	}
+
+	// Through a repository
+	whoAmIs, err := pkg.NewRepository[whoAmI](dbs, "whoami")
+	if err != nil {
+		t.Fatal(err)
+	}
+	row, err := whoAmIs.Get(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row.UserID != "42" {
+		t.Fatalf("expected the user claim through the repository, got %q", row.UserID)
+	}
+
+	// Without claims, none are set
+	if row, err = whoAmIs.Get(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if row.UserID != "" {
+		t.Fatalf("expected no user claim, got %q", row.UserID)
+	}
+}
+
+// setup prepares the tests by performing the minimally required steps.
+func setup(t *testing.T) (database.ContainerOps, *pkg.Repository[contact]) {
+	dbContainer, dbs := database.NewTestContainer(t)
+
+	if _, err := dbs.DB().Exec(createContactsTableQuery); err != nil {
+		t.Fatal(err)
+	}
+
+	repository, err := pkg.NewRepository[contact](dbs, "contacts",
+		pkg.WithGeneratedKey(),
+		pkg.WithVersionColumn("version"),
+		pkg.WithSoftDelete("deleted_at"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dbContainer, repository
+}
@@ -0,0 +1,5 @@
+package retention
+
+const eventsTableName = "events"
+const eventsArchiveTableName = "events_archive"
+const eventsTimeColumn = "created_at"
@@ -0,0 +1,23 @@
+package retention
+
+// createEventsTableQuery creates the events table.
+const createEventsTableQuery = `CREATE TABLE events (
+		id serial PRIMARY KEY,
+		name text NOT NULL,
+		created_at timestamptz NOT NULL
+    );`
+
+// insertEventsQuery inserts 25 events older than a month, and 5 recent events.
+const insertEventsQuery = `INSERT INTO events (name, created_at)
+	SELECT 'old-' || i, now() - interval '60 days' + i * interval '1 minute' FROM generate_series(1, 25) i
+	UNION ALL
+	SELECT 'new-' || i, now() - i * interval '1 minute' FROM generate_series(1, 5) i;`
+
+// countEventsQuery counts the events.
+const countEventsQuery = `SELECT COUNT(*) FROM events;`
+
+// countArchivedEventsQuery counts the archived events.
+const countArchivedEventsQuery = `SELECT COUNT(*) FROM events_archive;`
+
+// insertOldEventQuery inserts an event older than a month.
+const insertOldEventQuery = `INSERT INTO events (name, created_at) VALUES ('late', now() - interval '45 days');`
@@ -0,0 +1,162 @@
+package retention
+
+import (
+	"context"
+	"github.com/shvdg-coder/base-logic/pkg"
+	"github.com/shvdg-coder/base-logic/pkg/testable/database"
+	"testing"
+	"time"
+)
+
+// TestArchivingInBatches verifies whether rows past their retention are moved into the archive table and exported in batches.
+func TestArchivingInBatches(t *testing.T) {
+	dbContainer, dbs := setup(t)
+	defer dbContainer.Teardown()
+
+	var progress []pkg.RetentionProgress
+	retention := pkg.NewRetentionSvc(dbs, pkg.WithRetentionObserver(func(p pkg.RetentionProgress) {
+		progress = append(progress, p)
+	}))
+	policy := pkg.NewRetentionPolicy(eventsTableName, eventsTimeColumn, 30*24*time.Hour,
+		pkg.WithArchiveTable(eventsArchiveTableName), pkg.WithArchiveExport(t.TempDir()), pkg.WithRetentionBatches(10, 0))
+
+	// Execute
+	result, err := retention.RunPolicy(context.Background(), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test
+	if result.RowsProcessed != 25 || result.Batches != 3 || !result.IsCompleted || len(result.ExportedFiles) != 3 {
+		t.Fatalf("expected 25 rows in 3 batches, exported to 3 files, got %+v", result)
+	}
+	if len(progress) != 3 || progress[2].BatchRows != 5 || progress[2].RowsProcessed != 25 {
+		t.Fatalf("expected progress for every batch, got %+v", progress)
+	}
+	database.AssertCount(t, dbContainer, countEventsQuery, 5)
+	database.AssertCount(t, dbContainer, countArchivedEventsQuery, 25)
+
+	records, err := pkg.GetCSVRecords(result.ExportedFiles[0], false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 10 {
+		t.Fatalf("expected 10 exported rows, got %d", len(records))
+	}
+}
+
+// TestResumingRetention verifies whether a run interrupted between batches is resumed with its original cutoff.
+func TestResumingRetention(t *testing.T) {
+	dbContainer, dbs := setup(t)
+	defer dbContainer.Teardown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	retention := pkg.NewRetentionSvc(dbs, pkg.WithRetentionObserver(func(p pkg.RetentionProgress) {
+		cancel()
+	}))
+	policy := pkg.NewRetentionPolicy(eventsTableName, eventsTimeColumn, 30*24*time.Hour, pkg.WithRetentionBatches(10, time.Second))
+
+	// Interrupt after the first batch
+	result, err := retention.RunPolicy(ctx, policy)
+	if err == nil || result.Batches != 1 {
+		t.Fatalf("expected the run to be interrupted after a batch, got %+v", result)
+	}
+	database.AssertCount(t, dbContainer, countEventsQuery, 20)
+
+	// Resume
+	retention.Observer = nil
+	resumed, err := retention.RunPolicy(context.Background(), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test
+	if !resumed.Cutoff.Equal(result.Cutoff) || resumed.RowsProcessed != 15 {
+		t.Fatalf("expected the run to resume with its cutoff, got %+v", resumed)
+	}
+	database.AssertCount(t, dbContainer, countEventsQuery, 5)
+
+	// A completed run is followed by a new one
+	if _, err = dbContainer.DB().Exec(insertOldEventQuery); err != nil {
+		t.Fatal(err)
+	}
+	next, err := retention.RunPolicy(context.Background(), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.RowsProcessed != 1 || !next.Cutoff.After(result.Cutoff) {
+		t.Fatalf("expected a new run to purge the late event, got %+v", next)
+	}
+}
+
+// TestRetentionCheckpointsPerPolicy verifies whether policies on the same table keep their own checkpoints.
+func TestRetentionCheckpointsPerPolicy(t *testing.T) {
+	dbContainer, dbs := setup(t)
+	defer dbContainer.Teardown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	retention := pkg.NewRetentionSvc(dbs, pkg.WithRetentionObserver(func(p pkg.RetentionProgress) {
+		cancel()
+	}))
+	policy := pkg.NewRetentionPolicy(eventsTableName, eventsTimeColumn, 30*24*time.Hour, pkg.WithRetentionBatches(10, time.Second))
+	other := pkg.NewRetentionPolicy(eventsTableName, eventsTimeColumn, 90*24*time.Hour)
+
+	// Interrupt the policy after the first batch, and run the other policy in between
+	result, err := retention.RunPolicy(ctx, policy)
+	if err == nil || result.Batches != 1 {
+		t.Fatalf("expected the run to be interrupted after a batch, got %+v", result)
+	}
+	retention.Observer = nil
+	if _, err = retention.RunPolicy(context.Background(), other); err != nil {
+		t.Fatal(err)
+	}
+
+	// Execute
+	resumed, err := retention.RunPolicy(context.Background(), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test
+	if !resumed.Cutoff.Equal(result.Cutoff) || resumed.RowsProcessed != 15 {
+		t.Fatalf("expected the run to resume with its cutoff, got %+v", resumed)
+	}
+}
+
+// TestRunningDuePolicies verifies whether policies only run again once their interval elapsed.
+func TestRunningDuePolicies(t *testing.T) {
+	dbContainer, dbs := setup(t)
+	defer dbContainer.Teardown()
+
+	policy := pkg.NewRetentionPolicy(eventsTableName, eventsTimeColumn, 30*24*time.Hour, pkg.WithRetentionInterval(time.Hour))
+	retention := pkg.NewRetentionSvc(dbs, pkg.WithRetentionPolicies(policy))
+
+	// Execute
+	results, err := retention.RunDuePolicies(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := retention.RunDuePolicies(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test
+	if len(results) != 1 || results[0].RowsProcessed != 25 || len(again) != 0 {
+		t.Fatalf("expected the policy to run once, got %d and %d results", len(results), len(again))
+	}
+}
+
+// setup prepares the tests by creating the events table, holding events both past and within their retention.
+func setup(t *testing.T) (database.ContainerOps, *pkg.DbSvc) {
+	dbContainer, dbs := database.NewTestContainer(t)
+
+	if _, err := dbs.DB().Exec(createEventsTableQuery); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dbs.DB().Exec(insertEventsQuery); err != nil {
+		t.Fatal(err)
+	}
+
+	return dbContainer, dbs
+}
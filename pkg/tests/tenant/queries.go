@@ -0,0 +1,23 @@
+package tenant
+
+// createContactsTableQuery creates the contacts table.
+const createContactsTableQuery = `CREATE TABLE contacts (
+		id int NOT NULL PRIMARY KEY,
+		name varchar(255)
+    );`
+
+// insertContactQuery inserts a contact.
+const insertContactQuery = `INSERT INTO contacts (id, name) VALUES ($1, $2);`
+
+// countContactsQuery counts the contacts.
+const countContactsQuery = `SELECT count(*) FROM contacts;`
+
+// createCountriesTableQuery creates the countries table in the public schema, which is shared by the tenants.
+const createCountriesTableQuery = `CREATE TABLE public.countries (
+		code char(2) NOT NULL PRIMARY KEY,
+		name varchar(255)
+    );
+	INSERT INTO public.countries (code, name) VALUES ('NL', 'Netherlands'), ('BE', 'Belgium');`
+
+// countCountriesQuery counts the countries.
+const countCountriesQuery = `SELECT count(*) FROM countries;`
@@ -0,0 +1,101 @@
+package tenant
+
+import (
+	"context"
+	"database/sql"
+	"github.com/shvdg-coder/base-logic/pkg"
+	"github.com/shvdg-coder/base-logic/pkg/testable/database"
+	"testing"
+)
+
+// TestTenantIsolation verifies whether the data of tenants is isolated in their own schema.
+func TestTenantIsolation(t *testing.T) {
+	dbContainer, tenants := setup(t)
+	defer dbContainer.Teardown()
+	ctx := context.Background()
+
+	// Provision twice, as it is expected to be idempotent
+	var acme, globex *pkg.Tenant
+	for i := 0; i < 2; i++ {
+		var err error
+		if acme, err = tenants.Provision(ctx, "acme"); err != nil {
+			t.Fatal(err)
+		}
+		if globex, err = tenants.Provision(ctx, "globex"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Insert a contact for a single tenant
+	err := acme.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		_, err := tx.Exec(insertContactQuery, 1, "John Doe")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test
+	expected := map[string]int{acme.Name: 1, globex.Name: 0}
+	err = tenants.ForEachTenant(ctx, func(ctx context.Context, tenant *pkg.Tenant) error {
+		conn, err := tenant.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		var count int
+		if err = conn.QueryRowContext(ctx, countContactsQuery).Scan(&count); err != nil {
+			return err
+		}
+		if count != expected[tenant.Name] {
+			t.Errorf("expected %d contacts for %s, got %d", expected[tenant.Name], tenant.Name, count)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestSharedSchemas verifies whether the tables of the public schema stay reachable within the transactions of a tenant.
+func TestSharedSchemas(t *testing.T) {
+	dbContainer, tenants := setup(t)
+	defer dbContainer.Teardown()
+	ctx := context.Background()
+
+	if _, err := tenants.Database.DB().Exec(createCountriesTableQuery); err != nil {
+		t.Fatal(err)
+	}
+
+	acme, err := tenants.Provision(ctx, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Test
+	var countries, contacts int
+	err = acme.RunInTransaction(ctx, func(tx *sql.Tx) error {
+		if err := tx.QueryRowContext(ctx, countCountriesQuery).Scan(&countries); err != nil {
+			return err
+		}
+		return tx.QueryRowContext(ctx, countContactsQuery).Scan(&contacts)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if countries != 2 || contacts != 0 {
+		t.Errorf("expected 2 shared countries and no contacts, got %d and %d", countries, contacts)
+	}
+}
+
+// setup prepares the tests by performing the minimally required steps.
+func setup(t *testing.T) (database.ContainerOps, *pkg.TenantSvc) {
+	dbContainer, dbs := database.NewTestContainer(t)
+
+	tenants := pkg.NewTenantSvc(dbs, pkg.WithMigrations(
+		&pkg.Migration{Version: 1, Name: "create contacts", SQL: createContactsTableQuery},
+	))
+
+	return dbContainer, tenants
+}